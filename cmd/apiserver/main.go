@@ -2,6 +2,8 @@ package main
 
 import (
 	"log"
+	// time zones of schedules work without system tz database
+	_ "time/tzdata"
 
 	"github.com/supby/job-worker/internal/api"
 )
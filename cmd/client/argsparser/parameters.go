@@ -1,8 +1,39 @@
 package argsparser
 
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
 type Parameters struct {
 	CLICommand  string
 	CommandName string
 	Arguments   []string
-	JobID       string
+	JobID       uuid.UUID
+	Interactive bool
+	TTY         bool
+	Labels      map[string]string
+	Selector    string
+	// IdempotencyKey makes retried start return already started job
+	IdempotencyKey string
+	// MaxAttempts enables retries of failed job
+	MaxAttempts int
+	// RestartMode is never, on-failure or always
+	RestartMode string
+	// Bulk commands select jobs with Selector and Statuses instead of JobID
+	Bulk     bool
+	Statuses []string
+	DryRun   bool
+	// Template is name of server template, TemplateParameters are its parameters
+	Template           string
+	TemplateParameters map[string]string
+	// Timeout stops job running longer
+	Timeout time.Duration
+	// Priority orders jobs queued on server, Preemptible jobs can be stopped for jobs with higher priority
+	Priority    int
+	Preemptible bool
+	// ConfigFile is server configuration and Roles are client roles used by policy test
+	ConfigFile string
+	Roles      []string
 }
@@ -2,29 +2,61 @@ package argsparser
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
 )
 
 const START_COMMAND = "start"
 const STOP_COMMAND = "stop"
 const QUERY_COMMAND = "query"
 const STREAM_COMMAND = "stream"
+const ATTACH_COMMAND = "attach"
+const RUN_COMMAND = "run"
+const LIST_COMMAND = "list"
+const DELETE_COMMAND = "delete"
+const TEMPLATE_COMMAND = "template"
+const POLICY_COMMAND = "policy"
+const PAUSE_COMMAND = "pause"
+const RESUME_COMMAND = "resume"
 
 func GetParams(args []string) (*Parameters, error) {
 	argsLen := len(args)
 
-	if argsLen < 2 {
+	if argsLen < 1 {
 		return nil, fmt.Errorf("invalid parameters %v", args)
 	}
 
 	switch args[0] {
 	case START_COMMAND:
-		return getStartCommandParams(args[1:])
+		return getStartCommandParams(START_COMMAND, args[1:])
+	case RUN_COMMAND:
+		return getStartCommandParams(RUN_COMMAND, args[1:])
 	case STOP_COMMAND:
+		if len(args) > 1 && strings.HasPrefix(args[1], "--") {
+			return getBulkCommandParams(STOP_COMMAND, args[1:])
+		}
 		return getJobCommandParams(STOP_COMMAND, args[1:])
+	case DELETE_COMMAND:
+		return getBulkCommandParams(DELETE_COMMAND, args[1:])
 	case QUERY_COMMAND:
 		return getJobCommandParams(QUERY_COMMAND, args[1:])
+	case PAUSE_COMMAND:
+		return getJobCommandParams(PAUSE_COMMAND, args[1:])
+	case RESUME_COMMAND:
+		return getJobCommandParams(RESUME_COMMAND, args[1:])
 	case STREAM_COMMAND:
 		return getJobCommandParams(STREAM_COMMAND, args[1:])
+	case ATTACH_COMMAND:
+		return getJobCommandParams(ATTACH_COMMAND, args[1:])
+	case LIST_COMMAND:
+		return getListCommandParams(args[1:])
+	case TEMPLATE_COMMAND:
+		return getTemplateCommandParams(args[1:])
+	case POLICY_COMMAND:
+		return getPolicyCommandParams(args[1:])
 	}
 
 	return nil, fmt.Errorf("invalid command %v", args)
@@ -39,14 +71,19 @@ func getJobCommandParams(command string, args []string) (*Parameters, error) {
 		return nil, fmt.Errorf("invalid parameters for %v command: %v", params.CLICommand, args)
 	}
 
-	params.JobID = args[1]
+	// accepts both canonical UUID and raw hex forms
+	jobID, err := uuid.Parse(args[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid job ID for %v command: %w", params.CLICommand, err)
+	}
+	params.JobID = jobID
 
 	return &params, nil
 }
 
-func getStartCommandParams(args []string) (*Parameters, error) {
+func getStartCommandParams(command string, args []string) (*Parameters, error) {
 	params := Parameters{
-		CLICommand: START_COMMAND,
+		CLICommand: command,
 	}
 
 	if len(args) < 2 || args[0] != "-c" {
@@ -55,8 +92,209 @@ func getStartCommandParams(args []string) (*Parameters, error) {
 
 	params.CommandName = args[1]
 
-	if len(args) >= 4 && args[2] == "-args" {
-		params.Arguments = args[3:]
+	for i := 2; i < len(args); i++ {
+		switch args[i] {
+		case "-i":
+			params.Interactive = true
+		case "-t":
+			params.TTY = true
+		case "--label":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value of --label for %v command", params.CLICommand)
+			}
+			i++
+			if err := setKeyValue(&params.Labels, "label", args[i]); err != nil {
+				return nil, err
+			}
+		case "--retry":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value of --retry for %v command", params.CLICommand)
+			}
+			i++
+			attempts, err := strconv.Atoi(args[i])
+			if err != nil || attempts < 1 {
+				return nil, fmt.Errorf("invalid number of attempts %v", args[i])
+			}
+			params.MaxAttempts = attempts
+		case "--restart":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value of --restart for %v command", params.CLICommand)
+			}
+			i++
+			params.RestartMode = args[i]
+		case "--idempotency-key":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value of --idempotency-key for %v command", params.CLICommand)
+			}
+			i++
+			params.IdempotencyKey = args[i]
+		case "--timeout":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value of --timeout for %v command", params.CLICommand)
+			}
+			i++
+			timeout, err := time.ParseDuration(args[i])
+			if err != nil || timeout <= 0 {
+				return nil, fmt.Errorf("invalid timeout %v", args[i])
+			}
+			params.Timeout = timeout
+		case "--priority":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value of --priority for %v command", params.CLICommand)
+			}
+			i++
+			priority, err := strconv.Atoi(args[i])
+			if err != nil {
+				return nil, fmt.Errorf("invalid priority %v", args[i])
+			}
+			params.Priority = priority
+		case "--preemptible":
+			params.Preemptible = true
+		case "-args":
+			params.Arguments = args[i+1:]
+			return &params, nil
+		default:
+			return nil, fmt.Errorf("invalid parameters for %v command: %v", params.CLICommand, args)
+		}
+	}
+
+	return &params, nil
+}
+
+func getTemplateCommandParams(args []string) (*Parameters, error) {
+	params := Parameters{
+		CLICommand: TEMPLATE_COMMAND,
+	}
+
+	if len(args) < 1 || strings.HasPrefix(args[0], "-") {
+		return nil, fmt.Errorf("missing template name for %v command", params.CLICommand)
+	}
+	params.Template = args[0]
+
+	for i := 1; i < len(args); i++ {
+		if i+1 >= len(args) {
+			return nil, fmt.Errorf("missing value of %v for %v command", args[i], params.CLICommand)
+		}
+		var err error
+		switch args[i] {
+		case "--param":
+			err = setKeyValue(&params.TemplateParameters, "parameter", args[i+1])
+		case "--label":
+			err = setKeyValue(&params.Labels, "label", args[i+1])
+		case "--idempotency-key":
+			params.IdempotencyKey = args[i+1]
+		default:
+			return nil, fmt.Errorf("invalid parameters for %v command: %v", params.CLICommand, args)
+		}
+		if err != nil {
+			return nil, err
+		}
+		i++
+	}
+
+	return &params, nil
+}
+
+// getPolicyCommandParams parses "policy test", which evaluates start policy of
+// server configuration file offline
+func getPolicyCommandParams(args []string) (*Parameters, error) {
+	params := Parameters{
+		CLICommand: POLICY_COMMAND,
+	}
+
+	if len(args) < 1 || args[0] != "test" {
+		return nil, fmt.Errorf("invalid parameters for %v command, expected test: %v", params.CLICommand, args)
+	}
+
+	for i := 1; i < len(args); i++ {
+		if args[i] == "-args" {
+			params.Arguments = args[i+1:]
+			break
+		}
+		if i+1 >= len(args) {
+			return nil, fmt.Errorf("missing value of %v for %v command", args[i], params.CLICommand)
+		}
+		switch args[i] {
+		case "--config":
+			params.ConfigFile = args[i+1]
+		case "--role":
+			params.Roles = append(params.Roles, args[i+1])
+		case "-c":
+			params.CommandName = args[i+1]
+		case "--timeout":
+			timeout, err := time.ParseDuration(args[i+1])
+			if err != nil || timeout <= 0 {
+				return nil, fmt.Errorf("invalid timeout %v", args[i+1])
+			}
+			params.Timeout = timeout
+		default:
+			return nil, fmt.Errorf("invalid parameters for %v command: %v", params.CLICommand, args)
+		}
+		i++
+	}
+
+	if params.ConfigFile == "" || params.CommandName == "" {
+		return nil, fmt.Errorf("--config and -c are required for %v command", params.CLICommand)
+	}
+	return &params, nil
+}
+
+// setKeyValue parses key=value flag value into m
+func setKeyValue(m *map[string]string, name string, arg string) error {
+	key, value, ok := strings.Cut(arg, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("invalid %v %v, expected key=value", name, arg)
+	}
+	if *m == nil {
+		*m = map[string]string{}
+	}
+	(*m)[key] = value
+	return nil
+}
+
+func getListCommandParams(args []string) (*Parameters, error) {
+	params := Parameters{
+		CLICommand: LIST_COMMAND,
+	}
+
+	switch {
+	case len(args) == 0:
+	case len(args) == 2 && args[0] == "--selector":
+		params.Selector = args[1]
+	default:
+		return nil, fmt.Errorf("invalid parameters for %v command: %v", params.CLICommand, args)
+	}
+
+	return &params, nil
+}
+
+// getBulkCommandParams parses [--selector <selector>] [--status <status>,...] [--dry-run]
+func getBulkCommandParams(command string, args []string) (*Parameters, error) {
+	params := Parameters{
+		CLICommand: command,
+		Bulk:       true,
+	}
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--selector", "--status":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing value of %v for %v command", args[i], params.CLICommand)
+			}
+			if args[i] == "--selector" {
+				params.Selector = args[i+1]
+			} else {
+				params.Statuses = strings.Split(args[i+1], ",")
+			}
+			i++
+		case "--dry-run":
+			params.DryRun = true
+		default:
+			return nil, fmt.Errorf("invalid parameters for %v command: %v", params.CLICommand, args)
+		}
+	}
+	if params.Selector == "" && len(params.Statuses) == 0 {
+		return nil, fmt.Errorf("--selector or --status is required for %v command", params.CLICommand)
 	}
 
 	return &params, nil
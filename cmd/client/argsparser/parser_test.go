@@ -0,0 +1,212 @@
+package argsparser
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// paramsCase is expected result of parsing args, nil params mean that args are rejected
+type paramsCase struct {
+	args   []string
+	params *Parameters
+}
+
+func testGetParams(t *testing.T, cases []paramsCase) {
+	t.Helper()
+
+	for _, tc := range cases {
+		params, err := GetParams(tc.args)
+		if tc.params == nil {
+			assert.Error(t, err, tc.args)
+			continue
+		}
+		if assert.NoError(t, err, tc.args) {
+			assert.Equal(t, tc.params, params, tc.args)
+		}
+	}
+}
+
+func TestJobID(t *testing.T) {
+	id := uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+
+	for _, tc := range []struct {
+		arg   string
+		valid bool
+	}{
+		{"6ba7b810-9dad-11d1-80b4-00c04fd430c8", true},
+		{"6BA7B810-9DAD-11D1-80B4-00C04FD430C8", true},
+		{"6ba7b8109dad11d180b400c04fd430c8", true},
+		{"", false},
+		{"6ba7b810", false},
+		{"6ba7b810-9dad-11d1-80b4-00c04fd430c", false},
+		{"6ba7b810-9dad-11d1-80b4-00c04fd430c8a", false},
+		{"6ba7b8109dad11d180b400c04fd430cz", false},
+		{"6ba7b810_9dad_11d1_80b4_00c04fd430c8", false},
+	} {
+		params, err := GetParams([]string{QUERY_COMMAND, "-j", tc.arg})
+		if !tc.valid {
+			assert.Error(t, err, tc.arg)
+			continue
+		}
+		if assert.NoError(t, err, tc.arg) {
+			assert.Equal(t, id, params.JobID, tc.arg)
+		}
+	}
+}
+
+func TestJobCommands(t *testing.T) {
+	id := uuid.New()
+
+	testGetParams(t, []paramsCase{
+		{[]string{"attach", "-j", id.String()}, &Parameters{CLICommand: ATTACH_COMMAND, JobID: id}},
+		{[]string{"pause", "-j", id.String()}, &Parameters{CLICommand: PAUSE_COMMAND, JobID: id}},
+		{[]string{"resume", "-j", id.String()}, &Parameters{CLICommand: RESUME_COMMAND, JobID: id}},
+		{[]string{"attach"}, nil},
+		{[]string{"attach", id.String()}, nil},
+		{[]string{"attach", "-j", id.String(), "-i"}, nil},
+		{[]string{"pause", "-j"}, nil},
+		{[]string{"resume", "-x", id.String()}, nil},
+	})
+}
+
+func TestStartCommand(t *testing.T) {
+	testGetParams(t, []paramsCase{
+		{[]string{"start", "-c", "ls"}, &Parameters{CLICommand: START_COMMAND, CommandName: "ls"}},
+		{
+			[]string{"start", "-c", "sh", "-i", "-args", "-c", "cat"},
+			&Parameters{CLICommand: START_COMMAND, CommandName: "sh", Interactive: true, Arguments: []string{"-c", "cat"}},
+		},
+		{
+			[]string{"run", "-c", "sh", "-i", "-t", "-args", "-c", "echo hi"},
+			&Parameters{CLICommand: RUN_COMMAND, CommandName: "sh", Interactive: true, TTY: true, Arguments: []string{"-c", "echo hi"}},
+		},
+		{
+			[]string{"start", "-c", "make", "--label", "pipeline=build", "--label", "team="},
+			&Parameters{CLICommand: START_COMMAND, CommandName: "make", Labels: map[string]string{"pipeline": "build", "team": ""}},
+		},
+		{
+			[]string{"start", "-c", "make", "--idempotency-key", "deploy-42"},
+			&Parameters{CLICommand: START_COMMAND, CommandName: "make", IdempotencyKey: "deploy-42"},
+		},
+		{[]string{"start", "-c", "make", "--retry", "3"}, &Parameters{CLICommand: START_COMMAND, CommandName: "make", MaxAttempts: 3}},
+		{
+			[]string{"start", "-c", "make", "--restart", "on-failure"},
+			&Parameters{CLICommand: START_COMMAND, CommandName: "make", RestartMode: "on-failure"},
+		},
+		{[]string{"start", "-c", "make", "--timeout", "1m"}, &Parameters{CLICommand: START_COMMAND, CommandName: "make", Timeout: time.Minute}},
+		{
+			[]string{"start", "-c", "make", "--priority", "-5", "--preemptible"},
+			&Parameters{CLICommand: START_COMMAND, CommandName: "make", Priority: -5, Preemptible: true},
+		},
+		{[]string{"start"}, nil},
+		{[]string{"start", "ls"}, nil},
+		{[]string{"start", "-c", "ls", "-x"}, nil},
+		{[]string{"run"}, nil},
+		{[]string{"run", "ls", "-t"}, nil},
+		{[]string{"start", "-c", "ls", "--label"}, nil},
+		{[]string{"start", "-c", "ls", "--label", "pipeline"}, nil},
+		{[]string{"start", "-c", "ls", "--label", "=build"}, nil},
+		{[]string{"start", "-c", "ls", "--idempotency-key"}, nil},
+		{[]string{"start", "-c", "ls", "--retry", "0"}, nil},
+		{[]string{"start", "-c", "ls", "--retry", "many"}, nil},
+		{[]string{"start", "-c", "ls", "--restart"}, nil},
+		{[]string{"start", "-c", "ls", "--timeout", "-1s"}, nil},
+		{[]string{"start", "-c", "ls", "--timeout", "10"}, nil},
+		{[]string{"start", "-c", "ls", "--priority", "high"}, nil},
+	})
+}
+
+func TestListCommand(t *testing.T) {
+	testGetParams(t, []paramsCase{
+		{[]string{"list"}, &Parameters{CLICommand: LIST_COMMAND}},
+		{[]string{"list", "--selector", "pipeline=build,team!=ops"}, &Parameters{CLICommand: LIST_COMMAND, Selector: "pipeline=build,team!=ops"}},
+		{[]string{"list", "--selector"}, nil},
+		{[]string{"list", "pipeline=build"}, nil},
+		{[]string{"list", "--selector", "a=b", "--selector", "c=d"}, nil},
+	})
+}
+
+func TestBulkCommands(t *testing.T) {
+	testGetParams(t, []paramsCase{
+		{
+			[]string{"stop", "--selector", "pipeline=build", "--dry-run"},
+			&Parameters{CLICommand: STOP_COMMAND, Bulk: true, Selector: "pipeline=build", DryRun: true},
+		},
+		{
+			[]string{"delete", "--status", "completed,failed"},
+			&Parameters{CLICommand: DELETE_COMMAND, Bulk: true, Statuses: []string{"completed", "failed"}},
+		},
+		{
+			[]string{"delete", "--status", "failed", "--selector", "team=ops"},
+			&Parameters{CLICommand: DELETE_COMMAND, Bulk: true, Selector: "team=ops", Statuses: []string{"failed"}},
+		},
+		{[]string{"stop", "--selector"}, nil},
+		{[]string{"stop", "--dry-run"}, nil},
+		{[]string{"stop", "--selector", ""}, nil},
+		{[]string{"delete"}, nil},
+		{[]string{"delete", "--status"}, nil},
+		{[]string{"delete", "--selector", "a=b", "-j"}, nil},
+	})
+}
+
+func TestTemplateCommand(t *testing.T) {
+	testGetParams(t, []paramsCase{
+		{[]string{"template", "backup"}, &Parameters{CLICommand: TEMPLATE_COMMAND, Template: "backup"}},
+		{
+			[]string{"template", "backup", "--param", "database=orders", "--param", "note=a=b", "--label", "team=ops", "--idempotency-key", "nightly"},
+			&Parameters{CLICommand: TEMPLATE_COMMAND, Template: "backup", TemplateParameters: map[string]string{"database": "orders", "note": "a=b"},
+				Labels: map[string]string{"team": "ops"}, IdempotencyKey: "nightly"},
+		},
+		{[]string{"template"}, nil},
+		{[]string{"template", "--param", "database=orders"}, nil},
+		{[]string{"template", "backup", "--param"}, nil},
+		{[]string{"template", "backup", "--param", "database"}, nil},
+		{[]string{"template", "backup", "--param", "=orders"}, nil},
+		{[]string{"template", "backup", "--label", "team"}, nil},
+		{[]string{"template", "backup", "--unknown", "x"}, nil},
+	})
+}
+
+func TestPolicyCommand(t *testing.T) {
+	testGetParams(t, []paramsCase{
+		{
+			[]string{"policy", "test", "--config", "server_config.yaml", "-c", "ls"},
+			&Parameters{CLICommand: POLICY_COMMAND, ConfigFile: "server_config.yaml", CommandName: "ls"},
+		},
+		{
+			[]string{"policy", "test", "--config", "server_config.yaml", "--role", "full", "--role", "ops", "-c", "rm", "--timeout", "1h", "-args", "-rf", "/tmp/cache"},
+			&Parameters{CLICommand: POLICY_COMMAND, ConfigFile: "server_config.yaml", Roles: []string{"full", "ops"}, CommandName: "rm",
+				Timeout: time.Hour, Arguments: []string{"-rf", "/tmp/cache"}},
+		},
+		{[]string{"policy"}, nil},
+		{[]string{"policy", "check", "--config", "server_config.yaml", "-c", "ls"}, nil},
+		{[]string{"policy", "test", "-c", "ls"}, nil},
+		{[]string{"policy", "test", "--config", "server_config.yaml"}, nil},
+		{[]string{"policy", "test", "--config", "server_config.yaml", "-c"}, nil},
+		{[]string{"policy", "test", "--config", "server_config.yaml", "-c", "ls", "--timeout", "soon"}, nil},
+		{[]string{"policy", "test", "--config", "server_config.yaml", "-c", "ls", "--user", "bob"}, nil},
+	})
+}
+
+func TestInvalidCommand(t *testing.T) {
+	id := uuid.New().String()
+
+	for _, args := range [][]string{
+		nil,
+		{},
+		{"unknown"},
+		{strings.ToUpper(START_COMMAND), "-c", "ls"},
+		{QUERY_COMMAND},
+		{QUERY_COMMAND, "-j"},
+		{QUERY_COMMAND, id},
+		{STOP_COMMAND, "-x", id},
+		{STREAM_COMMAND, "-j", id, id},
+	} {
+		_, err := GetParams(args)
+		assert.Error(t, err, args)
+	}
+}
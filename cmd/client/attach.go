@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/supby/job-worker/cmd/client/argsparser"
+	"github.com/supby/job-worker/generated/proto"
+	"golang.org/x/term"
+)
+
+// statusPollInterval is how often attached session checks whether job is finished
+const statusPollInterval = 500 * time.Millisecond
+
+func handleAttachCommand(ctx context.Context, wsclient proto.WorkerServiceClient, parameters *argsparser.Parameters) {
+	if err := attachJob(ctx, wsclient, parameters.JobID[:], false); err != nil {
+		log.Fatalf("Error attach: %v", err)
+	}
+}
+
+// handleRunCommand starts interactive job and attaches to it. With -t job gets
+// pseudo-terminal and local terminal is switched to raw mode.
+func handleRunCommand(ctx context.Context, pctx context.Context, wsclient proto.WorkerServiceClient, parameters *argsparser.Parameters) {
+	req := &proto.StartRequest{
+		CommandName:    parameters.CommandName,
+		Arguments:      parameters.Arguments,
+		Interactive:    true,
+		Tty:            parameters.TTY,
+		Labels:         parameters.Labels,
+		IdempotencyKey: parameters.IdempotencyKey,
+	}
+
+	fd := int(os.Stdin.Fd())
+	if parameters.TTY {
+		if !term.IsTerminal(fd) {
+			log.Fatalf("Error run command: -t requires stdin to be a terminal")
+		}
+		req.TerminalSize = getTerminalSize(fd)
+	}
+
+	resp, err := wsclient.Start(ctx, req)
+	if err != nil {
+		log.Fatalf("Error run command %v", err)
+	}
+
+	if parameters.TTY {
+		oldState, err := term.MakeRaw(fd)
+		if err != nil {
+			log.Fatalf("Error run command: failed to set raw mode: %v", err)
+		}
+		defer term.Restore(fd, oldState)
+	}
+
+	if err := attachJob(pctx, wsclient, resp.GetJobID(), parameters.TTY); err != nil {
+		log.Printf("Error attach: %v", err)
+	}
+}
+
+// attachJob forwards local stdin to the job and prints job output until job is
+// finished, stream fails or interrupt signal is received.
+func attachJob(ctx context.Context, wsclient proto.WorkerServiceClient, jobID []byte, tty bool) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := wsclient.Attach(ctx)
+	if err != nil {
+		return err
+	}
+
+	// grpc stream must not be written concurrently, all requests go through one sender
+	requests := make(chan *proto.AttachRequest, 16)
+	requests <- &proto.AttachRequest{JobID: jobID}
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case r := <-requests:
+				if err := stream.Send(r); err != nil {
+					return
+				}
+				if r.CloseInput {
+					stream.CloseSend()
+					return
+				}
+			}
+		}
+	}()
+
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if n > 0 {
+				input := make([]byte, n)
+				copy(input, buf[:n])
+				requests <- &proto.AttachRequest{Input: input}
+			}
+			if err == io.EOF {
+				requests <- &proto.AttachRequest{CloseInput: true}
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	errchan := make(chan error, 1)
+	go func() {
+		for {
+			out, err := stream.Recv()
+			if err != nil {
+				errchan <- err
+				return
+			}
+			fmt.Print(string(out.Output))
+		}
+	}()
+
+	go func() {
+		waitJobFinished(ctx, wsclient, jobID)
+		cancel()
+	}()
+
+	sigchan := make(chan os.Signal, 1)
+	signal.Notify(sigchan, os.Interrupt)
+	if tty {
+		signal.Notify(sigchan, syscall.SIGWINCH)
+	}
+	defer signal.Stop(sigchan)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-errchan:
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		case sig := <-sigchan:
+			if sig != syscall.SIGWINCH {
+				return nil
+			}
+			select {
+			case requests <- &proto.AttachRequest{Resize: getTerminalSize(int(os.Stdin.Fd()))}:
+			default:
+			}
+		}
+	}
+}
+
+func waitJobFinished(ctx context.Context, wsclient proto.WorkerServiceClient, jobID []byte) {
+	ticker := time.NewTicker(statusPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			resp, err := wsclient.QueryStatus(ctx, &proto.QueryStatusRequest{JobID: jobID})
+			if err != nil {
+				continue
+			}
+			if resp.JobStatus == proto.JobStatus_EXITED || resp.JobStatus == proto.JobStatus_STOPPED || resp.JobStatus == proto.JobStatus_PREEMPTED {
+				// give the last output chunk a chance to arrive
+				time.Sleep(statusPollInterval)
+				return
+			}
+		}
+	}
+}
+
+func getTerminalSize(fd int) *proto.TerminalSize {
+	cols, rows, err := term.GetSize(fd)
+	if err != nil {
+		return nil
+	}
+	return &proto.TerminalSize{Rows: uint32(rows), Cols: uint32(cols)}
+}
@@ -2,25 +2,33 @@ package main
 
 import (
 	"context"
-	"encoding/hex"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/supby/job-worker/cmd/client/argsparser"
 	"github.com/supby/job-worker/generated/proto"
 	"github.com/supby/job-worker/internal/client"
+	"github.com/supby/job-worker/internal/policy"
+	"github.com/supby/job-worker/internal/workerlib/job"
 )
 
 func main() {
-	cfg := client.LoadConfigFromYaml("./client_config.yaml")
-
 	parameters, err := argsparser.GetParams(os.Args[1:])
 	if err != nil {
 		log.Fatalf("Error parsing CLI parameters: %v", err)
 	}
+	// policy is tested offline, without server connection
+	if parameters.CLICommand == argsparser.POLICY_COMMAND {
+		handlePolicyCommand(parameters)
+		return
+	}
+
+	cfg := client.LoadConfigFromYaml("./client_config.yaml")
 
 	wsclient, err := client.NewWorkerClient(cfg)
 	if err != nil {
@@ -35,18 +43,74 @@ func main() {
 	case argsparser.START_COMMAND:
 		handleStartCommand(ctx, wsclient, parameters)
 	case argsparser.STOP_COMMAND:
-		handleStopCommand(ctx, wsclient, parameters)
+		if parameters.Bulk {
+			handleBulkCommand(ctx, wsclient, parameters)
+		} else {
+			handleStopCommand(ctx, wsclient, parameters)
+		}
+	case argsparser.DELETE_COMMAND:
+		handleBulkCommand(ctx, wsclient, parameters)
 	case argsparser.QUERY_COMMAND:
 		handleQueryCommand(ctx, wsclient, parameters)
+	case argsparser.PAUSE_COMMAND:
+		handlePauseCommand(ctx, wsclient, parameters)
+	case argsparser.RESUME_COMMAND:
+		handleResumeCommand(ctx, wsclient, parameters)
 	case argsparser.STREAM_COMMAND:
 		handleStreamCommand(pctx, wsclient, parameters)
+	case argsparser.ATTACH_COMMAND:
+		handleAttachCommand(pctx, wsclient, parameters)
+	case argsparser.RUN_COMMAND:
+		handleRunCommand(ctx, pctx, wsclient, parameters)
+	case argsparser.LIST_COMMAND:
+		handleListCommand(ctx, wsclient, parameters)
+	case argsparser.TEMPLATE_COMMAND:
+		handleTemplateCommand(ctx, wsclient, parameters)
+	}
+}
+
+func handleTemplateCommand(ctx context.Context, wsclient proto.WorkerServiceClient, parameters *argsparser.Parameters) {
+	resp, err := wsclient.StartFromTemplate(ctx, &proto.StartFromTemplateRequest{
+		Template:       parameters.Template,
+		Parameters:     parameters.TemplateParameters,
+		Labels:         parameters.Labels,
+		IdempotencyKey: parameters.IdempotencyKey,
+	})
+	if err != nil {
+		log.Fatalf("Error template command %v", err)
+	}
+
+	log.Printf("Started JobID: %v\n", resp.GetJobId())
+}
+
+func handlePolicyCommand(parameters *argsparser.Parameters) {
+	conf, err := policy.ReadFromYaml(parameters.ConfigFile)
+	if err != nil {
+		log.Fatalf("Error reading policy %v", err)
+	}
+	p, err := policy.New(conf)
+	if err != nil {
+		log.Fatalf("Error invalid policy %v", err)
+	}
+
+	req := policy.Request{
+		Roles:     parameters.Roles,
+		Command:   parameters.CommandName,
+		Arguments: parameters.Arguments,
+	}
+	if parameters.Timeout > 0 {
+		req.Limits = &job.Limits{Timeout: parameters.Timeout}
+	}
+	decision := p.Evaluate(req)
+	fmt.Printf("%v: %v\n", decision.Path, decision)
+	if !decision.Allowed {
+		os.Exit(1)
 	}
 }
 
 func handleQueryCommand(ctx context.Context, wsclient proto.WorkerServiceClient, parameters *argsparser.Parameters) {
-	jobID, _ := hex.DecodeString(parameters.JobID)
 	resp, err := wsclient.QueryStatus(ctx, &proto.QueryStatusRequest{
-		JobID: jobID,
+		JobID: parameters.JobID[:],
 	})
 	if err != nil {
 		log.Fatalf("Error QueryStatus command %v", err)
@@ -55,12 +119,23 @@ func handleQueryCommand(ctx context.Context, wsclient proto.WorkerServiceClient,
 	log.Printf("QueryStatus Resp: %v", resp)
 }
 
-func handleStreamCommand(ctx context.Context, wsclient proto.WorkerServiceClient, parameters *argsparser.Parameters) {
-	jobID, _ := hex.DecodeString(parameters.JobID)
+func handleListCommand(ctx context.Context, wsclient proto.WorkerServiceClient, parameters *argsparser.Parameters) {
+	resp, err := wsclient.List(ctx, &proto.ListRequest{
+		Selector: parameters.Selector,
+	})
+	if err != nil {
+		log.Fatalf("Error List command %v", err)
+	}
+
+	for _, j := range resp.GetJobs() {
+		log.Printf("%v: %v", j.GetJobId(), j.GetStatus())
+	}
+}
 
+func handleStreamCommand(ctx context.Context, wsclient proto.WorkerServiceClient, parameters *argsparser.Parameters) {
 	ctx, cancel := context.WithCancel(ctx)
 	resp, err := wsclient.GetOutput(ctx, &proto.GetOutputRequest{
-		JobID: jobID,
+		JobID: parameters.JobID[:],
 	})
 	if err != nil {
 		log.Fatalf("Error stream: %v", err)
@@ -87,9 +162,8 @@ func handleStreamCommand(ctx context.Context, wsclient proto.WorkerServiceClient
 }
 
 func handleStopCommand(ctx context.Context, wsclient proto.WorkerServiceClient, parameters *argsparser.Parameters) {
-	jobID, _ := hex.DecodeString(parameters.JobID)
 	resp, err := wsclient.Stop(ctx, &proto.StopRequest{
-		JobID: jobID,
+		JobID: parameters.JobID[:],
 	})
 	if err != nil {
 		log.Fatalf("Error Stop command %v", err)
@@ -98,14 +172,92 @@ func handleStopCommand(ctx context.Context, wsclient proto.WorkerServiceClient,
 	log.Printf("Stop Resp: %v", resp)
 }
 
-func handleStartCommand(ctx context.Context, wsclient proto.WorkerServiceClient, parameters *argsparser.Parameters) {
-	resp, err := wsclient.Start(ctx, &proto.StartRequest{
-		CommandName: parameters.CommandName,
-		Arguments:   parameters.Arguments,
+func handlePauseCommand(ctx context.Context, wsclient proto.WorkerServiceClient, parameters *argsparser.Parameters) {
+	resp, err := wsclient.Pause(ctx, &proto.PauseRequest{
+		JobID: parameters.JobID[:],
 	})
+	if err != nil {
+		log.Fatalf("Error Pause command %v", err)
+	}
+
+	log.Printf("Pause Resp: %v", resp)
+}
+
+func handleResumeCommand(ctx context.Context, wsclient proto.WorkerServiceClient, parameters *argsparser.Parameters) {
+	resp, err := wsclient.Resume(ctx, &proto.ResumeRequest{
+		JobID: parameters.JobID[:],
+	})
+	if err != nil {
+		log.Fatalf("Error Resume command %v", err)
+	}
+
+	log.Printf("Resume Resp: %v", resp)
+}
+
+// handleBulkCommand stops or deletes all jobs matching selector and statuses
+func handleBulkCommand(ctx context.Context, wsclient proto.WorkerServiceClient, parameters *argsparser.Parameters) {
+	req := &proto.BulkJobsRequest{
+		Selector: parameters.Selector,
+		DryRun:   parameters.DryRun,
+	}
+	for _, name := range parameters.Statuses {
+		value, ok := proto.JobStatus_value[strings.ToUpper(name)]
+		if !ok {
+			log.Fatalf("Error invalid job status %v", name)
+		}
+		req.Statuses = append(req.Statuses, proto.JobStatus(value))
+	}
+
+	bulk := wsclient.StopJobs
+	if parameters.CLICommand == argsparser.DELETE_COMMAND {
+		bulk = wsclient.DeleteJobs
+	}
+	resp, err := bulk(ctx, req)
+	if err != nil {
+		log.Fatalf("Error %v command %v", parameters.CLICommand, err)
+	}
+
+	for _, r := range resp.GetResults() {
+		if r.GetMessage() != "" {
+			log.Printf("%v: %v %v", r.GetJobId(), r.GetCode(), r.GetMessage())
+		} else {
+			log.Printf("%v: %v", r.GetJobId(), r.GetCode())
+		}
+	}
+	if parameters.DryRun {
+		log.Printf("Dry run, %v jobs selected", len(resp.GetResults()))
+	}
+}
+
+func handleStartCommand(ctx context.Context, wsclient proto.WorkerServiceClient, parameters *argsparser.Parameters) {
+	req := &proto.StartRequest{
+		CommandName:    parameters.CommandName,
+		Arguments:      parameters.Arguments,
+		Interactive:    parameters.Interactive,
+		Tty:            parameters.TTY,
+		Labels:         parameters.Labels,
+		IdempotencyKey: parameters.IdempotencyKey,
+		Priority:       int32(parameters.Priority),
+		Preemptible:    parameters.Preemptible,
+	}
+	if parameters.MaxAttempts > 0 {
+		req.Retry = &proto.RetryPolicy{MaxAttempts: int32(parameters.MaxAttempts)}
+	}
+	if parameters.RestartMode != "" {
+		req.Restart = &proto.RestartPolicy{Mode: parameters.RestartMode}
+	}
+	if parameters.Timeout > 0 {
+		req.Limits = &proto.Limits{TimeoutMs: parameters.Timeout.Milliseconds()}
+	}
+	resp, err := wsclient.Start(ctx, req)
 	if err != nil {
 		log.Fatalf("Error start command %v", err)
 	}
 
-	log.Printf("Started JobID: %x\n", resp.GetJobID())
+	jobID, err := uuid.FromBytes(resp.GetJobID())
+	if err != nil {
+		log.Fatalf("Error invalid JobID in response %v", err)
+	}
+
+	log.Printf("Started JobID: %v\n", jobID)
 }
@@ -3,10 +3,16 @@ package api
 import (
 	"context"
 	"errors"
+	"io"
 	"log"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 	workerservicepb "github.com/supby/job-worker/generated/proto"
+	"github.com/supby/job-worker/internal/policy"
 	"github.com/supby/job-worker/internal/workerlib"
 	"github.com/supby/job-worker/internal/workerlib/job"
 	"google.golang.org/grpc/codes"
@@ -16,33 +22,139 @@ import (
 type WorkerServer struct {
 	workerservicepb.UnimplementedWorkerServiceServer
 	Worker workerlib.Worker
+	// Scheduler serves schedule RPCs, they are UNIMPLEMENTED when it is nil
+	Scheduler workerlib.Scheduler
+	// Workflows serves workflow RPCs, they are UNIMPLEMENTED when it is nil
+	Workflows workerlib.WorkflowEngine
+
+	// templates are set by SetTemplates
+	templates atomic.Pointer[templateConfig]
+	// policy is set by SetPolicy, nil policy allows every command
+	policy atomic.Pointer[policy.Policy]
+	// Limiter provides running jobs quotas of clients, jobs are not limited when it is nil
+	Limiter *RateLimiter
+
+	// closing is closed when output streams have to end, see CloseStreams
+	closing      chan struct{}
+	closeOnce    sync.Once
+	closeMessage string
 }
 
 func NewWorkerServer(worker workerlib.Worker) *WorkerServer {
-	return &WorkerServer{Worker: worker}
+	return &WorkerServer{Worker: worker, closing: make(chan struct{})}
+}
+
+// CloseStreams ends active and new output and attach streams with UNAVAILABLE
+// error carrying reason
+func (s *WorkerServer) CloseStreams(reason string) {
+	s.closeOnce.Do(func() {
+		s.closeMessage = reason
+		close(s.closing)
+	})
+}
+
+func (s *WorkerServer) streamsClosedError() error {
+	return status.Error(codes.Unavailable, s.closeMessage)
 }
 
 func (s *WorkerServer) Start(ctx context.Context, r *workerservicepb.StartRequest) (*workerservicepb.StartResponse, error) {
-	if r.CommandName == "" {
-		return nil, status.Error(codes.InvalidArgument, "command name is required")
+	if err := s.checkArbitraryCommand(ctx); err != nil {
+		return nil, err
+	}
+	command, err := toCommand(r)
+	if err != nil {
+		return nil, err
 	}
 
-	jobID, err := s.Worker.Start(ctx, job.Command{Name: r.CommandName, Arguments: r.Arguments})
+	return s.start(ctx, command, r.IdempotencyKey)
+}
+
+func (s *WorkerServer) start(ctx context.Context, command job.Command, idempotencyKey string) (*workerservicepb.StartResponse, error) {
+	if err := s.checkPolicy(ctx, command); err != nil {
+		return nil, err
+	}
+	var opts []workerlib.StartOption
+	// jobs of schedules and workflows get quota recorded in their spec instead
+	if quota, ok := s.Limiter.quota(ctx); ok {
+		opts = append(opts, workerlib.WithQuota(quota))
+	}
+	if idempotencyKey != "" {
+		// keys of different clients must not collide
+		subject, _ := callerIdentity(ctx)
+		opts = append(opts, workerlib.WithIdempotencyKey(subject+"/"+idempotencyKey))
+	}
+
+	jobID, err := s.Worker.Start(ctx, command, opts...)
 	if err != nil {
+		if errors.Is(err, workerlib.ErrWorkerSaturated) {
+			return nil, status.Error(codes.ResourceExhausted, "maximum number of running and queued jobs is reached")
+		}
+		if errors.Is(err, workerlib.ErrShuttingDown) {
+			return nil, status.Error(codes.Unavailable, "server is shutting down")
+		}
+		if errors.Is(err, workerlib.ErrQuotaExceeded) {
+			return nil, resourceExhausted("running jobs quota exceeded", quotaRetryDelay)
+		}
+		if errors.Is(err, job.ErrRetryInteractive) || errors.Is(err, job.ErrRetryAndRestart) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, workerlib.ErrIdempotencyKeyReused) {
+			return nil, status.Error(codes.AlreadyExists, "idempotency key was used for a different request")
+		}
 		log.Printf("[api] failed to start job: %v", err)
 		return nil, status.Error(codes.Internal, "failed to start job")
 	}
 
 	res := &workerservicepb.StartResponse{
 		JobID: jobID[:],
+		JobId: jobID.String(),
 	}
-	log.Printf("[api] job started: %x", res.JobID)
+	log.Printf("[api] job started: %v", jobID)
 
 	return res, nil
 }
 
+// toCommand validates StartRequest, errors are InvalidArgument status errors
+func toCommand(r *workerservicepb.StartRequest) (job.Command, error) {
+	if r.CommandName == "" {
+		return job.Command{}, status.Error(codes.InvalidArgument, "command name is required")
+	}
+	if err := workerlib.ValidateLabels(r.Labels); err != nil {
+		return job.Command{}, status.Error(codes.InvalidArgument, err.Error())
+	}
+	retry, err := toRetryPolicy(r.Retry)
+	if err != nil {
+		return job.Command{}, status.Error(codes.InvalidArgument, err.Error())
+	}
+	restart, err := toRestartPolicy(r.Restart)
+	if err != nil {
+		return job.Command{}, status.Error(codes.InvalidArgument, err.Error())
+	}
+	limits, err := toLimits(r.Limits)
+	if err != nil {
+		return job.Command{}, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return job.Command{
+		Name:        r.CommandName,
+		Arguments:   r.Arguments,
+		Interactive: r.Interactive,
+		TTY:         r.Tty,
+		TerminalSize: job.TerminalSize{
+			Rows: uint16(r.TerminalSize.GetRows()),
+			Cols: uint16(r.TerminalSize.GetCols()),
+		},
+		Labels:      r.Labels,
+		Retry:       retry,
+		Restart:     restart,
+		Limits:      limits,
+		Priority:    int(r.Priority),
+		Preemptible: r.Preemptible,
+	}, nil
+}
+
 func (s *WorkerServer) Stop(ctx context.Context, r *workerservicepb.StopRequest) (*workerservicepb.StopResponse, error) {
-	jobID, err := s.getJobID(r.JobID)
+	jobID, err := s.getJobID(r.JobID, r.JobId)
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, "invalid job ID")
 	}
@@ -51,16 +163,55 @@ func (s *WorkerServer) Stop(ctx context.Context, r *workerservicepb.StopRequest)
 		if errors.Is(err, workerlib.ErrJobNotFound) {
 			return nil, status.Error(codes.NotFound, "job not found")
 		}
-		log.Printf("[api] failed to stop job %x: %v", jobID, err)
+		log.Printf("[api] failed to stop job %v: %v", jobID, err)
 		return nil, status.Error(codes.Internal, "failed to stop job")
 	}
 
-	log.Printf("[api] job stopped: %x", jobID[:])
+	log.Printf("[api] job stopped: %v", jobID)
 	return &workerservicepb.StopResponse{}, nil
 }
 
+func (s *WorkerServer) Pause(ctx context.Context, r *workerservicepb.PauseRequest) (*workerservicepb.PauseResponse, error) {
+	jobID, err := s.getJobID(r.JobID, r.JobId)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid job ID")
+	}
+
+	if err := s.Worker.Pause(ctx, jobID); err != nil {
+		return nil, pauseError(jobID, err)
+	}
+
+	log.Printf("[api] job paused: %v", jobID)
+	return &workerservicepb.PauseResponse{}, nil
+}
+
+func (s *WorkerServer) Resume(ctx context.Context, r *workerservicepb.ResumeRequest) (*workerservicepb.ResumeResponse, error) {
+	jobID, err := s.getJobID(r.JobID, r.JobId)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid job ID")
+	}
+
+	if err := s.Worker.Resume(ctx, jobID); err != nil {
+		return nil, pauseError(jobID, err)
+	}
+
+	log.Printf("[api] job resumed: %v", jobID)
+	return &workerservicepb.ResumeResponse{}, nil
+}
+
+func pauseError(jobID uuid.UUID, err error) error {
+	if errors.Is(err, workerlib.ErrJobNotFound) {
+		return status.Error(codes.NotFound, "job not found")
+	}
+	if errors.Is(err, job.ErrNotRunning) || errors.Is(err, job.ErrNotPaused) {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	log.Printf("[api] failed to pause or resume job %v: %v", jobID, err)
+	return status.Error(codes.Internal, "failed to pause or resume job")
+}
+
 func (s *WorkerServer) QueryStatus(ctx context.Context, r *workerservicepb.QueryStatusRequest) (*workerservicepb.QueryStatusResponse, error) {
-	jobID, err := s.getJobID(r.JobID)
+	jobID, err := s.getJobID(r.JobID, r.JobId)
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, "invalid job ID")
 	}
@@ -70,55 +221,270 @@ func (s *WorkerServer) QueryStatus(ctx context.Context, r *workerservicepb.Query
 		if errors.Is(err, workerlib.ErrJobNotFound) {
 			return nil, status.Error(codes.NotFound, "job not found")
 		}
-		log.Printf("[api] failed to query status for job %x: %v", jobID, err)
+		log.Printf("[api] failed to query status for job %v: %v", jobID, err)
 		return nil, status.Error(codes.Internal, "failed to query job status")
 	}
 
+	return toQueryStatusResponse(jobStatus), nil
+}
+
+// Attach forwards client input to job's stdin and streams job output back.
+// The first message of the stream identifies the job.
+func (s *WorkerServer) Attach(stream workerservicepb.WorkerService_AttachServer) error {
+	r, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	jobID, err := s.getJobID(r.JobID, r.JobId)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "invalid job ID")
+	}
+	if r.Offset < 0 {
+		return status.Error(codes.InvalidArgument, "invalid output offset")
+	}
+
+	input, err := s.Worker.GetInput(stream.Context(), jobID)
+	if err != nil {
+		if errors.Is(err, workerlib.ErrJobNotFound) {
+			return status.Error(codes.NotFound, "job not found")
+		}
+		if errors.Is(err, job.ErrNoInput) {
+			return status.Error(codes.FailedPrecondition, "job is not interactive")
+		}
+		log.Printf("[api] failed to get input for job %v: %v", jobID, err)
+		return status.Error(codes.Internal, "failed to attach to job")
+	}
+
+	logChan, err := s.Worker.GetStreamFrom(stream.Context(), jobID, r.Offset)
+	if err != nil {
+		log.Printf("[api] failed to get stream for job %v: %v", jobID, err)
+		return status.Error(codes.Internal, "failed to get job output stream")
+	}
+
+	go s.forwardInput(stream, jobID, input, r)
+
+	outputStreams.Inc("attach")
+	defer outputStreams.Dec("attach")
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-s.closing:
+			return s.streamsClosedError()
+		case logData, ok := <-logChan:
+			if !ok {
+				return nil
+			}
+			if err := stream.Send(&workerservicepb.AttachResponse{Output: logData}); err != nil {
+				log.Printf("[api] failed to send output for job %v: %v", jobID, err)
+				return status.Error(codes.Internal, "failed to send job output")
+			}
+		}
+	}
+}
+
+// forwardInput writes input from attach stream to job until client stops sending
+func (s *WorkerServer) forwardInput(stream workerservicepb.WorkerService_AttachServer, jobID uuid.UUID, input io.WriteCloser, r *workerservicepb.AttachRequest) {
+	for {
+		if r.Resize != nil {
+			size := job.TerminalSize{Rows: uint16(r.Resize.GetRows()), Cols: uint16(r.Resize.GetCols())}
+			if err := s.Worker.Resize(stream.Context(), jobID, size); err != nil {
+				log.Printf("[api] failed to resize terminal for job %v: %v", jobID, err)
+			}
+		}
+		if len(r.Input) > 0 {
+			if _, err := input.Write(r.Input); err != nil {
+				log.Printf("[api] failed to write input for job %v: %v", jobID, err)
+				return
+			}
+		}
+		if r.CloseInput {
+			if err := input.Close(); err != nil {
+				log.Printf("[api] failed to close input for job %v: %v", jobID, err)
+			}
+			return
+		}
+
+		var err error
+		r, err = stream.Recv()
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *WorkerServer) List(ctx context.Context, r *workerservicepb.ListRequest) (*workerservicepb.ListResponse, error) {
+	selector, err := workerlib.ParseSelector(r.Selector)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	jobs, err := s.Worker.List(ctx, selector)
+	if err != nil {
+		log.Printf("[api] failed to list jobs: %v", err)
+		return nil, status.Error(codes.Internal, "failed to list jobs")
+	}
+
+	res := &workerservicepb.ListResponse{}
+	for _, j := range jobs {
+		res.Jobs = append(res.Jobs, &workerservicepb.JobInfo{
+			JobID:  j.ID[:],
+			JobId:  j.ID.String(),
+			Status: toQueryStatusResponse(j.Status),
+		})
+	}
+	return res, nil
+}
+
+func toQueryStatusResponse(jobStatus *job.Status) *workerservicepb.QueryStatusResponse {
 	return &workerservicepb.QueryStatusResponse{
 		ExitCode:    int32(jobStatus.ExitCode),
 		JobStatus:   workerservicepb.JobStatus(jobStatus.StatusCode),
 		CommandName: jobStatus.CommandName,
 		Arguments:   jobStatus.Arguments,
+		Labels:      jobStatus.Labels,
+		Attempts:    toAttempts(jobStatus.Attempts),
+		Restarts:    int32(jobStatus.Restarts),
+		Priority:    int32(jobStatus.Priority),
+	}
+}
+
+func toAttempts(attempts []job.Attempt) []*workerservicepb.Attempt {
+	res := make([]*workerservicepb.Attempt, 0, len(attempts))
+	for _, a := range attempts {
+		res = append(res, &workerservicepb.Attempt{
+			Number:       int32(a.Number),
+			ExitCode:     int32(a.ExitCode),
+			Signal:       int32(a.Signal),
+			Error:        a.Error,
+			OutputOffset: a.OutputOffset,
+		})
+	}
+	return res
+}
+
+// toRetryPolicy validates retry policy of StartRequest, nil policy means no retries
+func toRetryPolicy(r *workerservicepb.RetryPolicy) (*job.RetryPolicy, error) {
+	if r == nil {
+		return nil, nil
+	}
+	if r.MaxAttempts < 1 || r.InitialBackoffMs < 0 || r.MaxBackoffMs < 0 || r.Jitter < 0 || r.Jitter > 1 {
+		return nil, errors.New("invalid retry policy")
+	}
+
+	policy := &job.RetryPolicy{
+		MaxAttempts:    int(r.MaxAttempts),
+		InitialBackoff: time.Duration(r.InitialBackoffMs) * time.Millisecond,
+		MaxBackoff:     time.Duration(r.MaxBackoffMs) * time.Millisecond,
+		Jitter:         r.Jitter,
+	}
+	for _, code := range r.ExitCodes {
+		policy.ExitCodes = append(policy.ExitCodes, int(code))
+	}
+	for _, signal := range r.Signals {
+		policy.Signals = append(policy.Signals, int(signal))
+	}
+	return policy, nil
+}
+
+// toRestartPolicy validates restart policy of StartRequest, nil policy means no restarts
+func toRestartPolicy(r *workerservicepb.RestartPolicy) (*job.RestartPolicy, error) {
+	if r == nil {
+		return nil, nil
+	}
+	mode, err := job.ParseRestartMode(r.Mode)
+	if err != nil {
+		return nil, err
+	}
+	if r.DelayMs < 0 || r.CrashLoopFailures < 0 || r.CrashLoopWindowMs < 0 {
+		return nil, errors.New("invalid restart policy")
+	}
+	if mode == job.RestartNever {
+		return nil, nil
+	}
+
+	return &job.RestartPolicy{
+		Mode:              mode,
+		Delay:             time.Duration(r.DelayMs) * time.Millisecond,
+		CrashLoopFailures: int(r.CrashLoopFailures),
+		CrashLoopWindow:   time.Duration(r.CrashLoopWindowMs) * time.Millisecond,
+	}, nil
+}
+
+// maxMemoryMB is the highest memory limit which can be converted to bytes, higher
+// values would wrap around to a small limit or to zero, which is no limit
+const maxMemoryMB = math.MaxUint64 >> 20
+
+// toLimits validates limits of StartRequest, nil limits mean no limits
+func toLimits(r *workerservicepb.Limits) (*job.Limits, error) {
+	if r == nil || (r.TimeoutMs == 0 && r.MaxMemoryMb == 0 && r.MaxCpuSeconds == 0) {
+		return nil, nil
+	}
+	if r.TimeoutMs < 0 {
+		return nil, errors.New("invalid timeout")
+	}
+	if r.MaxMemoryMb > maxMemoryMB {
+		return nil, errors.New("invalid max memory")
+	}
+	return &job.Limits{
+		Timeout:        time.Duration(r.TimeoutMs) * time.Millisecond,
+		MaxMemoryBytes: r.MaxMemoryMb << 20,
+		MaxCPUSeconds:  r.MaxCpuSeconds,
 	}, nil
 }
 
 func (s *WorkerServer) GetOutput(r *workerservicepb.GetOutputRequest, stream workerservicepb.WorkerService_GetOutputServer) error {
-	jobID, err := s.getJobID(r.JobID)
+	jobID, err := s.getJobID(r.JobID, r.JobId)
 	if err != nil {
 		return status.Error(codes.InvalidArgument, "invalid job ID")
 	}
+	if r.Offset < 0 {
+		return status.Error(codes.InvalidArgument, "invalid output offset")
+	}
 
-	logChan, err := s.Worker.GetStream(stream.Context(), jobID)
+	logChan, err := s.Worker.GetStreamFrom(stream.Context(), jobID, r.Offset)
 	if err != nil {
 		if errors.Is(err, workerlib.ErrJobNotFound) {
 			return status.Error(codes.NotFound, "job not found")
 		}
-		log.Printf("[api] failed to get stream for job %x: %v", jobID, err)
+		log.Printf("[api] failed to get stream for job %v: %v", jobID, err)
 		return status.Error(codes.Internal, "failed to get job output stream")
 	}
 
+	outputStreams.Inc("grpc")
+	defer outputStreams.Dec("grpc")
+
 	for {
 		select {
 		case <-stream.Context().Done():
 			return stream.Context().Err()
+		case <-s.closing:
+			return s.streamsClosedError()
 		case logData, ok := <-logChan:
 			if !ok {
 				return nil
 			}
 			res := &workerservicepb.GetOutputResponse{Output: logData}
 			if err := stream.Send(res); err != nil {
-				log.Printf("[api] failed to send output for job %x: %v", jobID, err)
+				log.Printf("[api] failed to send output for job %v: %v", jobID, err)
 				return status.Error(codes.Internal, "failed to send job output")
 			}
 		}
 	}
 }
 
-func (s *WorkerServer) getJobID(j []byte) (uuid.UUID, error) {
-	if len(j) != 16 {
+// getJobID resolves job ID from request. String form (canonical UUID or hex)
+// takes precedence over raw bytes when both are set.
+func (s *WorkerServer) getJobID(b []byte, str string) (uuid.UUID, error) {
+	if str != "" {
+		return uuid.Parse(str)
+	}
+	if len(b) != 16 {
 		return uuid.UUID{}, errors.New("invalid job ID length")
 	}
 	var jobID uuid.UUID
-	copy(jobID[:], j)
+	copy(jobID[:], b)
 	return jobID, nil
 }
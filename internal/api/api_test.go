@@ -0,0 +1,181 @@
+package api
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	workerservicepb "github.com/supby/job-worker/generated/proto"
+	"github.com/supby/job-worker/internal/workerlib"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestClient serves server over in-memory connection
+func newTestClient(t *testing.T, server *WorkerServer) workerservicepb.WorkerServiceClient {
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	workerservicepb.RegisterWorkerServiceServer(srv, server)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}))
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return workerservicepb.NewWorkerServiceClient(conn)
+}
+
+func TestCloseStreams(t *testing.T) {
+	server := NewWorkerServer(workerlib.New())
+	c := newTestClient(t, server)
+
+	started, err := c.Start(context.Background(), &workerservicepb.StartRequest{CommandName: "sleep", Arguments: []string{"5"}})
+	assert.NoError(t, err)
+
+	stream, err := c.GetOutput(context.Background(), &workerservicepb.GetOutputRequest{JobId: started.JobId})
+	assert.NoError(t, err)
+
+	time.AfterFunc(100*time.Millisecond, func() { server.CloseStreams("server is shutting down") })
+
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, "server is shutting down", status.Convert(err).Message())
+
+	_, err = c.Stop(context.Background(), &workerservicepb.StopRequest{JobId: started.JobId})
+	assert.NoError(t, err)
+}
+
+func TestIdempotentStart(t *testing.T) {
+	ctx := context.Background()
+	server := NewWorkerServer(workerlib.New())
+
+	first, err := server.Start(ctx, &workerservicepb.StartRequest{CommandName: "sleep", Arguments: []string{"1"}, IdempotencyKey: "deploy-42"})
+	assert.NoError(t, err)
+
+	repeated, err := server.Start(ctx, &workerservicepb.StartRequest{CommandName: "sleep", Arguments: []string{"1"}, IdempotencyKey: "deploy-42"})
+	assert.NoError(t, err)
+	assert.Equal(t, first.JobId, repeated.JobId)
+
+	_, err = server.Start(ctx, &workerservicepb.StartRequest{CommandName: "sleep", Arguments: []string{"2"}, IdempotencyKey: "deploy-42"})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+}
+
+func TestStartInvalidRetryAndRestartPolicy(t *testing.T) {
+	ctx := context.Background()
+	server := NewWorkerServer(workerlib.New())
+
+	_, err := server.Start(ctx, &workerservicepb.StartRequest{CommandName: "ls", Retry: &workerservicepb.RetryPolicy{MaxAttempts: 2, Jitter: 2}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = server.Start(ctx, &workerservicepb.StartRequest{CommandName: "cat", Interactive: true, Retry: &workerservicepb.RetryPolicy{MaxAttempts: 2}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = server.Start(ctx, &workerservicepb.StartRequest{CommandName: "ls", Restart: &workerservicepb.RestartPolicy{Mode: "sometimes"}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = server.Start(ctx, &workerservicepb.StartRequest{
+		CommandName: "ls",
+		Retry:       &workerservicepb.RetryPolicy{MaxAttempts: 2},
+		Restart:     &workerservicepb.RestartPolicy{Mode: "always"},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// 1<<44 MB wraps around to zero bytes, which would be no limit
+	_, err = server.Start(ctx, &workerservicepb.StartRequest{CommandName: "ls", Limits: &workerservicepb.Limits{MaxMemoryMb: 1 << 44}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestQueuedStart(t *testing.T) {
+	ctx := context.Background()
+	server := NewWorkerServer(workerlib.New(workerlib.WithMaxRunningJobs(1), workerlib.WithMaxQueuedJobs(1)))
+
+	running, err := server.Start(ctx, &workerservicepb.StartRequest{CommandName: "sleep", Arguments: []string{"5"}})
+	assert.NoError(t, err)
+	queued, err := server.Start(ctx, &workerservicepb.StartRequest{CommandName: "ls", Priority: 5})
+	assert.NoError(t, err)
+	_, err = server.Start(ctx, &workerservicepb.StartRequest{CommandName: "ls"})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	res, err := server.QueryStatus(ctx, &workerservicepb.QueryStatusRequest{JobId: queued.JobId})
+	assert.NoError(t, err)
+	assert.Equal(t, workerservicepb.JobStatus_QUEUED, res.JobStatus)
+	assert.Equal(t, int32(5), res.Priority)
+
+	_, err = server.Stop(ctx, &workerservicepb.StopRequest{JobId: running.JobId})
+	assert.NoError(t, err)
+	_, err = server.Stop(ctx, &workerservicepb.StopRequest{JobId: queued.JobId})
+	assert.NoError(t, err)
+}
+
+func TestPauseResume(t *testing.T) {
+	ctx := context.Background()
+	server := NewWorkerServer(workerlib.New())
+
+	started, err := server.Start(ctx, &workerservicepb.StartRequest{CommandName: "sleep", Arguments: []string{"5"}})
+	assert.NoError(t, err)
+
+	_, err = server.Pause(ctx, &workerservicepb.PauseRequest{JobId: started.JobId})
+	assert.NoError(t, err)
+	res, err := server.QueryStatus(ctx, &workerservicepb.QueryStatusRequest{JobId: started.JobId})
+	assert.NoError(t, err)
+	assert.Equal(t, workerservicepb.JobStatus_PAUSED, res.JobStatus)
+
+	_, err = server.Resume(ctx, &workerservicepb.ResumeRequest{JobId: started.JobId})
+	assert.NoError(t, err)
+	_, err = server.Resume(ctx, &workerservicepb.ResumeRequest{JobId: started.JobId})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	_, err = server.Pause(ctx, &workerservicepb.PauseRequest{JobId: "00000000-0000-0000-0000-000000000001"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = server.Stop(ctx, &workerservicepb.StopRequest{JobId: started.JobId})
+	assert.NoError(t, err)
+}
+
+func TestAttachPTY(t *testing.T) {
+	c := newTestClient(t, NewWorkerServer(workerlib.New()))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	started, err := c.Start(ctx, &workerservicepb.StartRequest{
+		CommandName:  "sh",
+		Arguments:    []string{"-c", "stty size; read line; stty size; echo got $line"},
+		Interactive:  true,
+		Tty:          true,
+		TerminalSize: &workerservicepb.TerminalSize{Rows: 24, Cols: 80},
+	})
+	assert.NoError(t, err)
+
+	stream, err := c.Attach(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(&workerservicepb.AttachRequest{JobId: started.JobId}))
+
+	var output string
+	receive := func(until string) {
+		for !strings.Contains(output, until) {
+			res, err := stream.Recv()
+			if !assert.NoError(t, err, output) {
+				return
+			}
+			output += string(res.Output)
+		}
+	}
+	receive("24 80\r\n")
+
+	// input is sent after resize, so command reads the new size
+	assert.NoError(t, stream.Send(&workerservicepb.AttachRequest{Resize: &workerservicepb.TerminalSize{Rows: 40, Cols: 120}}))
+	assert.NoError(t, stream.Send(&workerservicepb.AttachRequest{Input: []byte("hello\n")}))
+	receive("got hello\r\n")
+
+	// terminal echoes input and translates newlines
+	assert.Equal(t, "24 80\r\nhello\r\n40 120\r\ngot hello\r\n", output)
+}
@@ -0,0 +1,329 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/supby/job-worker/internal/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// auditQueueSize is number of records buffered before new records are dropped
+	auditQueueSize     = 1024
+	defaultAuditSizeMB = 100
+	defaultAuditFiles  = 5
+	auditedService     = "/workerservice.WorkerService/"
+)
+
+var auditDropped = metrics.NewCounter("jobworker_audit_dropped_total", "Number of audit records dropped because audit log could not keep up.")
+
+// AuditRecord is one line of audit log
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	Subject   string    `json:"subject"`
+	Roles     []string  `json:"roles"`
+	Method    string    `json:"method"`
+	JobID     string    `json:"jobId,omitempty"`
+	Command   string    `json:"command,omitempty"`
+	Arguments []string  `json:"arguments,omitempty"`
+	Selector  string    `json:"selector,omitempty"`
+	Template  string    `json:"template,omitempty"`
+	Code      string    `json:"code"`
+	Message   string    `json:"message,omitempty"`
+}
+
+// AuditLogger writes audit records as JSON lines. Records are written asynchronously,
+// so slow or failing audit storage never blocks API calls.
+type AuditLogger struct {
+	records chan *AuditRecord
+	writer  *rotatingWriter
+	wg      sync.WaitGroup
+	// mtx guards records against sending after Close
+	mtx    sync.RWMutex
+	closed bool
+}
+
+// NewAuditLogger creates logger writing to filename, file is rotated when it
+// grows over maxSizeMB and maxBackups rotated files are kept.
+func NewAuditLogger(filename string, maxSizeMB int, maxBackups int) (*AuditLogger, error) {
+	if maxSizeMB <= 0 {
+		maxSizeMB = defaultAuditSizeMB
+	}
+	if maxBackups <= 0 {
+		maxBackups = defaultAuditFiles
+	}
+
+	writer, err := newRotatingWriter(filename, int64(maxSizeMB)*1024*1024, maxBackups)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &AuditLogger{
+		records: make(chan *AuditRecord, auditQueueSize),
+		writer:  writer,
+	}
+	a.wg.Add(1)
+	go a.run()
+	return a, nil
+}
+
+// Log queues record for writing, record is dropped if queue is full or logger is closed
+func (a *AuditLogger) Log(rec *AuditRecord) {
+	a.mtx.RLock()
+	defer a.mtx.RUnlock()
+	if a.closed {
+		log.Printf("[audit] audit logger is closed, record dropped: %v %v", rec.Method, rec.Subject)
+		return
+	}
+
+	select {
+	case a.records <- rec:
+	default:
+		auditDropped.Inc()
+		log.Printf("[audit] audit queue is full, record dropped: %v %v", rec.Method, rec.Subject)
+	}
+}
+
+// Close writes queued records and closes audit file
+func (a *AuditLogger) Close() error {
+	a.mtx.Lock()
+	if a.closed {
+		a.mtx.Unlock()
+		return nil
+	}
+	a.closed = true
+	close(a.records)
+	a.mtx.Unlock()
+
+	a.wg.Wait()
+	return a.writer.Close()
+}
+
+func (a *AuditLogger) run() {
+	defer a.wg.Done()
+
+	for rec := range a.records {
+		data, err := json.Marshal(rec)
+		if err != nil {
+			log.Printf("[audit] failed to marshal audit record: %v", err)
+			continue
+		}
+		if _, err := a.writer.Write(append(data, '\n')); err != nil {
+			log.Printf("[audit] failed to write audit record: %v", err)
+		}
+	}
+}
+
+func (a *AuditLogger) UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !isAudited(info.FullMethod) {
+		return handler(ctx, req)
+	}
+	res, err := handler(ctx, req)
+	a.Log(newAuditRecord(ctx, info.FullMethod, req, res, err))
+	return res, err
+}
+
+func (a *AuditLogger) StreamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !isAudited(info.FullMethod) {
+		return handler(srv, stream)
+	}
+	s := &auditStream{ServerStream: stream}
+	err := handler(srv, s)
+	a.Log(newAuditRecord(stream.Context(), info.FullMethod, s.first, nil, err))
+	return err
+}
+
+// isAudited reports whether method controls jobs, health checks and reflection are not audited
+func isAudited(method string) bool {
+	return strings.HasPrefix(method, auditedService)
+}
+
+// auditStream remembers the first received message, it carries job ID for streaming calls
+type auditStream struct {
+	grpc.ServerStream
+	first interface{}
+}
+
+func (s *auditStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil && s.first == nil {
+		s.first = m
+	}
+	return err
+}
+
+type jobIDRequest interface {
+	GetJobID() []byte
+	GetJobId() string
+}
+
+type selectorRequest interface {
+	GetSelector() string
+}
+
+type templateRequest interface {
+	GetTemplate() string
+}
+
+type commandRequest interface {
+	GetCommandName() string
+	GetArguments() []string
+}
+
+func newAuditRecord(ctx context.Context, method string, req interface{}, res interface{}, err error) *AuditRecord {
+	rec := &AuditRecord{
+		Time:   time.Now().UTC(),
+		Method: method,
+		Code:   status.Code(err).String(),
+	}
+	if err != nil {
+		rec.Message = status.Convert(err).Message()
+	}
+	rec.Subject, rec.Roles = callerIdentity(ctx)
+
+	if r, ok := req.(jobIDRequest); ok {
+		rec.JobID = auditJobID(r)
+	}
+	if r, ok := res.(jobIDRequest); ok && rec.JobID == "" {
+		rec.JobID = auditJobID(r)
+	}
+	if r, ok := req.(commandRequest); ok {
+		rec.Command = r.GetCommandName()
+		rec.Arguments = r.GetArguments()
+	}
+	if r, ok := req.(selectorRequest); ok {
+		rec.Selector = r.GetSelector()
+	}
+	if r, ok := req.(templateRequest); ok {
+		rec.Template = r.GetTemplate()
+	}
+	return rec
+}
+
+// auditJobID formats job ID as it was sent, even if it is invalid
+func auditJobID(r jobIDRequest) string {
+	if r.GetJobId() != "" {
+		return r.GetJobId()
+	}
+	if jobID, err := uuid.FromBytes(r.GetJobID()); err == nil {
+		return jobID.String()
+	}
+	if len(r.GetJobID()) > 0 {
+		return fmt.Sprintf("%x", r.GetJobID())
+	}
+	return ""
+}
+
+// callerIdentity returns subject and roles of client certificate or unix socket peer
+func callerIdentity(ctx context.Context) (string, []string) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", nil
+	}
+	switch info := p.AuthInfo.(type) {
+	case credentials.TLSInfo:
+		if len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+			return "", nil
+		}
+		roles, _ := RolesFromChains(info.State.VerifiedChains)
+		return info.State.VerifiedChains[0][0].Subject.String(), roles
+	case PeerCredInfo:
+		return info.Subject(), info.Roles
+	default:
+		return "", nil
+	}
+}
+
+// rotatingWriter is a file writer which renames file to file.1, file.2, ... when
+// it grows over maxSize, only maxBackups old files are kept.
+type rotatingWriter struct {
+	filename   string
+	maxSize    int64
+	maxBackups int
+	// file is nil when it couldn't be reopened, it is opened again by next Write
+	file *os.File
+	size int64
+}
+
+func newRotatingWriter(filename string, maxSize int64, maxBackups int) (*rotatingWriter, error) {
+	w := &rotatingWriter{
+		filename:   filename,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *rotatingWriter) open() error {
+	file, err := os.OpenFile(w.filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat audit file: %w", err)
+	}
+	w.file = file
+	w.size = info.Size()
+	return nil
+}
+
+func (w *rotatingWriter) Write(p []byte) (int, error) {
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+	if w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *rotatingWriter) rotate() error {
+	err := w.file.Close()
+	w.file = nil
+	if err != nil {
+		return err
+	}
+
+	os.Remove(fmt.Sprintf("%s.%d", w.filename, w.maxBackups))
+	for i := w.maxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", w.filename, i), fmt.Sprintf("%s.%d", w.filename, i+1))
+	}
+	if err := os.Rename(w.filename, w.filename+".1"); err != nil {
+		if openErr := w.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+	return w.open()
+}
+
+func (w *rotatingWriter) Close() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/supby/job-worker/internal/workerlib"
+)
+
+func TestAuditGatewayCalls(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := NewAuditLogger(filename, 1, 1)
+	assert.NoError(t, err)
+
+	g := NewGateway(NewWorkerServer(workerlib.New()), audit.UnaryInterceptor)
+
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, newTestRequest("POST", "/jobs", `{"commandName": "sleep", "arguments": ["1"]}`, "full"))
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = httptest.NewRecorder()
+	g.ServeHTTP(w, newTestRequest("DELETE", "/jobs/8d7c2a9e-4e40-4a4b-9d5b-0c1f1f2b6a11", "", "read"))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	assert.NoError(t, audit.Close())
+
+	data, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(t, lines, 2)
+
+	var start, stop AuditRecord
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &start))
+	assert.Equal(t, "/workerservice.WorkerService/Start", start.Method)
+	assert.Equal(t, "sleep", start.Command)
+	assert.Equal(t, []string{"1"}, start.Arguments)
+	assert.Equal(t, []string{"full"}, start.Roles)
+	assert.NotEmpty(t, start.JobID)
+	assert.Equal(t, "OK", start.Code)
+
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &stop))
+	assert.Equal(t, "/workerservice.WorkerService/Stop", stop.Method)
+	assert.Equal(t, "8d7c2a9e-4e40-4a4b-9d5b-0c1f1f2b6a11", stop.JobID)
+	assert.Equal(t, "PermissionDenied", stop.Code)
+}
+
+func TestRotatingWriter(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "audit.log")
+	w, err := newRotatingWriter(filename, 10, 2)
+	assert.NoError(t, err)
+
+	for _, line := range []string{"line 1\n", "line 2\n", "line 3\n", "line 4\n"} {
+		_, err := w.Write([]byte(line))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, w.Close())
+
+	data, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, "line 4\n", string(data))
+
+	data, err = os.ReadFile(filename + ".1")
+	assert.NoError(t, err)
+	assert.Equal(t, "line 3\n", string(data))
+
+	data, err = os.ReadFile(filename + ".2")
+	assert.NoError(t, err)
+	assert.Equal(t, "line 2\n", string(data))
+
+	_, err = os.Stat(filename + ".3")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRotatingWriterReopens(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "audit")
+	assert.NoError(t, os.Mkdir(dir, 0700))
+	filename := filepath.Join(dir, "audit.log")
+	w, err := newRotatingWriter(filename, 10, 2)
+	assert.NoError(t, err)
+	defer w.Close()
+
+	_, err = w.Write([]byte("line 1\n"))
+	assert.NoError(t, err)
+
+	// file can't be reopened after rotation
+	assert.NoError(t, os.RemoveAll(dir))
+	_, err = w.Write([]byte("line 2\n"))
+	assert.Error(t, err)
+	_, err = w.Write([]byte("line 3\n"))
+	assert.Error(t, err)
+
+	assert.NoError(t, os.Mkdir(dir, 0700))
+	_, err = w.Write([]byte("line 4\n"))
+	assert.NoError(t, err)
+	data, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, "line 4\n", string(data))
+}
+
+func TestAuditLogAfterClose(t *testing.T) {
+	a, err := NewAuditLogger(filepath.Join(t.TempDir(), "audit.log"), 0, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, a.Close())
+	assert.NotPanics(t, func() {
+		a.Log(&AuditRecord{Method: "/workerservice.WorkerService/Start"})
+	})
+	assert.NoError(t, a.Close())
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/google/uuid"
+	workerservicepb "github.com/supby/job-worker/generated/proto"
+	"github.com/supby/job-worker/internal/workerlib"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxBulkConcurrency limits number of jobs processed in parallel by one bulk operation
+const maxBulkConcurrency = 16
+
+// StopJobs stops all jobs matching request
+func (s *WorkerServer) StopJobs(ctx context.Context, r *workerservicepb.BulkJobsRequest) (*workerservicepb.BulkJobsResponse, error) {
+	return s.bulk(ctx, r, "stop", s.Worker.Stop)
+}
+
+// DeleteJobs removes all finished jobs matching request, running jobs have to be stopped first
+func (s *WorkerServer) DeleteJobs(ctx context.Context, r *workerservicepb.BulkJobsRequest) (*workerservicepb.BulkJobsResponse, error) {
+	return s.bulk(ctx, r, "delete", s.Worker.Delete)
+}
+
+// bulk runs op for every selected job in parallel and reports result of every job
+func (s *WorkerServer) bulk(ctx context.Context, r *workerservicepb.BulkJobsRequest, name string, op func(context.Context, uuid.UUID) error) (*workerservicepb.BulkJobsResponse, error) {
+	selector, err := workerlib.ParseSelector(r.Selector)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	// checked after parsing, blank selector like " " or "," matches every job
+	if len(selector) == 0 && len(r.Statuses) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "selector or statuses is required")
+	}
+
+	jobs, err := s.Worker.List(ctx, selector)
+	if err != nil {
+		log.Printf("[api] failed to list jobs: %v", err)
+		return nil, status.Error(codes.Internal, "failed to list jobs")
+	}
+
+	res := &workerservicepb.BulkJobsResponse{}
+	for _, j := range jobs {
+		if !hasStatus(r.Statuses, workerservicepb.JobStatus(j.Status.StatusCode)) {
+			continue
+		}
+		res.Results = append(res.Results, &workerservicepb.JobResult{
+			JobID: j.ID[:],
+			JobId: j.ID.String(),
+			Code:  codes.OK.String(),
+		})
+	}
+	if r.DryRun {
+		return res, nil
+	}
+
+	sem := make(chan struct{}, maxBulkConcurrency)
+	var wg sync.WaitGroup
+	for _, result := range res.Results {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(result *workerservicepb.JobResult) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			jobID, _ := uuid.FromBytes(result.JobID)
+			if err := op(ctx, jobID); err != nil {
+				st := bulkError(name, jobID, err)
+				result.Code = st.Code().String()
+				result.Message = st.Message()
+			}
+		}(result)
+	}
+	wg.Wait()
+
+	log.Printf("[api] bulk %v of %v jobs, selector: %q", name, len(res.Results), r.Selector)
+	return res, nil
+}
+
+func hasStatus(statuses []workerservicepb.JobStatus, s workerservicepb.JobStatus) bool {
+	if len(statuses) == 0 {
+		return true
+	}
+	for _, v := range statuses {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func bulkError(name string, jobID uuid.UUID, err error) *status.Status {
+	switch {
+	case errors.Is(err, workerlib.ErrJobNotFound):
+		return status.New(codes.NotFound, "job not found")
+	case errors.Is(err, workerlib.ErrJobRunning):
+		return status.New(codes.FailedPrecondition, "job is running")
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err)
+	}
+	log.Printf("[api] failed to %v job %v: %v", name, jobID, err)
+	return status.New(codes.Internal, "failed to "+name+" job")
+}
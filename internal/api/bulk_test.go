@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	workerservicepb "github.com/supby/job-worker/generated/proto"
+	"github.com/supby/job-worker/internal/workerlib"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestStopAndDeleteJobs(t *testing.T) {
+	ctx := context.Background()
+	server := NewWorkerServer(workerlib.New())
+
+	var buildIDs []string
+	for i := 0; i < 3; i++ {
+		res, err := server.Start(ctx, &workerservicepb.StartRequest{CommandName: "sleep", Arguments: []string{"10"}, Labels: map[string]string{"pipeline": "build"}})
+		assert.NoError(t, err)
+		buildIDs = append(buildIDs, res.JobId)
+	}
+	other, err := server.Start(ctx, &workerservicepb.StartRequest{CommandName: "sleep", Arguments: []string{"10"}, Labels: map[string]string{"pipeline": "test"}})
+	assert.NoError(t, err)
+	defer server.Stop(ctx, &workerservicepb.StopRequest{JobId: other.JobId})
+
+	// running jobs can't be deleted
+	res, err := server.DeleteJobs(ctx, &workerservicepb.BulkJobsRequest{Selector: "pipeline=build"})
+	assert.NoError(t, err)
+	assert.Len(t, res.Results, 3)
+	for _, r := range res.Results {
+		assert.Equal(t, codes.FailedPrecondition.String(), r.Code)
+	}
+
+	res, err = server.StopJobs(ctx, &workerservicepb.BulkJobsRequest{Selector: "pipeline=build", DryRun: true})
+	assert.NoError(t, err)
+	assert.Len(t, res.Results, 3)
+	for _, id := range buildIDs {
+		st, err := server.QueryStatus(ctx, &workerservicepb.QueryStatusRequest{JobId: id})
+		assert.NoError(t, err)
+		assert.Equal(t, workerservicepb.JobStatus_RUNNING, st.JobStatus)
+	}
+
+	res, err = server.StopJobs(ctx, &workerservicepb.BulkJobsRequest{Selector: "pipeline=build"})
+	assert.NoError(t, err)
+	assert.Len(t, res.Results, 3)
+	for _, r := range res.Results {
+		assert.Contains(t, buildIDs, r.JobId)
+		assert.Equal(t, codes.OK.String(), r.Code)
+	}
+
+	assert.Eventually(t, func() bool {
+		res, err := server.List(ctx, &workerservicepb.ListRequest{Selector: "pipeline=build"})
+		if err != nil {
+			return false
+		}
+		for _, j := range res.Jobs {
+			if j.Status.JobStatus == workerservicepb.JobStatus_RUNNING {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+
+	res, err = server.DeleteJobs(ctx, &workerservicepb.BulkJobsRequest{Statuses: []workerservicepb.JobStatus{workerservicepb.JobStatus_STOPPED}})
+	assert.NoError(t, err)
+	assert.Len(t, res.Results, 3)
+	for _, r := range res.Results {
+		assert.Equal(t, codes.OK.String(), r.Code)
+	}
+
+	list, err := server.List(ctx, &workerservicepb.ListRequest{})
+	assert.NoError(t, err)
+	assert.Len(t, list.Jobs, 1)
+	assert.Equal(t, other.JobId, list.Jobs[0].JobId)
+}
+
+func TestBulkJobsInvalidRequest(t *testing.T) {
+	server := NewWorkerServer(workerlib.New())
+
+	for _, selector := range []string{"", " ", ",", " , ,"} {
+		_, err := server.StopJobs(context.Background(), &workerservicepb.BulkJobsRequest{Selector: selector})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), selector)
+	}
+
+	_, err := server.DeleteJobs(context.Background(), &workerservicepb.BulkJobsRequest{Selector: "pipeline in build"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -1,17 +1,92 @@
 package api
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"time"
 
+	"github.com/supby/job-worker/internal/policy"
+	"github.com/supby/job-worker/internal/workerlib"
 	"gopkg.in/yaml.v2"
 )
 
 type Configuration struct {
+	// Endpoint is TCP address or unix:///path socket, unix socket clients are
+	// identified by uid and gid instead of certificates
 	Endpoint              string
 	CAFile                string
 	ServerCertificateFile string
 	ServerKeyFile         string
+	// HTTPEndpoint enables REST gateway when set
+	HTTPEndpoint string
+	// AllowedOrigins are web page origins which can attach to jobs over REST gateway
+	// WebSocket, the gateway's own origin is always allowed
+	AllowedOrigins []string
+	// MetricsEndpoint enables plain HTTP endpoint serving Prometheus metrics on /metrics
+	MetricsEndpoint string
+	// MaxRunningJobs limits concurrently running jobs, zero means no limit
+	MaxRunningJobs int
+	// MaxQueuedJobs queues jobs started when MaxRunningJobs is reached, zero means they are rejected
+	MaxQueuedJobs int
+	// QueueAging is how long queued job waits to gain one priority point, 1m by default
+	QueueAging time.Duration
+	// Preemption lets queued job stop running preemptible job with lower priority, it requires MaxQueuedJobs
+	Preemption bool
+	// PreemptionGracePeriod is how long preempted job has to exit after SIGTERM, 10s by default
+	PreemptionGracePeriod time.Duration
+	// Reflection enables GRPC server reflection service
+	Reflection bool
+	// AuditFile enables audit log of job control calls
+	AuditFile       string
+	AuditMaxSizeMB  int
+	AuditMaxBackups int
+	// Limits configures per client rate limits and running jobs quotas, keyed by role
+	Limits map[string]RoleLimits
+	// CRLFile enables rejection of revoked client certificates, file is re-read every CRLReloadInterval
+	CRLFile           string
+	CRLReloadInterval time.Duration
+	// StateDir records running jobs, so they are re-adopted after server restart
+	StateDir string
+	// CgroupDir runs every job in its own cgroup v2 created in this directory, so
+	// that Pause freezes whole process tree of the job with cgroup freezer
+	CgroupDir string
+	// ShutdownMode is policy for running jobs on shutdown: drain, terminate (default) or detach
+	ShutdownMode string
+	// ShutdownTimeout is how long running jobs are waited for on shutdown, 30s by default
+	ShutdownTimeout time.Duration
+	// SocketMode is permissions of unix socket, 0660 by default
+	SocketMode uint32
+	// UnixUserRoles and UnixGroupRoles map uid and gid of unix socket clients to roles
+	UnixUserRoles  map[uint32][]string
+	UnixGroupRoles map[uint32][]string
+	// IdempotencyWindow is how long idempotency keys of Start are remembered, 10m by default
+	IdempotencyWindow time.Duration
+	// Templates are named commands started with StartFromTemplate, keyed by name
+	Templates map[string]Template
+	// TemplatesOnly rejects Start, schedules and workflows of clients without one
+	// of AdminRoles, they can start templates only
+	TemplatesOnly bool
+	// AdminRoles can start arbitrary commands when TemplatesOnly is set, ["admin"] by default
+	AdminRoles []string
+	// Policy allows or denies commands by client role, executable path, arguments and limits
+	Policy policy.Config
+
+	// configFile is file configuration was loaded from, it is re-read on reload
+	configFile string
+}
+
+// shutdownMode returns validated shutdown mode of configuration
+func (c *Configuration) shutdownMode() (workerlib.ShutdownMode, error) {
+	mode, err := workerlib.ParseShutdownMode(c.ShutdownMode)
+	if err != nil {
+		return "", err
+	}
+	// jobs are detachable only when their output and state is written to state directory
+	if mode == workerlib.ShutdownDetach && c.StateDir == "" {
+		return "", fmt.Errorf("detach shutdown mode requires statedir")
+	}
+	return mode, nil
 }
 
 func LoadConfigFromYaml(filename string) Configuration {
@@ -20,19 +95,45 @@ func LoadConfigFromYaml(filename string) Configuration {
 		log.Fatalf("Configuration file '%v' does not exist.", filename)
 	}
 
-	data, _ := os.ReadFile(filename)
+	cfg, err := ReadConfigFromYaml(filename)
+	if err != nil {
+		log.Fatalf("error loading YAML config: %v", err)
+	}
+	return cfg
+}
+
+// ReadConfigFromYaml reads configuration file, unlike LoadConfigFromYaml it returns errors
+func ReadConfigFromYaml(filename string) (Configuration, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return Configuration{}, err
+	}
 
 	cfg := Configuration{}
 
 	err = yaml.Unmarshal([]byte(data), &cfg)
 	if err != nil {
-		log.Fatalf("error loading YAML config: %v", err)
+		return Configuration{}, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+
+	if err := validateTemplates(cfg.Templates); err != nil {
+		return Configuration{}, err
+	}
+	if _, err := policy.New(cfg.Policy); err != nil {
+		return Configuration{}, err
+	}
+	if cfg.Preemption && cfg.MaxQueuedJobs <= 0 {
+		return Configuration{}, fmt.Errorf("preemption requires maxqueuedjobs")
+	}
+	if _, err := cfg.shutdownMode(); err != nil {
+		return Configuration{}, err
 	}
 
 	if cfg.Endpoint == "" {
 		log.Println("Endpoint is empty in configuration, using default 127.0.0.1:5001")
 		cfg.Endpoint = "127.0.0.1:5001"
 	}
+	cfg.configFile = filename
 
-	return cfg
+	return cfg, nil
 }
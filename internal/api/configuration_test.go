@@ -0,0 +1,19 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadConfigShutdownMode(t *testing.T) {
+	_, err := readTestConfig(t, "shutdownmode: detach\n")
+	assert.EqualError(t, err, "detach shutdown mode requires statedir")
+
+	_, err = readTestConfig(t, "shutdownmode: sometimes\n")
+	assert.Error(t, err)
+
+	config, err := readTestConfig(t, "shutdownmode: detach\nstatedir: \""+t.TempDir()+"\"\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "detach", config.ShutdownMode)
+}
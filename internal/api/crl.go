@@ -0,0 +1,250 @@
+package api
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/supby/job-worker/internal/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// defaultCRLReloadInterval is how often CRL file is re-read when interval is not configured
+const defaultCRLReloadInterval = time.Minute
+
+// errCertificateRevoked is returned by TLS handshake of client with revoked certificate
+var errCertificateRevoked = errors.New("certificate is revoked")
+
+var revokedRejected = metrics.NewCounter("jobworker_revoked_certificates_rejected_total", "Number of connections and calls rejected because client certificate is revoked.")
+
+// revocationList holds serial numbers of revoked client certificates loaded from
+// CRL file. Revoked certificates are rejected during TLS handshake, calls on
+// connections established before certificate was revoked fail with UNAUTHENTICATED.
+type revocationList struct {
+	mtx     sync.RWMutex
+	file    string
+	caFile  string
+	revoked map[string]bool
+	audit   *AuditLogger
+}
+
+func newRevocationList(conf *Configuration, audit *AuditLogger) (*revocationList, error) {
+	l := &revocationList{audit: audit}
+	if err := l.load(conf); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// load reads CRL file of configuration, current list is kept when file can't be loaded
+func (l *revocationList) load(conf *Configuration) error {
+	revoked, err := readRevocationList(conf)
+	if err != nil {
+		return err
+	}
+	l.set(conf, revoked)
+	return nil
+}
+
+// readRevocationList reads revoked certificates of configuration, it is empty without CRL file
+func readRevocationList(conf *Configuration) (map[string]bool, error) {
+	if conf.CRLFile == "" {
+		return map[string]bool{}, nil
+	}
+	return readCRLFile(conf.CRLFile, conf.CAFile)
+}
+
+// set replaces revoked certificates and files they were read from
+func (l *revocationList) set(conf *Configuration, revoked map[string]bool) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.file = conf.CRLFile
+	l.caFile = conf.CAFile
+	l.revoked = revoked
+}
+
+// watch re-reads CRL file every interval until ctx is done
+func (l *revocationList) watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultCRLReloadInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		l.mtx.RLock()
+		conf := &Configuration{CRLFile: l.file, CAFile: l.caFile}
+		l.mtx.RUnlock()
+		if conf.CRLFile == "" {
+			continue
+		}
+		if err := l.load(conf); err != nil {
+			log.Printf("[api] failed to reload CRL, keeping previous one: %v", err)
+		}
+	}
+}
+
+func (l *revocationList) isRevoked(cert *x509.Certificate) bool {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+	return l.revoked[revocationKey(cert.RawIssuer, cert.SerialNumber.String())]
+}
+
+// verifyPeerCertificate is used as tls.Config.VerifyPeerCertificate
+func (l *revocationList) verifyPeerCertificate(_ [][]byte, verifiedChains [][]*x509.Certificate) error {
+	if len(verifiedChains) == 0 || len(verifiedChains[0]) == 0 {
+		return nil
+	}
+	if cert := verifiedChains[0][0]; l.isRevoked(cert) {
+		l.reject(cert, "TLS handshake")
+		return errCertificateRevoked
+	}
+	return nil
+}
+
+func (l *revocationList) UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := l.checkPeer(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (l *revocationList) StreamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := l.checkPeer(stream.Context()); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+// checkPeer rejects calls of clients whose certificate was revoked after connection was established
+func (l *revocationList) checkPeer(ctx context.Context) error {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	if cert := tlsInfo.State.VerifiedChains[0][0]; l.isRevoked(cert) {
+		revokedRejected.Inc()
+		return status.Error(codes.Unauthenticated, errCertificateRevoked.Error())
+	}
+	return nil
+}
+
+// reject records rejected handshake, calls are recorded by audit interceptor
+func (l *revocationList) reject(cert *x509.Certificate, method string) {
+	revokedRejected.Inc()
+	log.Printf("[api] revoked certificate rejected: %v, serial: %v", cert.Subject, cert.SerialNumber)
+	if l.audit != nil {
+		roles, _ := RolesFromChains([][]*x509.Certificate{{cert}})
+		l.audit.Log(&AuditRecord{
+			Time:    time.Now().UTC(),
+			Subject: cert.Subject.String(),
+			Roles:   roles,
+			Method:  method,
+			Code:    codes.Unauthenticated.String(),
+			Message: errCertificateRevoked.Error(),
+		})
+	}
+}
+
+// readCRLFile reads PEM or DER encoded CRLs, every CRL must be signed by one of CA certificates
+func readCRLFile(crlFile string, caFile string) (map[string]bool, error) {
+	data, err := os.ReadFile(crlFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CRL file: %w", err)
+	}
+	cas, err := readCertificates(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var ders [][]byte
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type == "X509 CRL" {
+			ders = append(ders, block.Bytes)
+		}
+	}
+	if len(ders) == 0 {
+		ders = [][]byte{data}
+	}
+
+	revoked := map[string]bool{}
+	for _, der := range ders {
+		crl, err := x509.ParseRevocationList(der)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CRL: %w", err)
+		}
+		if err := checkCRLSignature(crl, cas); err != nil {
+			return nil, err
+		}
+		if !crl.NextUpdate.IsZero() && crl.NextUpdate.Before(time.Now()) {
+			log.Printf("[api] CRL of %v is outdated, next update was expected at %v", crl.Issuer, crl.NextUpdate)
+		}
+		for _, entry := range crl.RevokedCertificateEntries {
+			revoked[revocationKey(crl.RawIssuer, entry.SerialNumber.String())] = true
+		}
+	}
+	return revoked, nil
+}
+
+func checkCRLSignature(crl *x509.RevocationList, cas []*x509.Certificate) error {
+	for _, ca := range cas {
+		if crl.CheckSignatureFrom(ca) == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("CRL of %v is not signed by trusted CA", crl.Issuer)
+}
+
+func readCertificates(filename string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %w", err)
+	}
+
+	var certs []*x509.Certificate
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CA certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+func revocationKey(rawIssuer []byte, serial string) string {
+	return string(rawIssuer) + "/" + serial
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, dir string) (*testCA, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	caFile := filepath.Join(dir, "ca.pem")
+	assert.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	return &testCA{cert: cert, key: key}, caFile
+}
+
+func (ca *testCA) issue(t *testing.T, serial int64, commonName string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return cert
+}
+
+func (ca *testCA) writeCRL(t *testing.T, filename string, serials ...int64) {
+	var entries []x509.RevocationListEntry
+	for _, serial := range serials {
+		entries = append(entries, x509.RevocationListEntry{SerialNumber: big.NewInt(serial), RevocationTime: time.Now()})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(time.Now().UnixNano()),
+		ThisUpdate:                time.Now(),
+		NextUpdate:                time.Now().Add(time.Hour),
+		RevokedCertificateEntries: entries,
+	}, ca.cert, ca.key)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filename, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), 0600))
+}
+
+func peerContext(cert *x509.Certificate) context.Context {
+	return peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}},
+	})
+}
+
+func TestRevokedCertificate(t *testing.T) {
+	dir := t.TempDir()
+	ca, caFile := newTestCA(t, dir)
+	crlFile := filepath.Join(dir, "crl.pem")
+	ca.writeCRL(t, crlFile, 2)
+
+	auditFile := filepath.Join(dir, "audit.log")
+	audit, err := NewAuditLogger(auditFile, 1, 1)
+	assert.NoError(t, err)
+
+	crl, err := newRevocationList(&Configuration{CAFile: caFile, CRLFile: crlFile}, audit)
+	assert.NoError(t, err)
+
+	valid := ca.issue(t, 3, "valid")
+	revoked := ca.issue(t, 2, "revoked")
+	rejectedBefore := revokedRejected.Value()
+
+	assert.NoError(t, crl.verifyPeerCertificate(nil, [][]*x509.Certificate{{valid, ca.cert}}))
+	assert.ErrorIs(t, crl.verifyPeerCertificate(nil, [][]*x509.Certificate{{revoked, ca.cert}}), errCertificateRevoked)
+
+	assert.NoError(t, crl.checkPeer(peerContext(valid)))
+	assert.Equal(t, codes.Unauthenticated, status.Code(crl.checkPeer(peerContext(revoked))))
+	assert.Equal(t, rejectedBefore+2, revokedRejected.Value())
+
+	// certificate revoked after connection was established
+	ca.writeCRL(t, crlFile, 2, 3)
+	assert.NoError(t, crl.load(&Configuration{CAFile: caFile, CRLFile: crlFile}))
+	assert.Equal(t, codes.Unauthenticated, status.Code(crl.checkPeer(peerContext(valid))))
+
+	assert.NoError(t, audit.Close())
+	data, err := os.ReadFile(auditFile)
+	assert.NoError(t, err)
+	var rec AuditRecord
+	assert.NoError(t, json.Unmarshal(data, &rec))
+	assert.Equal(t, "CN=revoked", rec.Subject)
+	assert.Equal(t, "Unauthenticated", rec.Code)
+	assert.Equal(t, "certificate is revoked", rec.Message)
+}
+
+func TestCRLSignedByUnknownCA(t *testing.T) {
+	dir := t.TempDir()
+	_, caFile := newTestCA(t, dir)
+	other, _ := newTestCA(t, t.TempDir())
+	crlFile := filepath.Join(dir, "crl.pem")
+	other.writeCRL(t, crlFile, 2)
+
+	_, err := newRevocationList(&Configuration{CAFile: caFile, CRLFile: crlFile}, nil)
+	assert.Error(t, err)
+}
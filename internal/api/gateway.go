@@ -0,0 +1,455 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	workerservicepb "github.com/supby/job-worker/generated/proto"
+	"github.com/supby/job-worker/internal/workerlib"
+	"github.com/supby/job-worker/internal/workerlib/job"
+	"golang.org/x/net/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// maxRequestBodySize limits size of JSON request bodies accepted by gateway
+const maxRequestBodySize = 1 << 20
+
+// Gateway serves REST API on top of WorkerServer. Requests go through the same
+// validation, role checks and interceptors as their GRPC counterparts.
+type Gateway struct {
+	server      *WorkerServer
+	mux         *http.ServeMux
+	interceptor grpc.UnaryServerInterceptor
+
+	// AllowedOrigins are origins of web pages which can attach to jobs over
+	// WebSocket besides the gateway's own origin, e.g. "https://console.example.com"
+	AllowedOrigins []string
+}
+
+// NewGateway creates gateway, given interceptors run before authorization
+func NewGateway(server *WorkerServer, interceptors ...grpc.UnaryServerInterceptor) *Gateway {
+	g := &Gateway{
+		server:      server,
+		mux:         http.NewServeMux(),
+		interceptor: chainUnaryInterceptors(append(interceptors, UnaryAuthInterceptor)),
+	}
+
+	g.mux.HandleFunc("POST /jobs", g.startJob)
+	g.mux.HandleFunc("GET /jobs", g.listJobs)
+	g.mux.HandleFunc("GET /jobs/{id}", g.queryStatus)
+	g.mux.HandleFunc("DELETE /jobs/{id}", g.stopJob)
+	g.mux.HandleFunc("POST /jobs/{id}/pause", g.pauseJob)
+	g.mux.HandleFunc("POST /jobs/{id}/resume", g.resumeJob)
+	g.mux.HandleFunc("GET /jobs/{id}/output", g.getOutput)
+	g.mux.HandleFunc("GET /jobs/{id}/attach", g.attachJob)
+
+	return g
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mux.ServeHTTP(w, r)
+}
+
+// invoke runs handler through interceptors as GRPC method, caller identity is
+// taken from client certificate of HTTP request
+func (g *Gateway) invoke(r *http.Request, method string, req interface{}, handler grpc.UnaryHandler) (interface{}, error) {
+	if r.TLS == nil {
+		return nil, status.Error(codes.Unauthenticated, "TLS connection is required")
+	}
+
+	addr, _ := net.ResolveTCPAddr("tcp", r.RemoteAddr)
+	ctx := peer.NewContext(r.Context(), &peer.Peer{
+		Addr:     addr,
+		AuthInfo: credentials.TLSInfo{State: *r.TLS},
+	})
+
+	info := &grpc.UnaryServerInfo{Server: g.server, FullMethod: method}
+	return g.interceptor(ctx, req, info, handler)
+}
+
+func (g *Gateway) startJob(w http.ResponseWriter, r *http.Request) {
+	req := &workerservicepb.StartRequest{}
+	if err := readJSON(r, req); err != nil {
+		writeError(w, status.Error(codes.InvalidArgument, "invalid request body"))
+		return
+	}
+
+	res, err := g.invoke(r, "/workerservice.WorkerService/Start", req, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return g.server.Start(ctx, req.(*workerservicepb.StartRequest))
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, res.(proto.Message))
+}
+
+func (g *Gateway) listJobs(w http.ResponseWriter, r *http.Request) {
+	req := &workerservicepb.ListRequest{Selector: r.URL.Query().Get("selector")}
+	res, err := g.invoke(r, "/workerservice.WorkerService/List", req, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return g.server.List(ctx, req.(*workerservicepb.ListRequest))
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res.(proto.Message))
+}
+
+func (g *Gateway) queryStatus(w http.ResponseWriter, r *http.Request) {
+	req := &workerservicepb.QueryStatusRequest{JobId: r.PathValue("id")}
+	res, err := g.invoke(r, "/workerservice.WorkerService/QueryStatus", req, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return g.server.QueryStatus(ctx, req.(*workerservicepb.QueryStatusRequest))
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res.(proto.Message))
+}
+
+func (g *Gateway) stopJob(w http.ResponseWriter, r *http.Request) {
+	req := &workerservicepb.StopRequest{JobId: r.PathValue("id")}
+	res, err := g.invoke(r, "/workerservice.WorkerService/Stop", req, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return g.server.Stop(ctx, req.(*workerservicepb.StopRequest))
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res.(proto.Message))
+}
+
+func (g *Gateway) pauseJob(w http.ResponseWriter, r *http.Request) {
+	req := &workerservicepb.PauseRequest{JobId: r.PathValue("id")}
+	res, err := g.invoke(r, "/workerservice.WorkerService/Pause", req, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return g.server.Pause(ctx, req.(*workerservicepb.PauseRequest))
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res.(proto.Message))
+}
+
+func (g *Gateway) resumeJob(w http.ResponseWriter, r *http.Request) {
+	req := &workerservicepb.ResumeRequest{JobId: r.PathValue("id")}
+	res, err := g.invoke(r, "/workerservice.WorkerService/Resume", req, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return g.server.Resume(ctx, req.(*workerservicepb.ResumeRequest))
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res.(proto.Message))
+}
+
+// getOutput streams job output as chunked plain text or as Server-Sent Events
+// when client accepts text/event-stream. Stream can be resumed with offset query
+// parameter or, for SSE, with Last-Event-ID header.
+func (g *Gateway) getOutput(w http.ResponseWriter, r *http.Request) {
+	sse := strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+
+	offsetParam := r.URL.Query().Get("offset")
+	if lastEventID := r.Header.Get("Last-Event-ID"); sse && lastEventID != "" {
+		offsetParam = lastEventID
+	}
+	req := &workerservicepb.GetOutputRequest{JobId: r.PathValue("id")}
+	if offsetParam != "" {
+		offset, err := strconv.ParseInt(offsetParam, 10, 64)
+		if err != nil {
+			writeError(w, status.Error(codes.InvalidArgument, "invalid output offset"))
+			return
+		}
+		req.Offset = offset
+	}
+
+	streaming := false
+	_, err := g.invoke(r, "/workerservice.WorkerService/GetOutput", req, func(ctx context.Context, _ interface{}) (interface{}, error) {
+		jobID, err := g.server.getJobID(nil, req.JobId)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid job ID")
+		}
+		if req.Offset < 0 {
+			return nil, status.Error(codes.InvalidArgument, "invalid output offset")
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			return nil, status.Error(codes.Internal, "streaming is not supported")
+		}
+
+		logChan, err := g.server.Worker.GetStreamFrom(ctx, jobID, req.Offset)
+		if err != nil {
+			if errors.Is(err, workerlib.ErrJobNotFound) {
+				return nil, status.Error(codes.NotFound, "job not found")
+			}
+			log.Printf("[gateway] failed to get stream for job %v: %v", jobID, err)
+			return nil, status.Error(codes.Internal, "failed to get job output stream")
+		}
+
+		if sse {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+		} else {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+		streaming = true
+
+		outputStreams.Inc("http")
+		defer outputStreams.Dec("http")
+
+		offset := req.Offset
+		for {
+			select {
+			case <-ctx.Done():
+				return nil, status.FromContextError(ctx.Err()).Err()
+			case <-g.server.closing:
+				if sse {
+					fmt.Fprintf(w, "event: error\ndata: %s\n\n", g.server.closeMessage)
+					flusher.Flush()
+				}
+				return nil, g.server.streamsClosedError()
+			case logData, ok := <-logChan:
+				if !ok {
+					return nil, nil
+				}
+				offset += int64(len(logData))
+				if sse {
+					err = writeEvent(w, offset, logData)
+				} else {
+					_, err = w.Write(logData)
+				}
+				if err != nil {
+					log.Printf("[gateway] failed to send output for job %v: %v", jobID, err)
+					return nil, status.Error(codes.Internal, "failed to send job output")
+				}
+				flusher.Flush()
+			}
+		}
+	})
+	if err != nil && !streaming {
+		writeError(w, err)
+	}
+}
+
+// attachJob upgrades connection to WebSocket, messages received from client are
+// written to job's stdin and job output is sent back as binary messages.
+func (g *Gateway) attachJob(w http.ResponseWriter, r *http.Request) {
+	req := &workerservicepb.AttachRequest{JobId: r.PathValue("id")}
+	upgraded := false
+	_, err := g.invoke(r, "/workerservice.WorkerService/Attach", req, func(ctx context.Context, _ interface{}) (interface{}, error) {
+		if err := g.checkOrigin(r); err != nil {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		jobID, err := g.server.getJobID(nil, req.JobId)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid job ID")
+		}
+
+		input, err := g.server.Worker.GetInput(ctx, jobID)
+		if err != nil {
+			if errors.Is(err, workerlib.ErrJobNotFound) {
+				return nil, status.Error(codes.NotFound, "job not found")
+			}
+			if errors.Is(err, job.ErrNoInput) {
+				return nil, status.Error(codes.FailedPrecondition, "job is not interactive")
+			}
+			log.Printf("[gateway] failed to get input for job %v: %v", jobID, err)
+			return nil, status.Error(codes.Internal, "failed to attach to job")
+		}
+
+		upgraded = true
+		ws := websocket.Server{
+			// origin is checked above
+			Handshake: func(*websocket.Config, *http.Request) error { return nil },
+			Handler: func(conn *websocket.Conn) {
+				g.forwardWebSocket(conn, jobID, input)
+			},
+		}
+		ws.ServeHTTP(w, r)
+		return nil, nil
+	})
+	if err != nil && !upgraded {
+		writeError(w, err)
+	}
+}
+
+// checkOrigin rejects WebSocket requests of other web pages. Browsers send client
+// certificates with cross-site requests too, so without the check any page visited
+// by operator could write to stdin of jobs (cross-site WebSocket hijacking).
+func (g *Gateway) checkOrigin(r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return errors.New("origin header is required")
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid origin %q", origin)
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if strings.EqualFold(u.Scheme, scheme) && strings.EqualFold(u.Host, r.Host) {
+		return nil
+	}
+	for _, allowed := range g.AllowedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), strings.TrimSuffix(origin, "/")) {
+			return nil
+		}
+	}
+	return fmt.Errorf("origin %q is not allowed", origin)
+}
+
+func (g *Gateway) forwardWebSocket(conn *websocket.Conn, jobID uuid.UUID, input io.Writer) {
+	defer conn.Close()
+	conn.PayloadType = websocket.BinaryFrame
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logChan, err := g.server.Worker.GetStreamFrom(ctx, jobID, 0)
+	if err != nil {
+		log.Printf("[gateway] failed to get stream for job %v: %v", jobID, err)
+		return
+	}
+
+	outputStreams.Inc("websocket")
+	defer outputStreams.Dec("websocket")
+
+	go func() {
+		defer cancel()
+		var msg []byte
+		for {
+			if err := websocket.Message.Receive(conn, &msg); err != nil {
+				return
+			}
+			if _, err := input.Write(msg); err != nil {
+				log.Printf("[gateway] failed to write input for job %v: %v", jobID, err)
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-g.server.closing:
+			return
+		case logData, ok := <-logChan:
+			if !ok {
+				return
+			}
+			if err := websocket.Message.Send(conn, logData); err != nil {
+				log.Printf("[gateway] failed to send output for job %v: %v", jobID, err)
+				return
+			}
+		}
+	}
+}
+
+// chainUnaryInterceptors combines interceptors into one, the first one is outermost
+func chainUnaryInterceptors(interceptors []grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		next := handler
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, h := interceptors[i], next
+			next = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return interceptor(ctx, req, info, h)
+			}
+		}
+		return next(ctx, req)
+	}
+}
+
+// writeEvent writes one SSE event, its id is the offset following the data. Data
+// is base64 encoded, SSE lines can't carry partial lines and carriage returns.
+func writeEvent(w io.Writer, offset int64, data []byte) error {
+	_, err := fmt.Fprintf(w, "id: %d\ndata: %s\n\n", offset, base64.StdEncoding.EncodeToString(data))
+	return err
+}
+
+func readJSON(r *http.Request, m proto.Message) error {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBodySize))
+	if err != nil {
+		return err
+	}
+	return protojson.Unmarshal(data, m)
+}
+
+func writeJSON(w http.ResponseWriter, code int, m proto.Message) {
+	data, err := protojson.Marshal(m)
+	if err != nil {
+		log.Printf("[gateway] failed to marshal response: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(data)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	if delay, ok := retryDelay(st); ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatusFromCode(st.Code()))
+	json.NewEncoder(w).Encode(struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}{st.Code().String(), st.Message()})
+}
+
+func httpStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists:
+		return http.StatusConflict
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.FailedPrecondition:
+		return http.StatusPreconditionFailed
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.Canceled:
+		return 499
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/supby/job-worker/internal/workerlib"
+)
+
+func newTestRequest(method, target, body string, roles string) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	cert := &x509.Certificate{
+		Extensions: []pkix.Extension{{Id: asn1.ObjectIdentifier{1, 2, 840, 10070, 8, 1}, Value: []byte(roles)}},
+	}
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	return r
+}
+
+func TestGatewayStartAndQuery(t *testing.T) {
+	g := NewGateway(NewWorkerServer(workerlib.New()))
+
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, newTestRequest("POST", "/jobs", `{"commandName": "sleep", "arguments": ["1"]}`, "full"))
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var res struct {
+		JobID string `json:"jobId"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.NotEmpty(t, res.JobID)
+
+	w = httptest.NewRecorder()
+	g.ServeHTTP(w, newTestRequest("GET", "/jobs/"+res.JobID, "", "read"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "RUNNING")
+
+	w = httptest.NewRecorder()
+	g.ServeHTTP(w, newTestRequest("DELETE", "/jobs/"+res.JobID, "", "full"))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestGatewayListBySelector(t *testing.T) {
+	g := NewGateway(NewWorkerServer(workerlib.New()))
+
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, newTestRequest("POST", "/jobs", `{"commandName": "sleep", "arguments": ["1"], "labels": {"pipeline": "build"}}`, "full"))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = httptest.NewRecorder()
+	g.ServeHTTP(w, newTestRequest("POST", "/jobs", `{"commandName": "sleep", "arguments": ["1"], "labels": {"pipeline": "test"}}`, "full"))
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = httptest.NewRecorder()
+	g.ServeHTTP(w, newTestRequest("GET", "/jobs?selector=pipeline%3Dbuild", "", "read"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var res struct {
+		Jobs []struct {
+			Status struct {
+				Labels map[string]string `json:"labels"`
+			} `json:"status"`
+		} `json:"jobs"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Len(t, res.Jobs, 1)
+	assert.Equal(t, map[string]string{"pipeline": "build"}, res.Jobs[0].Status.Labels)
+
+	w = httptest.NewRecorder()
+	g.ServeHTTP(w, newTestRequest("GET", "/jobs?selector=pipeline+in+build", "", "read"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestWriteEvent(t *testing.T) {
+	var sb strings.Builder
+	var offset int64
+	chunks := []string{"progress: 10%\rprogress: 20%", "\r", "\ndone\n", "no newline"}
+	for _, chunk := range chunks {
+		offset += int64(len(chunk))
+		assert.NoError(t, writeEvent(&sb, offset, []byte(chunk)))
+	}
+
+	// client joining data of events gets output byte for byte
+	var output string
+	events := strings.Split(strings.TrimSuffix(sb.String(), "\n\n"), "\n\n")
+	assert.Len(t, events, len(chunks))
+	for _, event := range events {
+		lines := strings.Split(event, "\n")
+		assert.Len(t, lines, 2)
+		assert.True(t, strings.HasPrefix(lines[0], "id: "))
+		data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(lines[1], "data: "))
+		assert.NoError(t, err)
+		output += string(data)
+	}
+	assert.Equal(t, strings.Join(chunks, ""), output)
+	assert.True(t, strings.HasPrefix(events[len(events)-1], "id: 44\n"))
+}
+
+func TestGatewayPermissionDenied(t *testing.T) {
+	g := NewGateway(NewWorkerServer(workerlib.New()))
+
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, newTestRequest("POST", "/jobs", `{"commandName": "ls"}`, "read"))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestGatewayUnauthenticated(t *testing.T) {
+	g := NewGateway(NewWorkerServer(workerlib.New()))
+
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest("GET", "/jobs/"+uuid.NewString(), nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestGatewayErrors(t *testing.T) {
+	g := NewGateway(NewWorkerServer(workerlib.New()))
+
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, newTestRequest("GET", "/jobs/not-a-uuid", "", "read"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	g.ServeHTTP(w, newTestRequest("GET", "/jobs/"+uuid.NewString()+"/output", "", "read"))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	g.ServeHTTP(w, newTestRequest("POST", "/jobs", `{"commandName": ""}`, "full"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestGatewayAttachOrigin(t *testing.T) {
+	g := NewGateway(NewWorkerServer(workerlib.New()))
+	g.AllowedOrigins = []string{"https://console.example.com"}
+	target := "/jobs/8d7c2a9e-4e40-4a4b-9d5b-0c1f1f2b6a11/attach"
+
+	for origin, code := range map[string]int{
+		"":                            http.StatusForbidden,
+		"null":                        http.StatusForbidden,
+		"https://evil.example.org":    http.StatusForbidden,
+		"http://example.com":          http.StatusForbidden,
+		"https://example.com":         http.StatusNotFound,
+		"https://console.example.com": http.StatusNotFound,
+	} {
+		r := newTestRequest("GET", target, "", "attach")
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, r)
+		assert.Equal(t, code, w.Code, origin)
+	}
+}
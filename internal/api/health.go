@@ -0,0 +1,37 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/supby/job-worker/internal/workerlib"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// healthCheckInterval is how often worker saturation is reflected in health status
+const healthCheckInterval = time.Second
+
+// workerServiceName is service name reported by health service
+const workerServiceName = "workerservice.WorkerService"
+
+// watchHealth reports NOT_SERVING while worker is saturated, until ctx is done
+func watchHealth(ctx context.Context, hs *health.Server, worker workerlib.Worker) {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		servingStatus := healthpb.HealthCheckResponse_SERVING
+		if worker.Saturated() {
+			servingStatus = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		hs.SetServingStatus("", servingStatus)
+		hs.SetServingStatus(workerServiceName, servingStatus)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/supby/job-worker/internal/workerlib"
+	"github.com/supby/job-worker/internal/workerlib/job"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func servingStatus(t *testing.T, hs *health.Server) healthpb.HealthCheckResponse_ServingStatus {
+	res, err := hs.Check(context.Background(), &healthpb.HealthCheckRequest{Service: workerServiceName})
+	assert.NoError(t, err)
+	return res.GetStatus()
+}
+
+func TestHealthReflectsWorker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	worker := workerlib.New(workerlib.WithMaxRunningJobs(1))
+	jobID, err := worker.Start(ctx, job.Command{Name: "sleep", Arguments: []string{"10"}})
+	assert.NoError(t, err)
+
+	hs := health.NewServer()
+	go watchHealth(ctx, hs, worker)
+
+	// saturated worker
+	assert.Eventually(t, func() bool {
+		return servingStatus(t, hs) == healthpb.HealthCheckResponse_NOT_SERVING
+	}, time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, worker.Stop(ctx, jobID))
+	assert.Eventually(t, func() bool {
+		return servingStatus(t, hs) == healthpb.HealthCheckResponse_SERVING
+	}, 3*healthCheckInterval, 10*time.Millisecond)
+
+	// shutdown of the server
+	hs.Shutdown()
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, servingStatus(t, hs))
+	time.Sleep(healthCheckInterval + 100*time.Millisecond)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, servingStatus(t, hs))
+}
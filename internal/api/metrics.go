@@ -0,0 +1,9 @@
+package api
+
+import "github.com/supby/job-worker/internal/metrics"
+
+var (
+	rpcRequests   = metrics.NewCounter("jobworker_grpc_requests_total", "Number of handled GRPC requests.", "method", "code")
+	rpcDuration   = metrics.NewHistogram("jobworker_grpc_request_duration_seconds", "GRPC request latency.", metrics.DefaultBuckets, "method")
+	outputStreams = metrics.NewGauge("jobworker_output_streams_active", "Number of active job output streams.", "transport")
+)
@@ -0,0 +1,27 @@
+package api
+
+import (
+	"net"
+	"syscall"
+)
+
+// getPeerCred returns credentials of process connected to unix socket
+func getPeerCred(conn *net.UnixConn) (uint32, uint32, int32, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	var cred *syscall.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if credErr != nil {
+		return 0, 0, 0, credErr
+	}
+	return cred.Uid, cred.Gid, cred.Pid, nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package api
+
+import (
+	"errors"
+	"net"
+)
+
+// getPeerCred is supported on linux only
+func getPeerCred(conn *net.UnixConn) (uint32, uint32, int32, error) {
+	return 0, 0, 0, errors.New("SO_PEERCRED is not supported on this platform")
+}
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"crypto/x509"
+	"errors"
 	"strconv"
 	"strings"
 )
@@ -8,15 +10,45 @@ import (
 // oidRole oid identifier used to store user roles
 const oidRole string = "1.2.840.10070.8.1"
 
-// permissions
+// permissions, keyed by full GRPC method name
 var permissions = map[string][]string{
-	"/WorkerService/Start":  {"full"},
-	"/WorkerService/Stop":   {"full"},
-	"/WorkerService/Query":  {"full", "read"},
-	"/WorkerService/Stream": {"full", "read"},
+	"/workerservice.WorkerService/Start":             {"full"},
+	"/workerservice.WorkerService/StartFromTemplate": {"full"},
+	"/workerservice.WorkerService/Stop":              {"full"},
+	"/workerservice.WorkerService/Pause":             {"full"},
+	"/workerservice.WorkerService/Resume":            {"full"},
+	"/workerservice.WorkerService/QueryStatus":       {"full", "read"},
+	"/workerservice.WorkerService/GetOutput":         {"full", "read"},
+	"/workerservice.WorkerService/List":              {"full", "read"},
+	"/workerservice.WorkerService/Attach":            {"attach"},
+	"/workerservice.WorkerService/StopJobs":          {"full"},
+	"/workerservice.WorkerService/DeleteJobs":        {"full"},
+
+	"/workerservice.WorkerService/CreateSchedule": {"full"},
+	"/workerservice.WorkerService/ListSchedules":  {"full", "read"},
+	"/workerservice.WorkerService/DeleteSchedule": {"full"},
+	"/workerservice.WorkerService/PauseSchedule":  {"full"},
+
+	"/workerservice.WorkerService/SubmitWorkflow": {"full"},
+	"/workerservice.WorkerService/GetWorkflow":    {"full", "read"},
+	"/workerservice.WorkerService/ListWorkflows":  {"full", "read"},
+	"/workerservice.WorkerService/CancelWorkflow": {"full"},
+
+	// server reflection
+	"/grpc.reflection.v1.ServerReflection/ServerReflectionInfo":      {"full", "read"},
+	"/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo": {"full", "read"},
+}
+
+// publicMethods are available to any authenticated client regardless of roles
+var publicMethods = map[string]bool{
+	"/grpc.health.v1.Health/Check": true,
+	"/grpc.health.v1.Health/Watch": true,
 }
 
 func HasPermission(method string, roles []string) bool {
+	if publicMethods[method] {
+		return true
+	}
 	permission, ok := permissions[method]
 	if !ok {
 		return false
@@ -46,3 +78,19 @@ func OidToString(oid []int) string {
 	}
 	return strings.Join(strs, ".")
 }
+
+// RolesFromChains extracts client roles from leaf certificate of verified chain
+func RolesFromChains(chains [][]*x509.Certificate) ([]string, error) {
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		return nil, errors.New("missing certificate chain")
+	}
+
+	var roles []string
+	for _, ext := range chains[0][0].Extensions {
+		if oid := OidToString(ext.Id); IsOidRole(oid) {
+			roles = ParseRoles(string(ext.Value))
+			break
+		}
+	}
+	return roles, nil
+}
@@ -0,0 +1,20 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHasPermission(t *testing.T) {
+	assert.True(t, HasPermission("/workerservice.WorkerService/Start", []string{"full"}))
+	assert.False(t, HasPermission("/workerservice.WorkerService/Start", []string{"read"}))
+	assert.True(t, HasPermission("/workerservice.WorkerService/QueryStatus", []string{"read"}))
+	assert.False(t, HasPermission("/workerservice.WorkerService/Attach", []string{"full"}))
+	assert.False(t, HasPermission("/unknown/Method", []string{"full"}))
+}
+
+func TestHealthIsPublic(t *testing.T) {
+	assert.True(t, HasPermission("/grpc.health.v1.Health/Check", nil))
+	assert.True(t, HasPermission("/grpc.health.v1.Health/Watch", nil))
+}
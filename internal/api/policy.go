@@ -0,0 +1,60 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/supby/job-worker/internal/metrics"
+	"github.com/supby/job-worker/internal/policy"
+	"github.com/supby/job-worker/internal/workerlib/job"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var policyDenied = metrics.NewCounter("jobworker_policy_denied_total", "Number of commands denied by start policy.")
+
+// SetPolicy applies start policy of configuration, it is called again on reload
+func (s *WorkerServer) SetPolicy(conf *Configuration) error {
+	p, err := policy.New(conf.Policy)
+	if err != nil {
+		return err
+	}
+	s.policy.Store(p)
+	return nil
+}
+
+// checkPolicy evaluates start policy for command started by client, it is done
+// before command is started, scheduled or submitted in workflow
+func (s *WorkerServer) checkPolicy(ctx context.Context, command job.Command) error {
+	subject, roles := callerIdentity(ctx)
+	return s.checkPolicyFor(subject, roles, command)
+}
+
+// authorizeStart checks job which schedule or workflow starts on behalf of client
+// which created it, so that policy and TemplatesOnly changed by reload apply to it
+func (s *WorkerServer) authorizeStart(command job.Command, owner string, roles []string) error {
+	err := s.checkArbitraryCommandFor(roles)
+	if err == nil {
+		err = s.checkPolicyFor(owner, roles, command)
+	}
+	if err != nil {
+		return errors.New(status.Convert(err).Message())
+	}
+	return nil
+}
+
+func (s *WorkerServer) checkPolicyFor(subject string, roles []string, command job.Command) error {
+	decision := s.policy.Load().Evaluate(policy.Request{
+		Roles:     roles,
+		Command:   command.Name,
+		Arguments: command.Arguments,
+		Limits:    command.Limits,
+	})
+	if !decision.Allowed {
+		policyDenied.Inc()
+		log.Printf("[api] command %v of %q is %v", decision.Path, subject, decision)
+		return status.Error(codes.PermissionDenied, "command is "+decision.String())
+	}
+	return nil
+}
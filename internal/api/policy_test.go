@@ -0,0 +1,107 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	workerservicepb "github.com/supby/job-worker/generated/proto"
+	"github.com/supby/job-worker/internal/workerlib"
+	"github.com/supby/job-worker/internal/workerlib/job"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestStartPolicy(t *testing.T) {
+	config, err := readTestConfig(t, testTemplates+`
+policy:
+  default: deny
+  rules:
+    - name: no-recursive-rm
+      effect: deny
+      commands: ["rm"]
+      arguments: "(^| )-[a-zA-Z]*r"
+    - name: limited
+      effect: allow
+      roles: ["full"]
+      maxtimeout: 1m
+    - name: readers-ls
+      effect: allow
+      roles: ["read"]
+      commands: ["ls"]
+`)
+	assert.NoError(t, err)
+	worker := workerlib.New()
+	server := NewWorkerServer(worker)
+	server.SetTemplates(&config)
+	assert.NoError(t, server.SetPolicy(&config))
+
+	_, err = server.Start(rolesContext("full"), &workerservicepb.StartRequest{CommandName: "rm", Arguments: []string{"-rf", "/tmp/none"}, Limits: &workerservicepb.Limits{TimeoutMs: 1000}})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), `"no-recursive-rm"`)
+
+	_, err = server.Start(rolesContext("full"), &workerservicepb.StartRequest{CommandName: "true"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Equal(t, "command is denied by default policy", status.Convert(err).Message())
+
+	_, err = server.Start(rolesContext("full"), &workerservicepb.StartRequest{CommandName: "true", Limits: &workerservicepb.Limits{TimeoutMs: 1000}})
+	assert.NoError(t, err)
+
+	_, err = server.Start(rolesContext("read"), &workerservicepb.StartRequest{CommandName: "ls"})
+	assert.NoError(t, err)
+
+	// template job has 1m timeout
+	_, err = server.StartFromTemplate(rolesContext("full"), &workerservicepb.StartFromTemplateRequest{Template: "backup-db", Parameters: map[string]string{"database": "users"}})
+	assert.NoError(t, err)
+
+	server.Workflows = workerlib.NewWorkflowEngine(worker, nil)
+	defer server.Workflows.Close()
+	_, err = server.SubmitWorkflow(rolesContext("full"), &workerservicepb.SubmitWorkflowRequest{Nodes: []*workerservicepb.WorkflowNode{
+		{Name: "cleanup", Job: &workerservicepb.StartRequest{CommandName: "rm", Arguments: []string{"-r", "/tmp/none"}}},
+	}})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = readTestConfig(t, "policy:\n  rules:\n    - effect: sometimes\n")
+	assert.Error(t, err)
+}
+
+func TestPolicyAppliesToWorkflowSteps(t *testing.T) {
+	ctx := rolesContext("full")
+	worker := workerlib.New()
+	server := NewWorkerServer(worker)
+	server.Workflows = workerlib.NewWorkflowEngine(worker, server.authorizeStart)
+	defer server.Workflows.Close()
+
+	submitted, err := server.SubmitWorkflow(ctx, &workerservicepb.SubmitWorkflowRequest{Nodes: []*workerservicepb.WorkflowNode{
+		{Name: "build", Job: &workerservicepb.StartRequest{CommandName: "sleep", Arguments: []string{"0.3"}}},
+		{Name: "deploy", Job: &workerservicepb.StartRequest{CommandName: "true"}, DependsOn: []string{"build"}},
+	}})
+	assert.NoError(t, err)
+
+	// policy reloaded while the workflow is running
+	config, err := readTestConfig(t, "policy:\n  rules:\n    - name: no-deploy\n      effect: deny\n      commands: [\"true\"]\n")
+	assert.NoError(t, err)
+	assert.NoError(t, server.SetPolicy(&config))
+
+	var res *workerservicepb.GetWorkflowResponse
+	assert.Eventually(t, func() bool {
+		res, err = server.GetWorkflow(ctx, &workerservicepb.GetWorkflowRequest{WorkflowId: submitted.Workflow.WorkflowId})
+		return err == nil && res.Workflow.FinishedAt != ""
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, "failed", res.Workflow.State)
+	assert.Equal(t, "succeeded", res.Workflow.Nodes[0].State)
+	assert.Equal(t, "failed", res.Workflow.Nodes[1].State)
+	assert.Equal(t, `command is denied by policy rule "no-deploy"`, res.Workflow.Nodes[1].Error)
+	assert.Empty(t, res.Workflow.Nodes[1].JobId)
+}
+
+func TestAuthorizeStartTemplatesOnly(t *testing.T) {
+	config, err := readTestConfig(t, "templatesonly: true\n")
+	assert.NoError(t, err)
+	server := NewWorkerServer(workerlib.New())
+	server.SetTemplates(&config)
+
+	assert.EqualError(t, server.authorizeStart(job.Command{Name: "ls"}, "alice", []string{"full"}),
+		"arbitrary commands are disabled, use StartFromTemplate")
+	assert.NoError(t, server.authorizeStart(job.Command{Name: "ls"}, "alice", []string{"full", "admin"}))
+}
@@ -0,0 +1,222 @@
+package api
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/supby/job-worker/internal/workerlib"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// quotaRetryDelay is suggested to clients which exceeded running jobs quota
+const quotaRetryDelay = 5 * time.Second
+
+// bucketSweepInterval is how often buckets of idle clients are removed
+const bucketSweepInterval = time.Minute
+
+// RoleLimits configures limits of clients having the role, zero value of
+// a field means no limit
+type RoleLimits struct {
+	// RequestsPerSecond is rate of requests refilling client's token bucket
+	RequestsPerSecond float64
+	// Burst is size of client's token bucket, defaults to RequestsPerSecond
+	Burst int
+	// MaxRunningJobs is maximum number of running jobs started by client
+	MaxRunningJobs int
+}
+
+// RateLimiter enforces per client request rate limits and running jobs quotas.
+// Client is identified by subject of its certificate, when client has several
+// roles with limits the most permissive limits apply. Clients without any
+// configured role are not limited.
+type RateLimiter struct {
+	limits    map[string]RoleLimits
+	mtx       sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewRateLimiter(limits map[string]RoleLimits) *RateLimiter {
+	return &RateLimiter{
+		limits:  limits,
+		buckets: map[string]*tokenBucket{},
+		now:     time.Now,
+	}
+}
+
+func (l *RateLimiter) UnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := l.limit(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (l *RateLimiter) StreamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := l.limit(stream.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+// limit takes a token from caller's bucket
+func (l *RateLimiter) limit(ctx context.Context, method string) error {
+	if !isAudited(method) {
+		return nil
+	}
+
+	subject, roles := callerIdentity(ctx)
+	limits, ok := l.limitsFor(roles)
+	if !ok || limits.RequestsPerSecond <= 0 {
+		return nil
+	}
+	if wait := l.take(subject, limits); wait > 0 {
+		return resourceExhausted("rate limit exceeded", wait)
+	}
+	return nil
+}
+
+// quota returns running jobs quota of caller, nil limiter has no quotas
+func (l *RateLimiter) quota(ctx context.Context) (workerlib.Quota, bool) {
+	if l == nil {
+		return workerlib.Quota{}, false
+	}
+	subject, roles := callerIdentity(ctx)
+	limits, ok := l.limitsFor(roles)
+	if !ok || limits.MaxRunningJobs <= 0 {
+		return workerlib.Quota{}, false
+	}
+	return workerlib.Quota{Owner: subject, MaxRunningJobs: limits.MaxRunningJobs}, true
+}
+
+// SetLimits replaces limits, state of clients' token buckets is kept
+func (l *RateLimiter) SetLimits(limits map[string]RoleLimits) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.limits = limits
+}
+
+// limitsFor combines limits of roles, the most permissive value of every limit is taken
+func (l *RateLimiter) limitsFor(roles []string) (RoleLimits, bool) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	var res RoleLimits
+	found := false
+	for _, role := range roles {
+		limits, ok := l.limits[role]
+		if !ok {
+			continue
+		}
+		// zero burst isn't unlimited, it has to be resolved before merging
+		limits.Burst = limits.burst()
+		if !found {
+			res, found = limits, true
+			continue
+		}
+		res.RequestsPerSecond = mostPermissive(res.RequestsPerSecond, limits.RequestsPerSecond)
+		res.Burst = int(mostPermissive(float64(res.Burst), float64(limits.Burst)))
+		res.MaxRunningJobs = int(mostPermissive(float64(res.MaxRunningJobs), float64(limits.MaxRunningJobs)))
+	}
+	return res, found
+}
+
+// burst returns size of token bucket, it defaults to RequestsPerSecond
+func (l RoleLimits) burst() int {
+	if l.Burst > 0 || l.RequestsPerSecond <= 0 {
+		return l.Burst
+	}
+	return int(math.Max(1, math.Ceil(l.RequestsPerSecond)))
+}
+
+// mostPermissive returns larger limit, zero is no limit
+func mostPermissive(a, b float64) float64 {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return math.Max(a, b)
+}
+
+// take returns zero when request is allowed, otherwise time after which a token is available
+func (l *RateLimiter) take(subject string, limits RoleLimits) time.Duration {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	burst := float64(limits.burst())
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= bucketSweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[subject]
+	if !ok {
+		b = &tokenBucket{tokens: burst, last: now}
+		l.buckets[subject] = b
+	}
+	return b.take(limits.RequestsPerSecond, burst, now)
+}
+
+// sweep removes buckets which refilled completely, they are the same as buckets
+// of new clients, l.mtx has to be locked
+func (l *RateLimiter) sweep(now time.Time) {
+	l.lastSweep = now
+	for subject, b := range l.buckets {
+		if b.full(now) {
+			delete(l.buckets, subject)
+		}
+	}
+}
+
+// tokenBucket is refilled with rate tokens per second up to burst tokens
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	// rate and burst of the last take
+	rate  float64
+	burst float64
+}
+
+func (b *tokenBucket) take(rate float64, burst float64, now time.Time) time.Duration {
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	b.rate, b.burst = rate, burst
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / rate * float64(time.Second))
+}
+
+// full reports whether bucket refilled up to burst since the last take
+func (b *tokenBucket) full(now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.burst
+}
+
+// resourceExhausted creates RESOURCE_EXHAUSTED error with retry delay in details
+func resourceExhausted(msg string, retryDelay time.Duration) error {
+	st, err := status.New(codes.ResourceExhausted, msg).WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(retryDelay),
+	})
+	if err != nil {
+		return status.Error(codes.ResourceExhausted, msg)
+	}
+	return st.Err()
+}
+
+// retryDelay returns retry delay from error details
+func retryDelay(st *status.Status) (time.Duration, bool) {
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			return info.GetRetryDelay().AsDuration(), true
+		}
+	}
+	return 0, false
+}
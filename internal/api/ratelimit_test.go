@@ -0,0 +1,115 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/supby/job-worker/internal/workerlib"
+	"google.golang.org/grpc/status"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	b := &tokenBucket{tokens: 2, last: now}
+
+	assert.Zero(t, b.take(1, 2, now))
+	assert.Zero(t, b.take(1, 2, now))
+	assert.Equal(t, time.Second, b.take(1, 2, now))
+	assert.Zero(t, b.take(1, 2, now.Add(time.Second)))
+}
+
+func TestIdleBucketsEvicted(t *testing.T) {
+	l := NewRateLimiter(nil)
+	now := time.Now()
+	l.now = func() time.Time { return now }
+	limits := RoleLimits{RequestsPerSecond: 0.1, Burst: 10}
+
+	for i := 0; i < 10; i++ {
+		assert.Zero(t, l.take("alice", limits))
+	}
+	now = now.Add(bucketSweepInterval)
+	assert.Zero(t, l.take("bob", limits))
+	// alice's bucket has 6 tokens of 10 yet
+	assert.Len(t, l.buckets, 2)
+
+	now = now.Add(10 * time.Second)
+	assert.Zero(t, l.take("bob", limits))
+	assert.Len(t, l.buckets, 2)
+
+	now = now.Add(bucketSweepInterval)
+	assert.Zero(t, l.take("carol", limits))
+	assert.Len(t, l.buckets, 1)
+	assert.Contains(t, l.buckets, "carol")
+}
+
+func TestLimitsForRoles(t *testing.T) {
+	l := NewRateLimiter(map[string]RoleLimits{
+		"read": {RequestsPerSecond: 1, MaxRunningJobs: 2},
+		"full": {RequestsPerSecond: 10, MaxRunningJobs: 0},
+	})
+
+	_, ok := l.limitsFor([]string{"attach"})
+	assert.False(t, ok)
+
+	limits, ok := l.limitsFor([]string{"read", "full"})
+	assert.True(t, ok)
+	assert.Equal(t, float64(10), limits.RequestsPerSecond)
+	assert.Equal(t, 10, limits.Burst)
+	assert.Zero(t, limits.MaxRunningJobs)
+}
+
+func TestLimitsForRolesBurst(t *testing.T) {
+	l := NewRateLimiter(map[string]RoleLimits{
+		"read":  {RequestsPerSecond: 1},
+		"full":  {RequestsPerSecond: 2, Burst: 100},
+		"batch": {RequestsPerSecond: 2.5},
+	})
+
+	// default burst of one role doesn't restrict burst of the other
+	limits, ok := l.limitsFor([]string{"read", "full"})
+	assert.True(t, ok)
+	assert.Equal(t, 100, limits.Burst)
+
+	limits, ok = l.limitsFor([]string{"read", "batch"})
+	assert.True(t, ok)
+	assert.Equal(t, 3, limits.Burst)
+}
+
+func TestGatewayRateLimit(t *testing.T) {
+	limiter := NewRateLimiter(map[string]RoleLimits{"read": {RequestsPerSecond: 1}})
+	g := NewGateway(NewWorkerServer(workerlib.New()), limiter.UnaryInterceptor)
+
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, newTestRequest("GET", "/jobs/8d7c2a9e-4e40-4a4b-9d5b-0c1f1f2b6a11", "", "read"))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	g.ServeHTTP(w, newTestRequest("GET", "/jobs/8d7c2a9e-4e40-4a4b-9d5b-0c1f1f2b6a11", "", "read"))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+}
+
+func TestGatewayJobsQuota(t *testing.T) {
+	limiter := NewRateLimiter(map[string]RoleLimits{"full": {MaxRunningJobs: 1}})
+	server := NewWorkerServer(workerlib.New())
+	server.Limiter = limiter
+	g := NewGateway(server, limiter.UnaryInterceptor)
+
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, newTestRequest("POST", "/jobs", `{"commandName": "sleep", "arguments": ["5"]}`, "full"))
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = httptest.NewRecorder()
+	g.ServeHTTP(w, newTestRequest("POST", "/jobs", `{"commandName": "sleep", "arguments": ["5"]}`, "full"))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "5", w.Header().Get("Retry-After"))
+}
+
+func TestResourceExhaustedRetryInfo(t *testing.T) {
+	delay, ok := retryDelay(status.Convert(resourceExhausted("rate limit exceeded", 2*time.Second)))
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Second, delay)
+}
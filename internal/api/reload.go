@@ -0,0 +1,177 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/supby/job-worker/internal/policy"
+	"github.com/supby/job-worker/internal/workerlib"
+)
+
+// configCheckInterval is how often configuration and TLS files are checked for changes
+const configCheckInterval = 10 * time.Second
+
+// reloader re-reads configuration file and applies settings which can change
+// without restart: TLS and CRL files, unix socket roles, limits, maximum
+// number of running jobs, templates and start policy.
+type reloader struct {
+	config   Configuration
+	tls      *tlsReloader
+	peerCred *peerCredCredentials
+	crl      *revocationList
+	limiter  *RateLimiter
+	worker   workerlib.Worker
+	server   *WorkerServer
+}
+
+// watchConfig reloads configuration on SIGHUP and when configuration, TLS or CRL files change
+func (r *reloader) watchConfig(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(configCheckInterval)
+	defer ticker.Stop()
+
+	modTimes := r.modTimes()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			log.Println("[api] SIGHUP received, reloading configuration")
+		case <-ticker.C:
+			current := r.modTimes()
+			if equalModTimes(current, modTimes) {
+				continue
+			}
+			log.Println("[api] configuration files changed, reloading configuration")
+		}
+
+		if err := r.reload(); err != nil {
+			log.Printf("[api] failed to reload configuration, keeping previous one: %v", err)
+		}
+		modTimes = r.modTimes()
+	}
+}
+
+func (r *reloader) reload() error {
+	config := r.config
+	if config.configFile != "" {
+		var err error
+		config, err = ReadConfigFromYaml(config.configFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	// everything which can fail is loaded first, so that configuration is applied
+	// either completely or not at all
+	revoked, err := readRevocationList(&config)
+	if err != nil {
+		return err
+	}
+	var tlsConfig *tls.Config
+	if r.tls != nil {
+		if tlsConfig, err = loadTLSConfig(&config, r.tls.crl); err != nil {
+			return err
+		}
+	}
+	if err := validateTemplates(config.Templates); err != nil {
+		return err
+	}
+	startPolicy, err := policy.New(config.Policy)
+	if err != nil {
+		return err
+	}
+
+	r.crl.set(&config, revoked)
+	if r.tls != nil {
+		r.tls.current.Store(tlsConfig)
+	}
+	if r.peerCred != nil {
+		r.peerCred.setRoles(&config)
+	}
+	r.limiter.SetLimits(config.Limits)
+	r.worker.SetMaxRunningJobs(config.MaxRunningJobs)
+	if r.server != nil {
+		r.server.policy.Store(startPolicy)
+		r.server.SetTemplates(&config)
+	}
+
+	if changed := restartOnlyChanges(&r.config, &config); len(changed) > 0 {
+		log.Printf("[api] changes of %v are applied after restart only", strings.Join(changed, ", "))
+	}
+
+	r.config = config
+	log.Println("[api] configuration reloaded")
+	return nil
+}
+
+// restartOnlyChanges returns names of changed settings which can't be reloaded
+func restartOnlyChanges(prev, next *Configuration) []string {
+	var changed []string
+	for _, setting := range []struct {
+		name    string
+		changed bool
+	}{
+		{"endpoint", prev.Endpoint != next.Endpoint},
+		{"httpendpoint", prev.HTTPEndpoint != next.HTTPEndpoint},
+		{"allowedorigins", !slices.Equal(prev.AllowedOrigins, next.AllowedOrigins)},
+		{"metricsendpoint", prev.MetricsEndpoint != next.MetricsEndpoint},
+		{"reflection", prev.Reflection != next.Reflection},
+		{"auditfile", prev.AuditFile != next.AuditFile},
+		{"auditmaxsizemb", prev.AuditMaxSizeMB != next.AuditMaxSizeMB},
+		{"auditmaxbackups", prev.AuditMaxBackups != next.AuditMaxBackups},
+		{"maxqueuedjobs", prev.MaxQueuedJobs != next.MaxQueuedJobs},
+		{"queueaging", prev.QueueAging != next.QueueAging},
+		{"preemption", prev.Preemption != next.Preemption},
+		{"preemptiongraceperiod", prev.PreemptionGracePeriod != next.PreemptionGracePeriod},
+		{"crlreloadinterval", prev.CRLReloadInterval != next.CRLReloadInterval},
+		{"statedir", prev.StateDir != next.StateDir},
+		{"cgroupdir", prev.CgroupDir != next.CgroupDir},
+		{"shutdownmode", prev.ShutdownMode != next.ShutdownMode},
+		{"shutdowntimeout", prev.ShutdownTimeout != next.ShutdownTimeout},
+		{"socketmode", prev.SocketMode != next.SocketMode},
+		{"idempotencywindow", prev.IdempotencyWindow != next.IdempotencyWindow},
+	} {
+		if setting.changed {
+			changed = append(changed, setting.name)
+		}
+	}
+	return changed
+}
+
+// modTimes returns modification times of watched files
+func (r *reloader) modTimes() []time.Time {
+	files := []string{r.config.configFile, r.config.CAFile, r.config.ServerCertificateFile, r.config.ServerKeyFile, r.config.CRLFile}
+	res := make([]time.Time, len(files))
+	for i, file := range files {
+		if file == "" {
+			continue
+		}
+		if info, err := os.Stat(file); err == nil {
+			res[i] = info.ModTime()
+		}
+	}
+	return res
+}
+
+func equalModTimes(a, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/supby/job-worker/internal/workerlib"
+)
+
+// writeTestCertificates writes self-signed certificate with given common name,
+// it is used both as CA and server certificate
+func writeTestCertificates(t *testing.T, dir string, commonName string) *Configuration {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	conf := &Configuration{
+		CAFile:                filepath.Join(dir, "ca.pem"),
+		ServerCertificateFile: filepath.Join(dir, "server.crt"),
+		ServerKeyFile:         filepath.Join(dir, "server.key"),
+	}
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	assert.NoError(t, os.WriteFile(conf.CAFile, certPem, 0600))
+	assert.NoError(t, os.WriteFile(conf.ServerCertificateFile, certPem, 0600))
+	assert.NoError(t, os.WriteFile(conf.ServerKeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return conf
+}
+
+func serverCommonName(t *testing.T, config *tls.Config) string {
+	forClient, err := config.GetConfigForClient(&tls.ClientHelloInfo{})
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(forClient.Certificates[0].Certificate[0])
+	assert.NoError(t, err)
+	return cert.Subject.CommonName
+}
+
+func TestTLSReload(t *testing.T) {
+	dir := t.TempDir()
+	conf := writeTestCertificates(t, dir, "old")
+
+	r, err := newTLSReloader(conf, nil)
+	assert.NoError(t, err)
+	config := r.serverConfig("h2")
+	assert.Equal(t, "old", serverCommonName(t, config))
+
+	writeTestCertificates(t, dir, "new")
+	assert.NoError(t, r.reload(conf))
+	assert.Equal(t, "new", serverCommonName(t, config))
+
+	forClient, err := config.GetConfigForClient(&tls.ClientHelloInfo{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"h2"}, forClient.NextProtos)
+
+	// broken files keep previous certificate
+	assert.NoError(t, os.WriteFile(conf.ServerKeyFile, []byte("broken"), 0600))
+	assert.Error(t, r.reload(conf))
+	assert.Equal(t, "new", serverCommonName(t, config))
+}
+
+func TestReloadConfig(t *testing.T) {
+	dir := t.TempDir()
+	conf := writeTestCertificates(t, dir, "server")
+
+	configFile := filepath.Join(dir, "server_config.yaml")
+	assert.NoError(t, os.WriteFile(configFile, []byte(`
+cafile: "`+conf.CAFile+`"
+servercertificatefile: "`+conf.ServerCertificateFile+`"
+serverkeyfile: "`+conf.ServerKeyFile+`"
+`), 0600))
+	config, err := ReadConfigFromYaml(configFile)
+	assert.NoError(t, err)
+
+	crl, err := newRevocationList(&config, nil)
+	assert.NoError(t, err)
+	tlsReloader, err := newTLSReloader(&config, crl)
+	assert.NoError(t, err)
+	worker := workerlib.New()
+	limiter := NewRateLimiter(config.Limits)
+	r := &reloader{config: config, tls: tlsReloader, crl: crl, limiter: limiter, worker: worker}
+
+	assert.NoError(t, os.WriteFile(configFile, []byte(`
+cafile: "`+conf.CAFile+`"
+servercertificatefile: "`+conf.ServerCertificateFile+`"
+serverkeyfile: "`+conf.ServerKeyFile+`"
+maxrunningjobs: 1
+limits:
+  read:
+    requestspersecond: 2
+    maxrunningjobs: 3
+`), 0600))
+	assert.NoError(t, r.reload())
+
+	limits, ok := limiter.limitsFor([]string{"read"})
+	assert.True(t, ok)
+	assert.Equal(t, RoleLimits{RequestsPerSecond: 2, Burst: 2, MaxRunningJobs: 3}, limits)
+	assert.Equal(t, 1, r.config.MaxRunningJobs)
+
+	// nothing is applied when part of configuration can't be loaded
+	assert.NoError(t, os.WriteFile(configFile, []byte(`
+cafile: "`+conf.CAFile+`"
+servercertificatefile: "`+conf.ServerCertificateFile+`"
+serverkeyfile: "`+filepath.Join(dir, "missing.key")+`"
+maxrunningjobs: 2
+limits:
+  read:
+    requestspersecond: 5
+`), 0600))
+	assert.Error(t, r.reload())
+
+	limits, ok = limiter.limitsFor([]string{"read"})
+	assert.True(t, ok)
+	assert.Equal(t, RoleLimits{RequestsPerSecond: 2, Burst: 2, MaxRunningJobs: 3}, limits)
+	assert.Equal(t, 1, r.config.MaxRunningJobs)
+}
+
+func TestRestartOnlyChanges(t *testing.T) {
+	prev := &Configuration{Endpoint: "localhost:5001", StateDir: "/var/lib/jobworker", MaxRunningJobs: 1}
+	assert.Empty(t, restartOnlyChanges(prev, &Configuration{Endpoint: "localhost:5001", StateDir: "/var/lib/jobworker", MaxRunningJobs: 2}))
+
+	next := *prev
+	next.StateDir = ""
+	next.ShutdownMode = "detach"
+	next.IdempotencyWindow = time.Hour
+	next.CRLReloadInterval = time.Minute
+	assert.Equal(t, []string{"crlreloadinterval", "statedir", "shutdownmode", "idempotencywindow"}, restartOnlyChanges(prev, &next))
+}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	workerservicepb "github.com/supby/job-worker/generated/proto"
+	"github.com/supby/job-worker/internal/workerlib"
+	"github.com/supby/job-worker/internal/workerlib/job"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *WorkerServer) CreateSchedule(ctx context.Context, r *workerservicepb.CreateScheduleRequest) (*workerservicepb.CreateScheduleResponse, error) {
+	if s.Scheduler == nil {
+		return nil, status.Error(codes.Unimplemented, "scheduler is not enabled")
+	}
+	if err := s.checkArbitraryCommand(ctx); err != nil {
+		return nil, err
+	}
+	if r.Job == nil {
+		return nil, status.Error(codes.InvalidArgument, "job is required")
+	}
+	if r.Job.IdempotencyKey != "" {
+		return nil, status.Error(codes.InvalidArgument, "scheduled jobs can't have idempotency key")
+	}
+	if r.HistoryLimit < 0 {
+		return nil, status.Error(codes.InvalidArgument, "invalid history limit")
+	}
+	command, err := toCommand(r.Job)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkPolicy(ctx, command); err != nil {
+		return nil, err
+	}
+
+	owner, roles := callerIdentity(ctx)
+	spec := workerlib.ScheduleSpec{
+		Cron:         r.Cron,
+		TimeZone:     r.TimeZone,
+		Command:      command,
+		Concurrency:  workerlib.ConcurrencyPolicy(r.ConcurrencyPolicy),
+		HistoryLimit: int(r.HistoryLimit),
+		Owner:        owner,
+		Roles:        roles,
+	}
+	if quota, ok := s.Limiter.quota(ctx); ok {
+		spec.Quota = &quota
+	}
+	sc, err := s.Scheduler.CreateSchedule(ctx, spec)
+	if err != nil {
+		if errors.Is(err, workerlib.ErrShuttingDown) {
+			return nil, status.Error(codes.Unavailable, "server is shutting down")
+		}
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return &workerservicepb.CreateScheduleResponse{Schedule: toScheduleInfo(sc)}, nil
+}
+
+func (s *WorkerServer) ListSchedules(ctx context.Context, r *workerservicepb.ListSchedulesRequest) (*workerservicepb.ListSchedulesResponse, error) {
+	if s.Scheduler == nil {
+		return nil, status.Error(codes.Unimplemented, "scheduler is not enabled")
+	}
+	schedules, err := s.Scheduler.ListSchedules(ctx)
+	if err != nil {
+		log.Printf("[api] failed to list schedules: %v", err)
+		return nil, status.Error(codes.Internal, "failed to list schedules")
+	}
+
+	res := &workerservicepb.ListSchedulesResponse{}
+	for _, sc := range schedules {
+		res.Schedules = append(res.Schedules, toScheduleInfo(sc))
+	}
+	return res, nil
+}
+
+// DeleteSchedule stops firing of schedule, jobs started by it are kept
+func (s *WorkerServer) DeleteSchedule(ctx context.Context, r *workerservicepb.DeleteScheduleRequest) (*workerservicepb.DeleteScheduleResponse, error) {
+	if s.Scheduler == nil {
+		return nil, status.Error(codes.Unimplemented, "scheduler is not enabled")
+	}
+	id, err := uuid.Parse(r.ScheduleId)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid schedule ID")
+	}
+	if err := s.Scheduler.DeleteSchedule(ctx, id); err != nil {
+		return nil, scheduleError(id, err)
+	}
+	return &workerservicepb.DeleteScheduleResponse{}, nil
+}
+
+func (s *WorkerServer) PauseSchedule(ctx context.Context, r *workerservicepb.PauseScheduleRequest) (*workerservicepb.PauseScheduleResponse, error) {
+	if s.Scheduler == nil {
+		return nil, status.Error(codes.Unimplemented, "scheduler is not enabled")
+	}
+	id, err := uuid.Parse(r.ScheduleId)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid schedule ID")
+	}
+	if err := s.Scheduler.PauseSchedule(ctx, id, r.Paused); err != nil {
+		return nil, scheduleError(id, err)
+	}
+	return &workerservicepb.PauseScheduleResponse{}, nil
+}
+
+func scheduleError(id uuid.UUID, err error) error {
+	if errors.Is(err, workerlib.ErrScheduleNotFound) {
+		return status.Error(codes.NotFound, "schedule not found")
+	}
+	log.Printf("[api] failed to update schedule %v: %v", id, err)
+	return status.Error(codes.Internal, "failed to update schedule")
+}
+
+func toScheduleInfo(sc workerlib.Schedule) *workerservicepb.ScheduleInfo {
+	info := &workerservicepb.ScheduleInfo{
+		ScheduleId:        sc.ID.String(),
+		Cron:              sc.Spec.Cron,
+		TimeZone:          sc.Spec.TimeZone,
+		Job:               toStartRequest(sc.Spec.Command),
+		ConcurrencyPolicy: string(sc.Spec.Concurrency),
+		HistoryLimit:      int32(sc.Spec.HistoryLimit),
+		Paused:            sc.Paused,
+		NextRun:           formatTime(sc.NextRun),
+		LastRun:           formatTime(sc.LastRun),
+	}
+	if sc.LastJobID != job.NilJobId {
+		info.LastJobId = sc.LastJobID.String()
+	}
+	return info
+}
+
+// toStartRequest is reverse of toCommand
+func toStartRequest(command job.Command) *workerservicepb.StartRequest {
+	r := &workerservicepb.StartRequest{
+		CommandName: command.Name,
+		Arguments:   command.Arguments,
+		Labels:      command.Labels,
+		Priority:    int32(command.Priority),
+		Preemptible: command.Preemptible,
+	}
+	if p := command.Retry; p != nil {
+		r.Retry = &workerservicepb.RetryPolicy{
+			MaxAttempts:      int32(p.MaxAttempts),
+			InitialBackoffMs: p.InitialBackoff.Milliseconds(),
+			MaxBackoffMs:     p.MaxBackoff.Milliseconds(),
+			Jitter:           p.Jitter,
+		}
+		for _, code := range p.ExitCodes {
+			r.Retry.ExitCodes = append(r.Retry.ExitCodes, int32(code))
+		}
+		for _, signal := range p.Signals {
+			r.Retry.Signals = append(r.Retry.Signals, int32(signal))
+		}
+	}
+	if p := command.Restart; p != nil {
+		r.Restart = &workerservicepb.RestartPolicy{
+			Mode:              string(p.Mode),
+			DelayMs:           p.Delay.Milliseconds(),
+			CrashLoopFailures: int32(p.CrashLoopFailures),
+			CrashLoopWindowMs: p.CrashLoopWindow.Milliseconds(),
+		}
+	}
+	if l := command.Limits; l != nil {
+		r.Limits = &workerservicepb.Limits{
+			TimeoutMs:     l.Timeout.Milliseconds(),
+			MaxMemoryMb:   l.MaxMemoryBytes >> 20,
+			MaxCpuSeconds: l.MaxCPUSeconds,
+		}
+	}
+	return r
+}
+
+// formatTime formats time as RFC 3339, zero time is empty string
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
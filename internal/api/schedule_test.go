@@ -0,0 +1,81 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	workerservicepb "github.com/supby/job-worker/generated/proto"
+	"github.com/supby/job-worker/internal/workerlib"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSchedules(t *testing.T) {
+	ctx := context.Background()
+	worker := workerlib.New()
+	server := NewWorkerServer(worker)
+	server.Scheduler = workerlib.NewScheduler(worker, "", nil)
+	defer server.Scheduler.Close()
+
+	created, err := server.CreateSchedule(ctx, &workerservicepb.CreateScheduleRequest{
+		Cron:              "* * * * * *",
+		TimeZone:          "UTC",
+		Job:               &workerservicepb.StartRequest{CommandName: "echo", Arguments: []string{"tick"}, Labels: map[string]string{"team": "ops"}},
+		ConcurrencyPolicy: "forbid",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "forbid", created.Schedule.ConcurrencyPolicy)
+	assert.Equal(t, int32(10), created.Schedule.HistoryLimit)
+	assert.NotEmpty(t, created.Schedule.NextRun)
+
+	assert.Eventually(t, func() bool {
+		res, err := server.List(ctx, &workerservicepb.ListRequest{Selector: "schedule=" + created.Schedule.ScheduleId + ",team=ops"})
+		return err == nil && len(res.Jobs) > 0
+	}, 5*time.Second, 50*time.Millisecond)
+
+	_, err = server.PauseSchedule(ctx, &workerservicepb.PauseScheduleRequest{ScheduleId: created.Schedule.ScheduleId, Paused: true})
+	assert.NoError(t, err)
+
+	list, err := server.ListSchedules(ctx, &workerservicepb.ListSchedulesRequest{})
+	assert.NoError(t, err)
+	assert.Len(t, list.Schedules, 1)
+	assert.True(t, list.Schedules[0].Paused)
+	assert.Empty(t, list.Schedules[0].NextRun)
+	assert.NotEmpty(t, list.Schedules[0].LastJobId)
+	assert.Equal(t, "echo", list.Schedules[0].Job.CommandName)
+
+	_, err = server.DeleteSchedule(ctx, &workerservicepb.DeleteScheduleRequest{ScheduleId: created.Schedule.ScheduleId})
+	assert.NoError(t, err)
+
+	_, err = server.DeleteSchedule(ctx, &workerservicepb.DeleteScheduleRequest{ScheduleId: created.Schedule.ScheduleId})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestCreateInvalidSchedule(t *testing.T) {
+	ctx := context.Background()
+	worker := workerlib.New()
+	server := NewWorkerServer(worker)
+
+	_, err := server.CreateSchedule(ctx, &workerservicepb.CreateScheduleRequest{Cron: "@hourly", Job: &workerservicepb.StartRequest{CommandName: "ls"}})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+
+	server.Scheduler = workerlib.NewScheduler(worker, "", nil)
+	defer server.Scheduler.Close()
+
+	for _, r := range []*workerservicepb.CreateScheduleRequest{
+		{Cron: "@hourly"},
+		{Cron: "not a cron", Job: &workerservicepb.StartRequest{CommandName: "ls"}},
+		{Cron: "@hourly", TimeZone: "Mars/Olympus", Job: &workerservicepb.StartRequest{CommandName: "ls"}},
+		{Cron: "@hourly", ConcurrencyPolicy: "queue", Job: &workerservicepb.StartRequest{CommandName: "ls"}},
+		{Cron: "@hourly", Job: &workerservicepb.StartRequest{CommandName: "bash", Interactive: true}},
+		{Cron: "@hourly", Job: &workerservicepb.StartRequest{CommandName: "ls", IdempotencyKey: "key"}},
+	} {
+		_, err := server.CreateSchedule(ctx, r)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), r.String())
+	}
+
+	_, err = server.PauseSchedule(ctx, &workerservicepb.PauseScheduleRequest{ScheduleId: "not-uuid"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -1,12 +1,12 @@
 package api
 
 import (
+	"context"
 	"crypto/tls"
-	"crypto/x509"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -14,51 +14,58 @@ import (
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/reflection"
 
 	workerservicepb "github.com/supby/job-worker/generated/proto"
+	"github.com/supby/job-worker/internal/metrics"
 	"github.com/supby/job-worker/internal/workerlib"
 )
 
-func loadTLSCredentials(conf *Configuration) (credentials.TransportCredentials, error) {
-	pemClientCA, err := ioutil.ReadFile(conf.CAFile)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read CA file: %w", err)
-	}
+// serverInterceptors are checks shared by GRPC server and REST gateway, they run
+// after metrics interceptor and before authorization
+type serverInterceptors struct {
+	audit   *AuditLogger
+	crl     *revocationList
+	limiter *RateLimiter
+}
 
-	certPool := x509.NewCertPool()
-	if !certPool.AppendCertsFromPEM(pemClientCA) {
-		return nil, fmt.Errorf("failed to add client CA's certificate")
-	}
-
-	serverCert, err := tls.LoadX509KeyPair(conf.ServerCertificateFile, conf.ServerKeyFile)
-	if err != nil {
-		return nil, fmt.Errorf("failed to load server key pair: %w", err)
+func (i *serverInterceptors) unary() []grpc.UnaryServerInterceptor {
+	var interceptors []grpc.UnaryServerInterceptor
+	if i.audit != nil {
+		interceptors = append(interceptors, i.audit.UnaryInterceptor)
 	}
+	return append(interceptors, i.crl.UnaryInterceptor, i.limiter.UnaryInterceptor)
+}
 
-	config := &tls.Config{
-		Certificates: []tls.Certificate{serverCert},
-		ClientAuth:   tls.RequireAndVerifyClientCert,
-		ClientCAs:    certPool,
-		MinVersion:   tls.VersionTLS13,
-		// CipherSuites: []uint16{
-		// 	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-		// 	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
-		// },
+func (i *serverInterceptors) stream() []grpc.StreamServerInterceptor {
+	var interceptors []grpc.StreamServerInterceptor
+	if i.audit != nil {
+		interceptors = append(interceptors, i.audit.StreamInterceptor)
 	}
-	return credentials.NewTLS(config), nil
+	return append(interceptors, i.crl.StreamInterceptor, i.limiter.StreamInterceptor)
 }
 
-func createServer(config *Configuration, cred credentials.TransportCredentials) (*grpc.Server, net.Listener, error) {
-	lis, err := net.Listen("tcp", config.Endpoint)
+// defaultShutdownTimeout is how long running jobs are waited for on shutdown
+const defaultShutdownTimeout = 30 * time.Second
+
+func createServer(config *Configuration, cred credentials.TransportCredentials, workerServer *WorkerServer, interceptors *serverInterceptors) (*grpc.Server, *health.Server, net.Listener, error) {
+	lis, err := listen(config.Endpoint, os.FileMode(config.SocketMode))
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to listen: %w", err)
+		return nil, nil, nil, fmt.Errorf("failed to listen: %w", err)
 	}
 
+	unaryInterceptors := append([]grpc.UnaryServerInterceptor{UnaryMetricsInterceptor}, interceptors.unary()...)
+	streamInterceptors := append([]grpc.StreamServerInterceptor{StreamMetricsInterceptor}, interceptors.stream()...)
+	unaryInterceptors = append(unaryInterceptors, UnaryAuthInterceptor)
+	streamInterceptors = append(streamInterceptors, StreamAuthInterceptor)
+
 	opts := []grpc.ServerOption{
 		grpc.Creds(cred),
-		grpc.UnaryInterceptor(UnaryAuthInterceptor),
-		grpc.StreamInterceptor(StreamAuthInterceptor),
+		grpc.ChainUnaryInterceptor(unaryInterceptors...),
+		grpc.ChainStreamInterceptor(streamInterceptors...),
 		grpc.KeepaliveParams(keepalive.ServerParameters{
 			MaxConnectionIdle: 5 * time.Minute,
 			Time:              10 * time.Second,
@@ -68,24 +75,137 @@ func createServer(config *Configuration, cred credentials.TransportCredentials)
 
 	grpcServer := grpc.NewServer(opts...)
 
-	workerservicepb.RegisterWorkerServiceServer(grpcServer, NewWorkerServer(workerlib.New()))
-	return grpcServer, lis, nil
+	workerservicepb.RegisterWorkerServiceServer(grpcServer, workerServer)
+
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+
+	if config.Reflection {
+		reflection.Register(grpcServer)
+	}
+
+	return grpcServer, healthServer, lis, nil
+}
+
+func createHTTPServer(config *Configuration, tlsConfig *tls.Config, workerServer *WorkerServer, interceptors *serverInterceptors) (*http.Server, net.Listener, error) {
+	lis, err := tls.Listen("tcp", config.HTTPEndpoint, tlsConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to listen: %w", err)
+	}
+
+	gateway := NewGateway(workerServer, interceptors.unary()...)
+	gateway.AllowedOrigins = config.AllowedOrigins
+	httpServer := &http.Server{
+		Handler:           gateway,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return httpServer, lis, nil
+}
+
+func createMetricsServer(config *Configuration) (*http.Server, net.Listener, error) {
+	lis, err := net.Listen("tcp", config.MetricsEndpoint)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to listen: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metrics.DefaultRegistry.Handler())
+
+	httpServer := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return httpServer, lis, nil
 }
 
 func StartServer(config *Configuration) error {
-	cred, err := loadTLSCredentials(config)
+	shutdownMode, err := config.shutdownMode()
 	if err != nil {
-		return fmt.Errorf("failed to load TLS credentials: %w", err)
+		return err
+	}
+	shutdownTimeout := config.ShutdownTimeout
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = defaultShutdownTimeout
 	}
-	log.Println("TLS credentials loaded successfully")
 
-	serv, lis, err := createServer(config, cred)
+	var audit *AuditLogger
+	if config.AuditFile != "" {
+		audit, err = NewAuditLogger(config.AuditFile, config.AuditMaxSizeMB, config.AuditMaxBackups)
+		if err != nil {
+			return fmt.Errorf("failed to create audit log: %w", err)
+		}
+		defer audit.Close()
+		log.Printf("Audit log is written to %s", config.AuditFile)
+	}
+
+	crl, err := newRevocationList(config, audit)
+	if err != nil {
+		return fmt.Errorf("failed to load CRL: %w", err)
+	}
+
+	// unix socket clients don't use certificates, TLS is required by TCP endpoint and REST gateway only
+	var certs *tlsReloader
+	if !isUnixEndpoint(config.Endpoint) || config.HTTPEndpoint != "" {
+		certs, err = newTLSReloader(config, crl)
+		if err != nil {
+			return fmt.Errorf("failed to load TLS credentials: %w", err)
+		}
+		log.Println("TLS credentials loaded successfully")
+	}
+
+	var cred credentials.TransportCredentials
+	var peerCred *peerCredCredentials
+	if isUnixEndpoint(config.Endpoint) {
+		peerCred = newPeerCredCredentials(config)
+		cred = peerCred
+	} else {
+		cred = credentials.NewTLS(certs.serverConfig("h2"))
+	}
+
+	interceptors := &serverInterceptors{audit: audit, crl: crl, limiter: NewRateLimiter(config.Limits)}
+	workerOpts := []workerlib.Option{
+		workerlib.WithMaxRunningJobs(config.MaxRunningJobs),
+		workerlib.WithIdempotencyWindow(config.IdempotencyWindow),
+		workerlib.WithMaxQueuedJobs(config.MaxQueuedJobs),
+		workerlib.WithQueueAging(config.QueueAging),
+	}
+	if config.Preemption {
+		workerOpts = append(workerOpts, workerlib.WithPreemption(config.PreemptionGracePeriod))
+	}
+	if config.StateDir != "" {
+		workerOpts = append(workerOpts, workerlib.WithStateDir(config.StateDir))
+	}
+	if config.CgroupDir != "" {
+		workerOpts = append(workerOpts, workerlib.WithCgroupDir(config.CgroupDir))
+	}
+	worker := workerlib.New(workerOpts...)
+	workerServer := NewWorkerServer(worker)
+	workerServer.Limiter = interceptors.limiter
+	workerServer.SetTemplates(config)
+	if err := workerServer.SetPolicy(config); err != nil {
+		return err
+	}
+	scheduler := workerlib.NewScheduler(worker, config.StateDir, workerServer.authorizeStart)
+	workerServer.Scheduler = scheduler
+	workflows := workerlib.NewWorkflowEngine(worker, workerServer.authorizeStart)
+	workerServer.Workflows = workflows
+
+	serv, healthServer, lis, err := createServer(config, cred, workerServer, interceptors)
 	if err != nil {
 		return fmt.Errorf("failed to create server: %w", err)
 	}
 	defer lis.Close()
 	log.Printf("Server created and listening on %s", config.Endpoint)
 
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	go watchHealth(backgroundCtx, healthServer, worker)
+
+	go crl.watch(backgroundCtx, config.CRLReloadInterval)
+
+	reloader := &reloader{config: *config, tls: certs, peerCred: peerCred, crl: crl, limiter: interceptors.limiter, worker: worker, server: workerServer}
+	go reloader.watchConfig(backgroundCtx)
+
 	go func() {
 		log.Printf("Starting to serve on %s", config.Endpoint)
 		if err := serv.Serve(lis); err != nil {
@@ -93,13 +213,75 @@ func StartServer(config *Configuration) error {
 		}
 	}()
 
+	var httpServ *http.Server
+	if config.HTTPEndpoint != "" {
+		var httpLis net.Listener
+		httpServ, httpLis, err = createHTTPServer(config, certs.serverConfig("http/1.1"), workerServer, interceptors)
+		if err != nil {
+			return fmt.Errorf("failed to create HTTP server: %w", err)
+		}
+		log.Printf("HTTP gateway created and listening on %s", config.HTTPEndpoint)
+
+		go func() {
+			log.Printf("Starting to serve HTTP on %s", config.HTTPEndpoint)
+			if err := httpServ.Serve(httpLis); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Failed to serve HTTP: %v", err)
+			}
+		}()
+	}
+
+	if config.MetricsEndpoint != "" {
+		metricsServ, metricsLis, err := createMetricsServer(config)
+		if err != nil {
+			return fmt.Errorf("failed to create metrics server: %w", err)
+		}
+		defer metricsServ.Close()
+
+		go func() {
+			log.Printf("Starting to serve metrics on %s", config.MetricsEndpoint)
+			if err := metricsServ.Serve(metricsLis); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Failed to serve metrics: %v", err)
+			}
+		}()
+	}
+
 	// Graceful shutdown
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 	<-stop
 
-	log.Println("Shutting down server...")
+	log.Printf("Shutting down server, running jobs policy: %s", shutdownMode)
+	stopBackground()
+	healthServer.Shutdown()
+
+	scheduler.Close()
+	workflows.Close()
+
+	// API keeps serving status and output of jobs while they are drained or terminated
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	if err := worker.Shutdown(shutdownCtx, shutdownMode); err != nil {
+		log.Printf("Jobs did not finish within %v: %v", shutdownTimeout, err)
+	}
+	cancelShutdown()
+
+	workerServer.CloseStreams(fmt.Sprintf("server is shutting down, jobs policy: %s", shutdownMode))
+	if httpServ != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := httpServ.Shutdown(ctx); err != nil {
+			httpServ.Close()
+		}
+		cancel()
+	}
 	serv.GracefulStop()
+
+	// output logs of detached jobs are kept
+	if shutdownMode != workerlib.ShutdownDetach {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := worker.Cleanup(ctx); err != nil {
+			log.Printf("Failed to clean up jobs: %v", err)
+		}
+		cancel()
+	}
 	log.Println("Server stopped")
 
 	return nil
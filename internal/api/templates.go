@@ -0,0 +1,232 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	workerservicepb "github.com/supby/job-worker/generated/proto"
+	"github.com/supby/job-worker/internal/workerlib"
+	"github.com/supby/job-worker/internal/workerlib/job"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TemplateLabel is label of jobs started from template, its value is template name
+const TemplateLabel = "template"
+
+// defaultAdminRoles can Start arbitrary commands when TemplatesOnly is set and AdminRoles are not configured
+var defaultAdminRoles = []string{"admin"}
+
+// placeholder is reference to template parameter in arguments and env values
+var placeholder = regexp.MustCompile(`\{\{([^{}]*)\}\}`)
+
+// Template is a named command clients start with StartFromTemplate. Arguments and
+// env values can refer to parameters as {{name}}.
+type Template struct {
+	Command    string
+	Arguments  []string
+	Env        map[string]string
+	Parameters map[string]TemplateParameter
+	// Timeout, MaxMemoryMB and MaxCPUSeconds limit resources of job, zero means no limit
+	Timeout       time.Duration
+	MaxMemoryMB   uint64
+	MaxCPUSeconds uint64
+}
+
+// TemplateParameter is a typed parameter of template
+type TemplateParameter struct {
+	// Type is string (default), int, bool or enum
+	Type string
+	// Values are allowed values of enum parameter
+	Values   []string
+	Required bool
+	// Default is value of optional parameter which is not passed
+	Default string
+}
+
+// templateConfig is the part of configuration used by StartFromTemplate and Start
+type templateConfig struct {
+	templates     map[string]Template
+	templatesOnly bool
+	adminRoles    []string
+}
+
+// SetTemplates applies templates of configuration, it is called again on reload
+func (s *WorkerServer) SetTemplates(conf *Configuration) {
+	adminRoles := conf.AdminRoles
+	if len(adminRoles) == 0 {
+		adminRoles = defaultAdminRoles
+	}
+	s.templates.Store(&templateConfig{
+		templates:     conf.Templates,
+		templatesOnly: conf.TemplatesOnly,
+		adminRoles:    adminRoles,
+	})
+}
+
+// StartFromTemplate starts job from template of server configuration with parameters of request
+func (s *WorkerServer) StartFromTemplate(ctx context.Context, r *workerservicepb.StartFromTemplateRequest) (*workerservicepb.StartResponse, error) {
+	var t Template
+	ok := false
+	if conf := s.templates.Load(); conf != nil {
+		t, ok = conf.templates[r.Template]
+	}
+	if !ok {
+		return nil, status.Error(codes.NotFound, "template not found")
+	}
+
+	command, err := t.command(r.Parameters)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := workerlib.ValidateLabels(r.Labels); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	command.Labels = map[string]string{}
+	for k, v := range r.Labels {
+		command.Labels[k] = v
+	}
+	command.Labels[TemplateLabel] = r.Template
+
+	return s.start(ctx, command, r.IdempotencyKey)
+}
+
+// checkArbitraryCommand rejects commands which are not started from template when
+// TemplatesOnly is set and client has none of admin roles
+func (s *WorkerServer) checkArbitraryCommand(ctx context.Context) error {
+	_, roles := callerIdentity(ctx)
+	return s.checkArbitraryCommandFor(roles)
+}
+
+func (s *WorkerServer) checkArbitraryCommandFor(roles []string) error {
+	conf := s.templates.Load()
+	if conf == nil || !conf.templatesOnly {
+		return nil
+	}
+	for _, role := range roles {
+		for _, admin := range conf.adminRoles {
+			if role == admin {
+				return nil
+			}
+		}
+	}
+	return status.Error(codes.PermissionDenied, "arbitrary commands are disabled, use StartFromTemplate")
+}
+
+// command substitutes parameters of template
+func (t Template) command(params map[string]string) (job.Command, error) {
+	for name := range params {
+		if _, ok := t.Parameters[name]; !ok {
+			return job.Command{}, fmt.Errorf("unknown parameter %q", name)
+		}
+	}
+
+	values := map[string]string{}
+	for name, p := range t.Parameters {
+		value, ok := params[name]
+		if !ok {
+			if p.Required {
+				return job.Command{}, fmt.Errorf("parameter %q is required", name)
+			}
+			value = p.Default
+		}
+		if err := p.validate(value); err != nil {
+			return job.Command{}, fmt.Errorf("invalid parameter %q: %w", name, err)
+		}
+		values[name] = value
+	}
+	substitute := func(s string) string {
+		return placeholder.ReplaceAllStringFunc(s, func(ref string) string {
+			return values[strings.TrimSpace(ref[2:len(ref)-2])]
+		})
+	}
+
+	command := job.Command{Name: t.Command}
+	for _, arg := range t.Arguments {
+		command.Arguments = append(command.Arguments, substitute(arg))
+	}
+	// sorted, so that the same parameters give the same command for idempotency keys
+	keys := make([]string, 0, len(t.Env))
+	for key := range t.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		command.Env = append(command.Env, key+"="+substitute(t.Env[key]))
+	}
+	if t.Timeout > 0 || t.MaxMemoryMB > 0 || t.MaxCPUSeconds > 0 {
+		command.Limits = &job.Limits{
+			Timeout:        t.Timeout,
+			MaxMemoryBytes: t.MaxMemoryMB << 20,
+			MaxCPUSeconds:  t.MaxCPUSeconds,
+		}
+	}
+	return command, nil
+}
+
+func (p TemplateParameter) validate(value string) error {
+	switch p.Type {
+	case "", "string":
+		if strings.ContainsRune(value, 0) {
+			return fmt.Errorf("value contains NUL character")
+		}
+	case "int":
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+	case "bool":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+	case "enum":
+		for _, v := range p.Values {
+			if v == value {
+				return nil
+			}
+		}
+		return fmt.Errorf("%q is not one of %v", value, p.Values)
+	default:
+		return fmt.Errorf("unknown parameter type %q", p.Type)
+	}
+	return nil
+}
+
+// validateTemplates checks templates of configuration, so that invalid templates are rejected on load
+func validateTemplates(templates map[string]Template) error {
+	for name, t := range templates {
+		if t.Command == "" {
+			return fmt.Errorf("template %q has no command", name)
+		}
+		if t.MaxMemoryMB > maxMemoryMB {
+			return fmt.Errorf("template %q has invalid maxmemorymb", name)
+		}
+		for param, p := range t.Parameters {
+			if p.Type == "enum" && len(p.Values) == 0 {
+				return fmt.Errorf("enum parameter %q of template %q has no values", param, name)
+			}
+			if !p.Required {
+				if err := p.validate(p.Default); err != nil {
+					return fmt.Errorf("invalid default of parameter %q of template %q: %w", param, name, err)
+				}
+			}
+		}
+
+		refs := append([]string(nil), t.Arguments...)
+		for _, value := range t.Env {
+			refs = append(refs, value)
+		}
+		for _, s := range refs {
+			for _, m := range placeholder.FindAllStringSubmatch(s, -1) {
+				if _, ok := t.Parameters[strings.TrimSpace(m[1])]; !ok {
+					return fmt.Errorf("template %q refers to unknown parameter %q", name, m[1])
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	workerservicepb "github.com/supby/job-worker/generated/proto"
+	"github.com/supby/job-worker/internal/workerlib"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const testTemplates = `
+templates:
+  backup-db:
+    command: "sh"
+    arguments: ["-c", "echo $0 $RETENTION", "{{database}}"]
+    env:
+      RETENTION: "{{days}}"
+    parameters:
+      database:
+        type: enum
+        values: ["orders", "users"]
+        required: true
+      days:
+        type: int
+        default: "7"
+    timeout: 1m
+`
+
+func readTestConfig(t *testing.T, data string) (Configuration, error) {
+	configFile := filepath.Join(t.TempDir(), "server_config.yaml")
+	assert.NoError(t, os.WriteFile(configFile, []byte(data), 0600))
+	return ReadConfigFromYaml(configFile)
+}
+
+func rolesContext(roles ...string) context.Context {
+	return peer.NewContext(context.Background(), &peer.Peer{AuthInfo: PeerCredInfo{Roles: roles}})
+}
+
+func TestStartFromTemplate(t *testing.T) {
+	ctx := context.Background()
+	config, err := readTestConfig(t, testTemplates)
+	assert.NoError(t, err)
+	worker := workerlib.New()
+	server := NewWorkerServer(worker)
+	server.SetTemplates(&config)
+
+	started, err := server.StartFromTemplate(ctx, &workerservicepb.StartFromTemplateRequest{
+		Template:   "backup-db",
+		Parameters: map[string]string{"database": "orders"},
+		Labels:     map[string]string{"team": "dba"},
+	})
+	assert.NoError(t, err)
+
+	jobID := uuid.MustParse(started.JobId)
+	status, err := worker.Wait(ctx, jobID)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "dba", TemplateLabel: "backup-db"}, status.Labels)
+
+	output, err := worker.GetStreamFrom(ctx, jobID, 0)
+	assert.NoError(t, err)
+	var received string
+	for chunk := range output {
+		if received += string(chunk); strings.HasSuffix(received, "\n") {
+			break
+		}
+	}
+	assert.Equal(t, "orders 7\n", received)
+}
+
+func TestStartFromTemplateInvalidParameters(t *testing.T) {
+	ctx := context.Background()
+	config, err := readTestConfig(t, testTemplates)
+	assert.NoError(t, err)
+	server := NewWorkerServer(workerlib.New())
+	server.SetTemplates(&config)
+
+	_, err = server.StartFromTemplate(ctx, &workerservicepb.StartFromTemplateRequest{Template: "drop-db"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	for _, params := range []map[string]string{
+		{},
+		{"database": "billing"},
+		{"database": "orders", "days": "week"},
+		{"database": "orders", "command": "rm"},
+	} {
+		_, err := server.StartFromTemplate(ctx, &workerservicepb.StartFromTemplateRequest{Template: "backup-db", Parameters: params})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), params)
+	}
+}
+
+func TestStartFromTemplateQuota(t *testing.T) {
+	config, err := readTestConfig(t, testTemplates)
+	assert.NoError(t, err)
+	server := NewWorkerServer(workerlib.New())
+	server.SetTemplates(&config)
+	server.Limiter = NewRateLimiter(map[string]RoleLimits{"full": {MaxRunningJobs: 1}})
+
+	_, err = server.Start(rolesContext("full"), &workerservicepb.StartRequest{CommandName: "sleep", Arguments: []string{"5"}})
+	assert.NoError(t, err)
+	_, err = server.StartFromTemplate(rolesContext("full"), &workerservicepb.StartFromTemplateRequest{
+		Template:   "backup-db",
+		Parameters: map[string]string{"database": "users"},
+	})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	assert.NoError(t, server.Worker.Shutdown(context.Background(), workerlib.ShutdownTerminate))
+}
+
+func TestTemplatesOnly(t *testing.T) {
+	config, err := readTestConfig(t, testTemplates+"templatesonly: true\n")
+	assert.NoError(t, err)
+	server := NewWorkerServer(workerlib.New())
+	server.SetTemplates(&config)
+
+	_, err = server.Start(rolesContext("full"), &workerservicepb.StartRequest{CommandName: "ls"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = server.SubmitWorkflow(rolesContext("full"), &workerservicepb.SubmitWorkflowRequest{})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+	server.Workflows = workerlib.NewWorkflowEngine(server.Worker, nil)
+	defer server.Workflows.Close()
+	_, err = server.SubmitWorkflow(rolesContext("full"), &workerservicepb.SubmitWorkflowRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = server.Start(rolesContext("full", "admin"), &workerservicepb.StartRequest{CommandName: "ls"})
+	assert.NoError(t, err)
+
+	_, err = server.StartFromTemplate(rolesContext("full"), &workerservicepb.StartFromTemplateRequest{
+		Template:   "backup-db",
+		Parameters: map[string]string{"database": "users"},
+	})
+	assert.NoError(t, err)
+}
+
+func TestInvalidTemplates(t *testing.T) {
+	for _, templates := range []string{
+		"templates:\n  empty:\n    arguments: [\"-la\"]\n",
+		"templates:\n  list:\n    command: ls\n    arguments: [\"{{dir}}\"]\n",
+		"templates:\n  list:\n    command: ls\n    parameters:\n      depth:\n        type: int\n",
+		"templates:\n  list:\n    command: ls\n    parameters:\n      sort:\n        type: enum\n        required: true\n",
+		"templates:\n  list:\n    command: ls\n    parameters:\n      dir:\n        type: path\n",
+		"templates:\n  list:\n    command: ls\n    maxmemorymb: 17592186044416\n",
+	} {
+		_, err := readTestConfig(t, templates)
+		assert.Error(t, err, templates)
+	}
+
+	config, err := readTestConfig(t, "templates:\n  sleep:\n    command: sleep\n    arguments: [\"{{seconds}}\"]\n    parameters:\n      seconds:\n        type: int\n        default: \"1\"\n    timeout: 10ms\n")
+	assert.NoError(t, err)
+	assert.Equal(t, 10*time.Millisecond, config.Templates["sleep"].Timeout)
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+func loadTLSConfig(conf *Configuration, crl *revocationList) (*tls.Config, error) {
+	pemClientCA, err := os.ReadFile(conf.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %w", err)
+	}
+
+	certPool := x509.NewCertPool()
+	if !certPool.AppendCertsFromPEM(pemClientCA) {
+		return nil, fmt.Errorf("failed to add client CA's certificate")
+	}
+
+	serverCert, err := tls.LoadX509KeyPair(conf.ServerCertificateFile, conf.ServerKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server key pair: %w", err)
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    certPool,
+		MinVersion:   tls.VersionTLS13,
+		// CipherSuites: []uint16{
+		// 	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		// 	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		// },
+	}
+	if crl != nil {
+		config.VerifyPeerCertificate = crl.verifyPeerCertificate
+	}
+	return config, nil
+}
+
+// tlsReloader holds current server certificate and client CA bundle. Configs it
+// creates pick up reloaded files on every new handshake, established connections
+// keep using the old ones.
+type tlsReloader struct {
+	current atomic.Pointer[tls.Config]
+	crl     *revocationList
+}
+
+func newTLSReloader(conf *Configuration, crl *revocationList) (*tlsReloader, error) {
+	r := &tlsReloader{crl: crl}
+	if err := r.reload(conf); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reload loads TLS files, current config is kept when they can't be loaded
+func (r *tlsReloader) reload(conf *Configuration) error {
+	config, err := loadTLSConfig(conf, r.crl)
+	if err != nil {
+		return err
+	}
+	r.current.Store(config)
+	return nil
+}
+
+// serverConfig returns config for listener, nextProtos are ALPN protocols of the listener
+func (r *tlsReloader) serverConfig(nextProtos ...string) *tls.Config {
+	return &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		MinVersion: tls.VersionTLS13,
+		NextProtos: nextProtos,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			config := r.current.Load().Clone()
+			config.NextProtos = nextProtos
+			return config, nil
+		},
+	}
+}
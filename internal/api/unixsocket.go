@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc/credentials"
+)
+
+const unixScheme = "unix://"
+
+// defaultSocketMode allows socket owner and group to connect
+const defaultSocketMode = 0660
+
+// isUnixEndpoint reports whether endpoint is unix:///path address
+func isUnixEndpoint(endpoint string) bool {
+	return strings.HasPrefix(endpoint, unixScheme)
+}
+
+// listen listens on TCP address or unix:///path socket
+func listen(endpoint string, socketMode os.FileMode) (net.Listener, error) {
+	if !isUnixEndpoint(endpoint) {
+		return net.Listen("tcp", endpoint)
+	}
+
+	path := strings.TrimPrefix(endpoint, unixScheme)
+	// socket left by previous run
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if socketMode == 0 {
+		socketMode = defaultSocketMode
+	}
+	if err := os.Chmod(path, socketMode); err != nil {
+		lis.Close()
+		return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+	return lis, nil
+}
+
+// PeerCredInfo is auth info of unix socket client identified by SO_PEERCRED
+type PeerCredInfo struct {
+	credentials.CommonAuthInfo
+	UID   uint32
+	GID   uint32
+	PID   int32
+	Roles []string
+}
+
+func (PeerCredInfo) AuthType() string {
+	return "peercred"
+}
+
+// Subject identifies client in audit log and rate limits
+func (i PeerCredInfo) Subject() string {
+	return fmt.Sprintf("uid=%d,gid=%d", i.UID, i.GID)
+}
+
+// peerCredCredentials are server transport credentials of unix socket, they
+// don't encrypt connection and map uid and gid of connected process to roles
+type peerCredCredentials struct {
+	mtx        sync.RWMutex
+	userRoles  map[uint32][]string
+	groupRoles map[uint32][]string
+}
+
+func newPeerCredCredentials(conf *Configuration) *peerCredCredentials {
+	c := &peerCredCredentials{}
+	c.setRoles(conf)
+	return c
+}
+
+// setRoles replaces uid and gid to roles mapping, it applies to new connections
+func (c *peerCredCredentials) setRoles(conf *Configuration) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.userRoles = conf.UnixUserRoles
+	c.groupRoles = conf.UnixGroupRoles
+}
+
+// rolesFor returns roles of user together with roles of its primary group
+func (c *peerCredCredentials) rolesFor(uid, gid uint32) []string {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	var roles []string
+	seen := map[string]bool{}
+	for _, role := range append(append([]string{}, c.userRoles[uid]...), c.groupRoles[gid]...) {
+		if !seen[role] {
+			seen[role] = true
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+func (c *peerCredCredentials) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil, nil, errors.New("peer credentials require unix socket connection")
+	}
+	uid, gid, pid, err := getPeerCred(unixConn)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get peer credentials: %w", err)
+	}
+
+	return conn, PeerCredInfo{
+		CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.PrivacyAndIntegrity},
+		UID:            uid,
+		GID:            gid,
+		PID:            pid,
+		Roles:          c.rolesFor(uid, gid),
+	}, nil
+}
+
+func (c *peerCredCredentials) ClientHandshake(context.Context, string, net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, errors.New("peer credentials are server side only")
+}
+
+func (c *peerCredCredentials) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{SecurityProtocol: "peercred"}
+}
+
+func (c *peerCredCredentials) Clone() credentials.TransportCredentials {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return &peerCredCredentials{userRoles: c.userRoles, groupRoles: c.groupRoles}
+}
+
+func (c *peerCredCredentials) OverrideServerName(string) error {
+	return nil
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	workerservicepb "github.com/supby/job-worker/generated/proto"
+	"github.com/supby/job-worker/internal/client"
+	"github.com/supby/job-worker/internal/workerlib"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnixSocketEndpoint(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "worker.sock")
+	config := &Configuration{
+		Endpoint:      "unix://" + socket,
+		UnixUserRoles: map[uint32][]string{uint32(os.Getuid()): {"read"}},
+	}
+
+	crl, err := newRevocationList(config, nil)
+	assert.NoError(t, err)
+	interceptors := &serverInterceptors{crl: crl, limiter: NewRateLimiter(nil)}
+	serv, _, lis, err := createServer(config, newPeerCredCredentials(config), NewWorkerServer(workerlib.New()), interceptors)
+	assert.NoError(t, err)
+	go serv.Serve(lis)
+	defer serv.Stop()
+
+	info, err := os.Stat(socket)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0660), info.Mode().Perm())
+
+	c, err := client.NewWorkerClient(client.Configuration{ServerEndpoint: config.Endpoint})
+	assert.NoError(t, err)
+
+	_, err = c.List(context.Background(), &workerservicepb.ListRequest{})
+	assert.NoError(t, err)
+
+	_, err = c.Start(context.Background(), &workerservicepb.StartRequest{CommandName: "ls"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestPeerCredRoles(t *testing.T) {
+	c := newPeerCredCredentials(&Configuration{
+		UnixUserRoles:  map[uint32][]string{1000: {"full"}},
+		UnixGroupRoles: map[uint32][]string{100: {"read", "full"}},
+	})
+
+	assert.Equal(t, []string{"full", "read"}, c.rolesFor(1000, 100))
+	assert.Equal(t, []string{"read", "full"}, c.rolesFor(1001, 100))
+	assert.Empty(t, c.rolesFor(1001, 101))
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+	workerservicepb "github.com/supby/job-worker/generated/proto"
+	"github.com/supby/job-worker/internal/workerlib"
+	"github.com/supby/job-worker/internal/workerlib/job"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *WorkerServer) SubmitWorkflow(ctx context.Context, r *workerservicepb.SubmitWorkflowRequest) (*workerservicepb.SubmitWorkflowResponse, error) {
+	if s.Workflows == nil {
+		return nil, status.Error(codes.Unimplemented, "workflows are not enabled")
+	}
+
+	if err := s.checkArbitraryCommand(ctx); err != nil {
+		return nil, err
+	}
+	var spec workerlib.WorkflowSpec
+	spec.Owner, spec.Roles = callerIdentity(ctx)
+	if quota, ok := s.Limiter.quota(ctx); ok {
+		spec.Quota = &quota
+	}
+	for _, node := range r.Nodes {
+		if node.Job == nil {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("job of node %q is required", node.Name))
+		}
+		if node.Job.IdempotencyKey != "" {
+			return nil, status.Error(codes.InvalidArgument, "workflow jobs can't have idempotency key")
+		}
+		command, err := toCommand(node.Job)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.checkPolicy(ctx, command); err != nil {
+			return nil, err
+		}
+		spec.Nodes = append(spec.Nodes, workerlib.WorkflowNode{
+			Name:      node.Name,
+			Command:   command,
+			DependsOn: node.DependsOn,
+			Condition: workerlib.NodeCondition(node.Condition),
+		})
+	}
+
+	wf, err := s.Workflows.SubmitWorkflow(ctx, spec)
+	if err != nil {
+		if errors.Is(err, workerlib.ErrShuttingDown) {
+			return nil, status.Error(codes.Unavailable, "server is shutting down")
+		}
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return &workerservicepb.SubmitWorkflowResponse{Workflow: toWorkflowInfo(wf)}, nil
+}
+
+func (s *WorkerServer) GetWorkflow(ctx context.Context, r *workerservicepb.GetWorkflowRequest) (*workerservicepb.GetWorkflowResponse, error) {
+	if s.Workflows == nil {
+		return nil, status.Error(codes.Unimplemented, "workflows are not enabled")
+	}
+	id, err := uuid.Parse(r.WorkflowId)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid workflow ID")
+	}
+
+	wf, err := s.Workflows.GetWorkflow(ctx, id)
+	if err != nil {
+		return nil, workflowError(err)
+	}
+	return &workerservicepb.GetWorkflowResponse{Workflow: toWorkflowInfo(wf)}, nil
+}
+
+func (s *WorkerServer) ListWorkflows(ctx context.Context, r *workerservicepb.ListWorkflowsRequest) (*workerservicepb.ListWorkflowsResponse, error) {
+	if s.Workflows == nil {
+		return nil, status.Error(codes.Unimplemented, "workflows are not enabled")
+	}
+	workflows, err := s.Workflows.ListWorkflows(ctx)
+	if err != nil {
+		return nil, workflowError(err)
+	}
+
+	res := &workerservicepb.ListWorkflowsResponse{}
+	for _, wf := range workflows {
+		res.Workflows = append(res.Workflows, toWorkflowInfo(wf))
+	}
+	return res, nil
+}
+
+// CancelWorkflow stops running nodes of workflow, pending nodes are not started
+func (s *WorkerServer) CancelWorkflow(ctx context.Context, r *workerservicepb.CancelWorkflowRequest) (*workerservicepb.CancelWorkflowResponse, error) {
+	if s.Workflows == nil {
+		return nil, status.Error(codes.Unimplemented, "workflows are not enabled")
+	}
+	id, err := uuid.Parse(r.WorkflowId)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid workflow ID")
+	}
+
+	if err := s.Workflows.CancelWorkflow(ctx, id); err != nil {
+		return nil, workflowError(err)
+	}
+	return &workerservicepb.CancelWorkflowResponse{}, nil
+}
+
+func workflowError(err error) error {
+	switch {
+	case errors.Is(err, workerlib.ErrWorkflowNotFound):
+		return status.Error(codes.NotFound, "workflow not found")
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	}
+	log.Printf("[api] workflow operation failed: %v", err)
+	return status.Error(codes.Internal, "workflow operation failed")
+}
+
+func toWorkflowInfo(wf workerlib.Workflow) *workerservicepb.WorkflowInfo {
+	info := &workerservicepb.WorkflowInfo{
+		WorkflowId: wf.ID.String(),
+		State:      string(wf.State),
+		CreatedAt:  formatTime(wf.CreatedAt),
+		FinishedAt: formatTime(wf.FinishedAt),
+	}
+	for _, node := range wf.Nodes {
+		nodeStatus := &workerservicepb.WorkflowNodeStatus{
+			Name:  node.Name,
+			State: string(node.State),
+			Error: node.Error,
+		}
+		if node.JobID != job.NilJobId {
+			nodeStatus.JobId = node.JobID.String()
+		}
+		info.Nodes = append(info.Nodes, nodeStatus)
+	}
+	return info
+}
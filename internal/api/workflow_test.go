@@ -0,0 +1,69 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	workerservicepb "github.com/supby/job-worker/generated/proto"
+	"github.com/supby/job-worker/internal/workerlib"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestWorkflows(t *testing.T) {
+	ctx := context.Background()
+	worker := workerlib.New()
+	server := NewWorkerServer(worker)
+	server.Workflows = workerlib.NewWorkflowEngine(worker, nil)
+	defer server.Workflows.Close()
+
+	submitted, err := server.SubmitWorkflow(ctx, &workerservicepb.SubmitWorkflowRequest{Nodes: []*workerservicepb.WorkflowNode{
+		{Name: "build", Job: &workerservicepb.StartRequest{CommandName: "sleep", Arguments: []string{"10"}}},
+		{Name: "test", Job: &workerservicepb.StartRequest{CommandName: "true"}, DependsOn: []string{"build"}},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, "running", submitted.Workflow.State)
+	assert.Len(t, submitted.Workflow.Nodes, 2)
+
+	_, err = server.CancelWorkflow(ctx, &workerservicepb.CancelWorkflowRequest{WorkflowId: submitted.Workflow.WorkflowId})
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		res, err := server.GetWorkflow(ctx, &workerservicepb.GetWorkflowRequest{WorkflowId: submitted.Workflow.WorkflowId})
+		return err == nil && res.Workflow.State == "cancelled" && res.Workflow.FinishedAt != ""
+	}, 5*time.Second, 20*time.Millisecond)
+
+	list, err := server.ListWorkflows(ctx, &workerservicepb.ListWorkflowsRequest{})
+	assert.NoError(t, err)
+	assert.Len(t, list.Workflows, 1)
+	assert.Equal(t, "cancelled", list.Workflows[0].Nodes[1].State)
+	assert.Empty(t, list.Workflows[0].Nodes[1].JobId)
+}
+
+func TestSubmitInvalidWorkflow(t *testing.T) {
+	ctx := context.Background()
+	worker := workerlib.New()
+	server := NewWorkerServer(worker)
+
+	_, err := server.ListWorkflows(ctx, &workerservicepb.ListWorkflowsRequest{})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+
+	server.Workflows = workerlib.NewWorkflowEngine(worker, nil)
+	defer server.Workflows.Close()
+
+	for _, r := range []*workerservicepb.SubmitWorkflowRequest{
+		{},
+		{Nodes: []*workerservicepb.WorkflowNode{{Name: "build"}}},
+		{Nodes: []*workerservicepb.WorkflowNode{{Name: "build", Job: &workerservicepb.StartRequest{CommandName: "make"}, DependsOn: []string{"build"}}}},
+		{Nodes: []*workerservicepb.WorkflowNode{{Name: "build", Job: &workerservicepb.StartRequest{CommandName: "make"}, Condition: "sometimes"}}},
+		{Nodes: []*workerservicepb.WorkflowNode{{Name: "build", Job: &workerservicepb.StartRequest{CommandName: "make", IdempotencyKey: "key"}}}},
+	} {
+		_, err := server.SubmitWorkflow(ctx, r)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), r.String())
+	}
+
+	_, err = server.GetWorkflow(ctx, &workerservicepb.GetWorkflowRequest{WorkflowId: "00000000-0000-0000-0000-000000000001"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
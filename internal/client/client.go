@@ -5,10 +5,12 @@ import (
 	"crypto/x509"
 	"fmt"
 	"io/ioutil"
+	"strings"
 
 	"github.com/supby/job-worker/generated/proto"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/local"
 )
 
 func loadTLSCredentials(config Configuration) (credentials.TransportCredentials, error) {
@@ -37,7 +39,10 @@ func loadTLSCredentials(config Configuration) (credentials.TransportCredentials,
 
 func NewWorkerClient(config Configuration) (proto.WorkerServiceClient, error) {
 	dialOptions := grpc.WithInsecure()
-	if config.CAFile != "" && config.ClientCertificateFile != "" && config.ClientKeyFile != "" {
+	if strings.HasPrefix(config.ServerEndpoint, "unix:") {
+		// server identifies unix socket clients by uid and gid, certificates are not used
+		dialOptions = grpc.WithTransportCredentials(local.NewCredentials())
+	} else if config.CAFile != "" && config.ClientCertificateFile != "" && config.ClientKeyFile != "" {
 		transportCredentials, err := loadTLSCredentials(config)
 		if err != nil {
 			return nil, err
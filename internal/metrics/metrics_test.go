@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRegistry(t *testing.T) *Registry {
+	old := DefaultRegistry
+	DefaultRegistry = NewRegistry()
+	t.Cleanup(func() { DefaultRegistry = old })
+	return DefaultRegistry
+}
+
+func TestCounterText(t *testing.T) {
+	r := newTestRegistry(t)
+	c := NewCounter("test_total", "Test counter.", "command")
+	c.Inc("ls")
+	c.Add(2, "echo \"hi\"")
+
+	var buf bytes.Buffer
+	assert.NoError(t, r.WriteText(&buf))
+	assert.Equal(t, `# HELP test_total Test counter.
+# TYPE test_total counter
+test_total{command="echo \"hi\""} 2
+test_total{command="ls"} 1
+`, buf.String())
+	assert.Equal(t, float64(1), c.Value("ls"))
+}
+
+func TestGaugeWithoutLabels(t *testing.T) {
+	r := newTestRegistry(t)
+	g := NewGauge("test_running", "Test gauge.")
+
+	var buf bytes.Buffer
+	assert.NoError(t, r.WriteText(&buf))
+	assert.Contains(t, buf.String(), "test_running 0\n")
+
+	g.Inc()
+	g.Inc()
+	g.Dec()
+
+	buf.Reset()
+	assert.NoError(t, r.WriteText(&buf))
+	assert.Contains(t, buf.String(), "test_running 1\n")
+}
+
+func TestHistogramText(t *testing.T) {
+	r := newTestRegistry(t)
+	h := NewHistogram("test_seconds", "Test histogram.", []float64{1, 5}, "method")
+	h.Observe(0.5, "a")
+	h.Observe(3, "a")
+	h.Observe(10, "a")
+
+	var buf bytes.Buffer
+	assert.NoError(t, r.WriteText(&buf))
+	assert.Equal(t, `# HELP test_seconds Test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{method="a",le="1"} 1
+test_seconds_bucket{method="a",le="5"} 2
+test_seconds_bucket{method="a",le="+Inf"} 3
+test_seconds_sum{method="a"} 13.5
+test_seconds_count{method="a"} 3
+`, buf.String())
+}
+
+func TestWrongLabelCount(t *testing.T) {
+	newTestRegistry(t)
+	c := NewCounter("test_total", "Test counter.", "command")
+
+	assert.Panics(t, func() { c.Inc() })
+}
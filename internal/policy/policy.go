@@ -0,0 +1,270 @@
+package policy
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/supby/job-worker/internal/workerlib/job"
+	"gopkg.in/yaml.v2"
+)
+
+// Effect is result of matching rule
+type Effect string
+
+const (
+	Allow Effect = "allow"
+	Deny  Effect = "deny"
+)
+
+// Rule matches started commands, all conditions which are set have to match
+type Rule struct {
+	// Name is reported when rule decides, #<position> when empty
+	Name   string
+	Effect Effect
+	// Roles match client with any of them, any client when empty
+	Roles []string
+	// Commands are glob patterns of executable path resolved with exec.LookPath and
+	// with symlinks evaluated, e.g. "/usr/bin/*". Patterns without slash match base
+	// name of executable, e.g. "rm". Symlinks in patterns are evaluated too, so that
+	// "/bin/rm" matches "/usr/bin/rm" on merged /usr systems. Deny rules match path
+	// before symlinks are evaluated as well.
+	Commands []string
+	// Arguments is regular expression matched against arguments joined by spaces.
+	// It is a convenience matcher, not a security control: argument boundaries are
+	// lost, e.g. ["-rf", "/"], ["-r", "-f", "/"] and ["-rf /"] are different
+	// commands but deny rule "-rf /" matches only some of them.
+	Arguments string
+	// MaxTimeout, MaxMemoryMB and MaxCPUSeconds match commands with the limit set and not higher
+	MaxTimeout    time.Duration
+	MaxMemoryMB   uint64
+	MaxCPUSeconds uint64
+}
+
+// Config is the policy section of server configuration
+type Config struct {
+	// Default is effect when no rule matches, allow by default
+	Default Effect
+	// Rules are evaluated in order, the first matching rule decides
+	Rules []Rule
+}
+
+// Request is a command started by client
+type Request struct {
+	Roles     []string
+	Command   string
+	Arguments []string
+	Limits    *job.Limits
+}
+
+// Decision is result of policy evaluation
+type Decision struct {
+	Allowed bool
+	// Rule is name of matching rule, empty when default effect applied
+	Rule string
+	// Path is resolved executable path
+	Path string
+	// Err is set when executable can't be resolved, such command is denied
+	Err error
+}
+
+func (d Decision) String() string {
+	if d.Err != nil {
+		return fmt.Sprintf("denied, %v", d.Err)
+	}
+	effect := "denied"
+	if d.Allowed {
+		effect = "allowed"
+	}
+	if d.Rule == "" {
+		return fmt.Sprintf("%v by default policy", effect)
+	}
+	return fmt.Sprintf("%v by policy rule %q", effect, d.Rule)
+}
+
+type rule struct {
+	Rule
+	arguments *regexp.Regexp
+}
+
+// Policy decides which commands clients can start. Nil policy allows everything.
+type Policy struct {
+	defaultEffect Effect
+	rules         []rule
+}
+
+// New compiles policy of configuration
+func New(conf Config) (*Policy, error) {
+	p := &Policy{defaultEffect: conf.Default}
+	if p.defaultEffect == "" {
+		p.defaultEffect = Allow
+	}
+	if p.defaultEffect != Allow && p.defaultEffect != Deny {
+		return nil, fmt.Errorf("invalid default policy effect %q", conf.Default)
+	}
+
+	for i, r := range conf.Rules {
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("#%d", i+1)
+		}
+		if r.Effect != Allow && r.Effect != Deny {
+			return nil, fmt.Errorf("invalid effect %q of policy rule %q", r.Effect, r.Name)
+		}
+		// higher values would wrap around when converted to bytes
+		if r.MaxMemoryMB > math.MaxUint64>>20 {
+			return nil, fmt.Errorf("invalid maxmemorymb of policy rule %q", r.Name)
+		}
+		compiled := rule{Rule: r}
+		compiled.Commands = make([]string, len(r.Commands))
+		for i, pattern := range r.Commands {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid command pattern %q of policy rule %q", pattern, r.Name)
+			}
+			compiled.Commands[i] = resolvePattern(pattern)
+		}
+		if r.Arguments != "" {
+			var err error
+			if compiled.arguments, err = regexp.Compile(r.Arguments); err != nil {
+				return nil, fmt.Errorf("invalid arguments pattern of policy rule %q: %w", r.Name, err)
+			}
+		}
+		p.rules = append(p.rules, compiled)
+	}
+	return p, nil
+}
+
+// Evaluate returns decision of the first rule matching request or default effect
+func (p *Policy) Evaluate(r Request) Decision {
+	found, resolved, err := resolve(r.Command)
+	if p == nil {
+		return Decision{Allowed: true, Path: resolved}
+	}
+	if err != nil {
+		return Decision{Path: r.Command, Err: err}
+	}
+
+	for _, rule := range p.rules {
+		if rule.matches(r, found, resolved) {
+			return Decision{Allowed: rule.Effect == Allow, Rule: rule.Name, Path: resolved}
+		}
+	}
+	return Decision{Allowed: p.defaultEffect == Allow, Path: resolved}
+}
+
+// resolve returns absolute path of executable found with exec.LookPath and the
+// same path with symlinks evaluated, name is returned as is when it can't be resolved
+func resolve(name string) (found string, resolved string, err error) {
+	found, err = exec.LookPath(name)
+	if err != nil {
+		return name, name, err
+	}
+	if found, err = filepath.Abs(found); err != nil {
+		return name, name, err
+	}
+	if resolved, err = filepath.EvalSymlinks(found); err != nil {
+		return name, name, err
+	}
+	return found, resolved, nil
+}
+
+// resolvePattern evaluates symlinks of command pattern, only directory is evaluated
+// when base name has wildcards. Pattern is returned as is when it has wildcards in
+// directory or it doesn't exist.
+func resolvePattern(pattern string) string {
+	if !strings.Contains(pattern, "/") {
+		return pattern
+	}
+	if !hasWildcards(pattern) {
+		if resolved, err := filepath.EvalSymlinks(pattern); err == nil {
+			return resolved
+		}
+	}
+	dir, base := path.Split(pattern)
+	if hasWildcards(dir) {
+		return pattern
+	}
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return pattern
+	}
+	return path.Join(resolved, base)
+}
+
+func hasWildcards(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[\`)
+}
+
+func (r rule) matches(req Request, found string, resolved string) bool {
+	if len(r.Roles) > 0 && !anyOf(r.Roles, req.Roles) {
+		return false
+	}
+	// symlink must not get command past deny rule, nor into allow rule
+	if len(r.Commands) > 0 && !matchesCommand(r.Commands, resolved) &&
+		(r.Effect == Allow || !matchesCommand(r.Commands, found)) {
+		return false
+	}
+	if r.arguments != nil && !r.arguments.MatchString(strings.Join(req.Arguments, " ")) {
+		return false
+	}
+
+	var limits job.Limits
+	if req.Limits != nil {
+		limits = *req.Limits
+	}
+	if r.MaxTimeout > 0 && (limits.Timeout <= 0 || limits.Timeout > r.MaxTimeout) {
+		return false
+	}
+	if r.MaxMemoryMB > 0 && (limits.MaxMemoryBytes == 0 || limits.MaxMemoryBytes > r.MaxMemoryMB<<20) {
+		return false
+	}
+	if r.MaxCPUSeconds > 0 && (limits.MaxCPUSeconds == 0 || limits.MaxCPUSeconds > r.MaxCPUSeconds) {
+		return false
+	}
+	return true
+}
+
+func matchesCommand(patterns []string, resolved string) bool {
+	for _, pattern := range patterns {
+		name := resolved
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(resolved)
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func anyOf(values []string, candidates []string) bool {
+	for _, v := range values {
+		for _, c := range candidates {
+			if v == c {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReadFromYaml reads policy section of server configuration file
+func ReadFromYaml(filename string) (Config, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return Config{}, err
+	}
+
+	var cfg struct {
+		Policy Config
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return Config{}, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+	return cfg.Policy, nil
+}
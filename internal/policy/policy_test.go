@@ -0,0 +1,131 @@
+package policy
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/supby/job-worker/internal/workerlib/job"
+)
+
+func TestEvaluate(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	assert.NoError(t, err)
+	sh, err = filepath.EvalSymlinks(sh)
+	assert.NoError(t, err)
+
+	p, err := New(Config{
+		Default: Deny,
+		Rules: []Rule{
+			{Name: "no-force", Effect: Deny, Arguments: `(^| )--force( |$)`},
+			{Name: "admins", Effect: Allow, Roles: []string{"admin"}},
+			{Name: "limited-shell", Effect: Allow, Roles: []string{"full"}, Commands: []string{filepath.Dir(sh) + "/*"}, MaxTimeout: time.Hour},
+			{Name: "echo", Effect: Allow, Roles: []string{"full"}, Commands: []string{"ech?"}},
+		},
+	})
+	assert.NoError(t, err)
+
+	for _, tc := range []struct {
+		request  Request
+		decision string
+	}{
+		{Request{Roles: []string{"admin"}, Command: "rm", Arguments: []string{"-r", "--force", "/tmp/x"}}, `denied by policy rule "no-force"`},
+		{Request{Roles: []string{"admin"}, Command: "rm", Arguments: []string{"--forced"}}, `allowed by policy rule "admins"`},
+		{Request{Roles: []string{"full"}, Command: "sh", Limits: &job.Limits{Timeout: time.Minute}}, `allowed by policy rule "limited-shell"`},
+		{Request{Roles: []string{"full"}, Command: sh, Limits: &job.Limits{Timeout: 2 * time.Hour}}, "denied by default policy"},
+		{Request{Roles: []string{"full"}, Command: "sh"}, "denied by default policy"},
+		{Request{Roles: []string{"read"}, Command: "sh", Limits: &job.Limits{Timeout: time.Minute}}, "denied by default policy"},
+		{Request{Roles: []string{"full"}, Command: "no-such-command"}, `denied, exec: "no-such-command": executable file not found in $PATH`},
+		{Request{Roles: []string{"full"}, Command: "echo"}, `allowed by policy rule "echo"`},
+	} {
+		assert.Equal(t, tc.decision, p.Evaluate(tc.request).String(), tc.request)
+	}
+
+	d := p.Evaluate(Request{Roles: []string{"full"}, Command: "sh", Limits: &job.Limits{Timeout: time.Minute}})
+	assert.Equal(t, sh, d.Path)
+
+	var nilPolicy *Policy
+	assert.True(t, nilPolicy.Evaluate(Request{Command: "rm"}).Allowed)
+}
+
+func TestEvaluateSymlinks(t *testing.T) {
+	trueCmd, err := exec.LookPath("true")
+	assert.NoError(t, err)
+	trueCmd, err = filepath.EvalSymlinks(trueCmd)
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	link := filepath.Join(dir, "harmless")
+	assert.NoError(t, os.Symlink(trueCmd, link))
+	linkDir := filepath.Join(dir, "bin")
+	assert.NoError(t, os.Symlink(filepath.Dir(trueCmd), linkDir))
+
+	for _, tc := range []struct {
+		rules    []Rule
+		command  string
+		decision string
+	}{
+		// deny rule on real path can't be bypassed through symlink
+		{[]Rule{{Name: "no-true", Effect: Deny, Commands: []string{trueCmd}}}, link, `denied by policy rule "no-true"`},
+		// nor by symlink in pattern's directory
+		{[]Rule{{Name: "no-true", Effect: Deny, Commands: []string{filepath.Join(linkDir, filepath.Base(trueCmd))}}}, trueCmd, `denied by policy rule "no-true"`},
+		// deny rule on symlink
+		{[]Rule{{Name: "no-harmless", Effect: Deny, Commands: []string{"harmless"}}}, link, `denied by policy rule "no-harmless"`},
+		// allow rule is not reached through symlink
+		{[]Rule{{Name: "tmp", Effect: Allow, Commands: []string{dir + "/*"}}, {Name: "rest", Effect: Deny}}, link, `denied by policy rule "rest"`},
+	} {
+		p, err := New(Config{Rules: tc.rules})
+		assert.NoError(t, err)
+		assert.Equal(t, tc.decision, p.Evaluate(Request{Command: tc.command}).String(), tc.rules)
+	}
+}
+
+func TestUnnamedRule(t *testing.T) {
+	p, err := New(Config{Rules: []Rule{{Effect: Allow, Roles: []string{"full"}}, {Effect: Deny}}})
+	assert.NoError(t, err)
+	assert.Equal(t, `denied by policy rule "#2"`, p.Evaluate(Request{Command: "ls"}).String())
+	assert.Equal(t, "allowed by default policy", Decision{Allowed: true}.String())
+}
+
+func TestInvalidPolicy(t *testing.T) {
+	for _, conf := range []Config{
+		{Default: "maybe"},
+		{Rules: []Rule{{Name: "no-effect"}}},
+		{Rules: []Rule{{Effect: Deny, Commands: []string{"/usr/bin/["}}}},
+		{Rules: []Rule{{Effect: Deny, Arguments: "(--force"}}},
+		{Rules: []Rule{{Effect: Allow, MaxMemoryMB: 1 << 44}}},
+	} {
+		_, err := New(conf)
+		assert.Error(t, err)
+	}
+}
+
+func TestReadFromYaml(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "server_config.yaml")
+	assert.NoError(t, os.WriteFile(configFile, []byte(`
+endpoint: "localhost:5001"
+policy:
+  default: deny
+  rules:
+    - name: read-logs
+      effect: allow
+      roles: ["full"]
+      commands: ["/usr/bin/tail"]
+      arguments: "^-n [0-9]+ /var/log/"
+      maxtimeout: 1m
+`), 0600))
+
+	conf, err := ReadFromYaml(configFile)
+	assert.NoError(t, err)
+	assert.Equal(t, Config{Default: Deny, Rules: []Rule{{
+		Name:       "read-logs",
+		Effect:     Allow,
+		Roles:      []string{"full"},
+		Commands:   []string{"/usr/bin/tail"},
+		Arguments:  "^-n [0-9]+ /var/log/",
+		MaxTimeout: time.Minute,
+	}}}, conf)
+}
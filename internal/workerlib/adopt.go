@@ -0,0 +1,42 @@
+package workerlib
+
+import (
+	"log"
+	"os"
+
+	"github.com/supby/job-worker/internal/workerlib/job"
+)
+
+// adoptJobs rebuilds jobs recorded in state directory by a previous worker
+func (w *worker) adoptJobs() {
+	if err := os.MkdirAll(w.stateDir, 0700); err != nil {
+		log.Printf("[worker] failed to create state directory, jobs won't be recorded: %v", err)
+		w.stateDir = ""
+		return
+	}
+
+	states, err := job.ReadStates(w.stateDir)
+	if err != nil {
+		log.Printf("[worker] failed to read jobs state: %v", err)
+		return
+	}
+
+	for _, state := range states {
+		j, err := job.Adopt(state, w.stateDir)
+		if err != nil {
+			log.Printf("[worker] failed to re-adopt job %v: %v", state.ID, err)
+			continue
+		}
+		w.jobs.Store(j.GetID(), j)
+
+		select {
+		case <-j.Done():
+			log.Printf("[worker] Finished job restored: %v", j.GetID())
+		default:
+			w.running.Add(1)
+			jobsRunning.Inc()
+			go w.watchJob(&jobEntry{job: j, command: state.Command, started: true, index: -1})
+			log.Printf("[worker] Job re-adopted: %v, pid: %v", j.GetID(), state.PID)
+		}
+	}
+}
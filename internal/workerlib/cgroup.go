@@ -0,0 +1,16 @@
+package workerlib
+
+import (
+	"log"
+	"os"
+
+	"github.com/supby/job-worker/internal/workerlib/job"
+)
+
+// initCgroupDir creates cgroup of worker's jobs, cgroups aren't used when it is not on cgroup v2 filesystem
+func (w *worker) initCgroupDir() {
+	if err := os.MkdirAll(w.cgroupDir, 0755); err != nil || !job.IsCgroup2(w.cgroupDir) {
+		log.Printf("[worker] %v is not a writable cgroup v2 directory, jobs will be paused with signals", w.cgroupDir)
+		w.cgroupDir = ""
+	}
+}
@@ -0,0 +1,117 @@
+package workerlib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/supby/job-worker/internal/workerlib/job"
+)
+
+// ErrIdempotencyKeyReused is returned when idempotency key of Start was already used with a different command
+var ErrIdempotencyKeyReused = errors.New("idempotency key was used for a different command")
+
+// defaultIdempotencyWindow is how long idempotency keys are remembered when window is not configured
+const defaultIdempotencyWindow = 10 * time.Minute
+
+// WithIdempotencyKey makes Start idempotent: repeated Start with the same key and
+// command returns ID of the job started by the first call, empty key is ignored
+func WithIdempotencyKey(key string) StartOption {
+	return func(o *startOptions) {
+		o.idempotencyKey = key
+	}
+}
+
+// idempotentStart is result of Start with idempotency key, done is closed when
+// the start is finished
+type idempotentStart struct {
+	fingerprint string
+	expires     time.Time
+	done        chan struct{}
+	jobID       uuid.UUID
+	err         error
+}
+
+// idempotencyCache remembers starts by idempotency key for window
+type idempotencyCache struct {
+	mtx    sync.Mutex
+	window time.Duration
+	starts map[string]*idempotentStart
+	now    func() time.Time
+}
+
+func newIdempotencyCache(window time.Duration) *idempotencyCache {
+	if window <= 0 {
+		window = defaultIdempotencyWindow
+	}
+	return &idempotencyCache{
+		window: window,
+		starts: map[string]*idempotentStart{},
+		now:    time.Now,
+	}
+}
+
+// start runs startFn once per key, repeated calls wait for the first one and
+// share its result. Failed starts are not remembered, so they can be retried.
+func (c *idempotencyCache) start(ctx context.Context, key string, command job.Command, startFn func() (uuid.UUID, error)) (uuid.UUID, error) {
+	fingerprint, err := commandFingerprint(command)
+	if err != nil {
+		return job.NilJobId, err
+	}
+
+	c.mtx.Lock()
+	c.expire()
+	s, ok := c.starts[key]
+	if !ok {
+		s = &idempotentStart{fingerprint: fingerprint, done: make(chan struct{})}
+		c.starts[key] = s
+	}
+	c.mtx.Unlock()
+
+	if ok {
+		if s.fingerprint != fingerprint {
+			return job.NilJobId, ErrIdempotencyKeyReused
+		}
+		select {
+		case <-ctx.Done():
+			return job.NilJobId, ctx.Err()
+		case <-s.done:
+			return s.jobID, s.err
+		}
+	}
+
+	s.jobID, s.err = startFn()
+
+	c.mtx.Lock()
+	if s.err != nil {
+		delete(c.starts, key)
+	} else {
+		s.expires = c.now().Add(c.window)
+	}
+	c.mtx.Unlock()
+	close(s.done)
+
+	return s.jobID, s.err
+}
+
+// expire removes keys older than window, pending starts are kept
+func (c *idempotencyCache) expire() {
+	now := c.now()
+	for key, s := range c.starts {
+		if !s.expires.IsZero() && now.After(s.expires) {
+			delete(c.starts, key)
+		}
+	}
+}
+
+// commandFingerprint identifies command payload, map keys are encoded sorted
+func commandFingerprint(command job.Command) (string, error) {
+	data, err := json.Marshal(command)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,193 @@
+package job
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// cgroupFreezeTimeout limits how long freezing or thawing of cgroup is waited for
+const cgroupFreezeTimeout = 5 * time.Second
+
+// cgroupPollInterval is how often cgroup.events is checked while cgroup is being frozen
+const cgroupPollInterval = 10 * time.Millisecond
+
+// maxTreeScans limits how many times process tree is scanned for processes forked while it is being stopped
+const maxTreeScans = 10
+
+// IsCgroup2 reports whether dir is on cgroup v2 filesystem
+func IsCgroup2(dir string) bool {
+	var st unix.Statfs_t
+	return unix.Statfs(dir, &st) == nil && st.Type == unix.CGROUP2_SUPER_MAGIC
+}
+
+// openCgroup creates cgroup of job in dir, processes started with sysProcAttr are placed in it
+func (j *job) openCgroup(dir string) error {
+	path := filepath.Join(dir, j.id.String())
+	if err := os.Mkdir(path, 0755); err != nil && !os.IsExist(err) {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+	j.cgroup = path
+	j.cgroupFile = f
+	return nil
+}
+
+// sysProcAttr adds cgroup of job to attributes of job process, so that the
+// process is started in the cgroup together with all its future children
+func (j *job) sysProcAttr(attr *syscall.SysProcAttr) *syscall.SysProcAttr {
+	if j.cgroupFile == nil {
+		return attr
+	}
+	if attr == nil {
+		attr = &syscall.SysProcAttr{}
+	}
+	attr.UseCgroupFD = true
+	attr.CgroupFD = int(j.cgroupFile.Fd())
+	return attr
+}
+
+// closeCgroup releases cgroup of finished job, cgroup is kept while it has processes
+func (j *job) closeCgroup() {
+	if j.cgroupFile != nil {
+		j.cgroupFile.Close()
+		j.cgroupFile = nil
+	}
+	if j.cgroup != "" {
+		os.Remove(j.cgroup)
+	}
+}
+
+// removeCgroup removes cgroup of finished job
+func (j *job) removeCgroup() error {
+	if j.cgroup == "" {
+		return nil
+	}
+	if err := os.Remove(j.cgroup); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove cgroup: %w", err)
+	}
+	return nil
+}
+
+// freeze freezes or thaws process tree of job
+func (j *job) freeze(frozen bool) error {
+	if j.cgroup != "" {
+		return freezeCgroup(j.cgroup, frozen)
+	}
+	sig := syscall.SIGCONT
+	if frozen {
+		sig = syscall.SIGSTOP
+	}
+	return signalTree(j.process.Pid, sig)
+}
+
+// freezeCgroup writes cgroup.freeze and waits until cgroup.events reports the new state
+func freezeCgroup(path string, frozen bool) error {
+	value := "0"
+	if frozen {
+		value = "1"
+	}
+	if err := os.WriteFile(filepath.Join(path, "cgroup.freeze"), []byte(value), 0); err != nil {
+		return err
+	}
+
+	expected := []byte("frozen " + value)
+	deadline := time.Now().Add(cgroupFreezeTimeout)
+	for {
+		events, err := os.ReadFile(filepath.Join(path, "cgroup.events"))
+		if err != nil {
+			return err
+		}
+		for _, line := range bytes.Split(events, []byte("\n")) {
+			if bytes.Equal(line, expected) {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return errors.New("timed out waiting for cgroup freezer")
+		}
+		time.Sleep(cgroupPollInterval)
+	}
+}
+
+// signalTree sends sig to process and all its descendants. Descendants are
+// found by parent PID in /proc, so processes which were reparented, e.g.
+// daemons, are missed. Tree is scanned again while new processes are found,
+// stopped processes can't fork anymore.
+func signalTree(pid int, sig syscall.Signal) error {
+	signaled := map[int]bool{}
+	for i := 0; i < maxTreeScans; i++ {
+		tree, err := processTree(pid)
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, p := range tree {
+			if signaled[p] {
+				continue
+			}
+			found = true
+			signaled[p] = true
+			if err := unix.Kill(p, sig); err != nil && !errors.Is(err, unix.ESRCH) {
+				return err
+			}
+		}
+		if !found {
+			break
+		}
+	}
+	return nil
+}
+
+// processTree returns pid and PIDs of all its descendants
+func processTree(pid int) ([]int, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	children := map[int][]int{}
+	for _, e := range entries {
+		child, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		if parent, err := parentPID(child); err == nil {
+			children[parent] = append(children[parent], child)
+		}
+	}
+
+	tree := []int{pid}
+	for i := 0; i < len(tree); i++ {
+		tree = append(tree, children[tree[i]]...)
+	}
+	return tree, nil
+}
+
+// parentPID returns parent PID of process from /proc/<pid>/stat
+func parentPID(pid int) (int, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+	// command name in parentheses can contain spaces, parent PID is the 4th field
+	end := bytes.LastIndexByte(data, ')')
+	if end < 0 {
+		return 0, errors.New("invalid process stat")
+	}
+	fields := bytes.Fields(data[end+1:])
+	if len(fields) < 2 {
+		return 0, errors.New("invalid process stat")
+	}
+	return strconv.Atoi(string(fields[1]))
+}
@@ -0,0 +1,33 @@
+//go:build !linux
+
+package job
+
+import (
+	"errors"
+	"syscall"
+)
+
+// ErrPauseNotSupported is returned by Pause on platforms other than linux
+var ErrPauseNotSupported = errors.New("pausing jobs is not supported on this platform")
+
+func IsCgroup2(dir string) bool {
+	return false
+}
+
+func (j *job) openCgroup(dir string) error {
+	return errors.New("cgroups are not supported on this platform")
+}
+
+func (j *job) sysProcAttr(attr *syscall.SysProcAttr) *syscall.SysProcAttr {
+	return attr
+}
+
+func (j *job) closeCgroup() {}
+
+func (j *job) removeCgroup() error {
+	return nil
+}
+
+func (j *job) freeze(frozen bool) error {
+	return ErrPauseNotSupported
+}
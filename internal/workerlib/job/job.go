@@ -2,22 +2,47 @@ package job
 
 import (
 	"context"
+	"errors"
+	"io"
 	"log"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"sync"
 	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/supby/job-worker/internal/workerlib/joblogger"
 )
 
+// ErrNoInput is returned when input is requested for non-interactive job
+var ErrNoInput = errors.New("job is not interactive")
+
+// ErrNotQueued is returned by Start when job was already started or stopped
+var ErrNotQueued = errors.New("job is not queued")
+
 // Job interface encapsulates logic for one job.
 type Job interface {
 	GetID() uuid.UUID
+	// Start starts process of job created by New
+	Start() error
 	Stop() error
+	// Terminate sends SIGTERM to job
+	Terminate() error
+	// Preempt sends SIGTERM to job and records it as PREEMPTED, job still running after grace is killed
+	Preempt(grace time.Duration) error
+	// Pause freezes process tree of running job, Resume thaws it
+	Pause() error
+	Resume() error
 	GetStatus() *Status
-	GetStream(ctx context.Context) <-chan []byte
+	GetStream(ctx context.Context) (<-chan []byte, error)
+	GetStreamFrom(ctx context.Context, offset int64) (<-chan []byte, error)
+	GetInput() (io.WriteCloser, error)
+	Resize(size TerminalSize) error
+	// Done is closed when job process has finished
+	Done() <-chan struct{}
 	Cleanup(ctx context.Context) error
 }
 
@@ -26,97 +51,399 @@ type job struct {
 	cmd    *exec.Cmd
 	status atomic.Value
 	logger joblogger.JobLogger
+	stdin  io.WriteCloser
 	mtx    sync.Mutex
+	done   chan struct{}
+
+	// process is set for started and re-adopted jobs, cmd only for started ones
+	process *os.Process
+
+	// set only for jobs running in pseudo-terminal
+	ptmx       *os.File
+	outputDone chan struct{}
+
+	// set only for jobs with state directory, see WithStateDir
+	state      *State
+	stateFile  string
+	detachable bool
+
+	// nextAttemptStop is set while job waits for the next attempt, closing it cancels the attempt
+	nextAttemptStop chan struct{}
+
+	// timeout stops job which exceeded Limits.Timeout, timeoutLeft is the rest of
+	// timeout when timer was armed at timeoutArmed
+	timeout      *time.Timer
+	timeoutLeft  time.Duration
+	timeoutArmed time.Time
+	timedOut     atomic.Bool
+
+	// command and stateDir are kept until job is started, queued is true until then
+	command  Command
+	stateDir string
+	queued   bool
+
+	// cgroup is set for jobs running in their own cgroup, see WithCgroupDir
+	cgroupDir  string
+	cgroup     string
+	cgroupFile *os.File
+	paused     bool
+}
+
+// Option configures job started by StartNew
+type Option func(*options)
+
+type options struct {
+	stateDir  string
+	cgroupDir string
+}
+
+// WithStateDir keeps job's state and output log in dir, so job can be re-adopted
+// by Adopt after server restart. Output of non-interactive jobs is written to the
+// log file by the job process directly and the process gets its own process group,
+// so it outlives the server.
+func WithStateDir(dir string) Option {
+	return func(o *options) {
+		o.stateDir = dir
+	}
+}
+
+// WithCgroupDir runs job in its own cgroup created in dir, which has to be on
+// cgroup v2 filesystem. Whole process tree of the job is then paused by cgroup
+// freezer, otherwise processes are found by parent PID and get SIGSTOP.
+func WithCgroupDir(dir string) Option {
+	return func(o *options) {
+		o.cgroupDir = dir
+	}
+}
+
+// StartNew creates job and starts its process
+func StartNew(command Command, opts ...Option) (Job, error) {
+	j, err := New(command, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := j.Start(); err != nil {
+		return nil, err
+	}
+	return j, nil
 }
 
-func StartNew(command Command) (Job, error) {
+// New creates job in QUEUED status, its process is started by Start. Job can be
+// stopped before it is started, its output is empty then.
+func New(command Command, opts ...Option) (Job, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if command.Retry != nil && command.Restart != nil {
+		return nil, ErrRetryAndRestart
+	}
+	if (command.Retry != nil || command.Restart != nil) && (command.Interactive || command.TTY) {
+		return nil, ErrRetryInteractive
+	}
+
 	jobID, err := uuid.NewRandom()
 	if err != nil {
 		return nil, err
 	}
 
-	logger, err := joblogger.New(jobID)
+	var logger joblogger.JobLogger
+	if o.stateDir != "" {
+		logger, err = joblogger.Open(jobID, filepath.Join(o.stateDir, jobID.String()+".log"))
+	} else {
+		logger, err = joblogger.New(jobID)
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	j := &job{
-		id:     jobID,
-		logger: logger,
+		id:         jobID,
+		logger:     logger,
+		done:       make(chan struct{}),
+		detachable: o.stateDir != "" && !command.Interactive && !command.TTY,
+		command:    command,
+		stateDir:   o.stateDir,
+		cgroupDir:  o.cgroupDir,
+		queued:     true,
 	}
-
-	status := &Status{
+	j.status.Store(&Status{
 		CommandName: command.Name,
 		Arguments:   command.Arguments,
-		StatusCode:  STARTED,
+		StatusCode:  QUEUED,
+		Labels:      command.Labels,
+		Priority:    command.Priority,
+	})
+	return j, nil
+}
+
+func (j *job) Start() error {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	if !j.queued {
+		return ErrNotQueued
 	}
-	j.status.Store(status)
+	j.queued = false
+	command := j.command
 
-	cmd := exec.Command(command.Name, command.Arguments...)
-	cmd.Stdout = j.logger
-	cmd.Stderr = j.logger
+	j.updateStatus(func(s *Status) {
+		s.StatusCode = STARTED
+	})
 
-	j.cmd = cmd
+	if j.cgroupDir != "" {
+		if err := j.openCgroup(j.cgroupDir); err != nil {
+			log.Printf("[job] failed to create cgroup, job will be paused with signals: %v, job: %v", err, j.id)
+		}
+	}
 
-	if err := cmd.Start(); err != nil {
+	cmd, err := newCmd(command)
+	if err == nil {
+		j.cmd = cmd
+		switch {
+		case command.TTY:
+			err = j.startPTY(command.TerminalSize)
+		case j.detachable:
+			err = j.startDetachable()
+		default:
+			err = j.start(command)
+		}
+	}
+	if err != nil {
+		j.closeCgroup()
 		j.updateStatus(func(s *Status) {
 			s.StatusCode = ERROR
 			s.Error = err.Error()
+			s.FinishedAt = time.Now()
 		})
-		return nil, err
+		close(j.done)
+		return err
 	}
 
+	j.process = cmd.Process
 	j.updateStatus(func(s *Status) {
 		s.StatusCode = RUNNING
+		s.StartedAt = time.Now()
 	})
+	j.startAttempt(0)
+
+	if j.stateDir != "" {
+		j.saveInitialState(j.stateDir, command)
+	}
+	if j.detachable {
+		go j.logger.WatchFile(j.done)
+	}
 
-	go j.updateJobStatus()
+	j.startTimeout(command.Limits)
+	go j.updateJobStatus(command)
 
-	return j, nil
+	return nil
+}
+
+func (j *job) start(command Command) error {
+	j.cmd.Stdout = j.logger
+	j.cmd.Stderr = j.logger
+	j.cmd.SysProcAttr = j.sysProcAttr(nil)
+
+	if command.Interactive {
+		stdin, err := j.cmd.StdinPipe()
+		if err != nil {
+			return err
+		}
+		j.stdin = stdin
+	}
+
+	return j.cmd.Start()
+}
+
+// startDetachable starts command writing output to log file directly, so output
+// is not lost when server exits
+func (j *job) startDetachable() error {
+	output, err := os.OpenFile(j.logger.Name(), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	defer output.Close()
+
+	j.cmd.Stdout = output
+	j.cmd.Stderr = output
+	// signals sent to server's process group, e.g. Ctrl-C, don't reach the job
+	j.cmd.SysProcAttr = j.sysProcAttr(&syscall.SysProcAttr{Setpgid: true})
+
+	return j.cmd.Start()
 }
 
 func (j *job) GetID() uuid.UUID {
 	return j.id
 }
 
-func (j *job) updateJobStatus() {
-	err := j.cmd.Wait()
+// updateJobStatus waits for job process, finished process is relaunched
+// according to retry or restart policy of command
+func (j *job) updateJobStatus(command Command) {
+	defer close(j.done)
+	defer j.saveFinalState()
+	defer j.closeCgroup()
+	defer j.stopTimeout()
+
+	var err error
+	var loop crashLoop
+	for {
+		err = j.cmd.Wait()
+		if j.ptmx != nil {
+			j.closePTY()
+		}
+		// process could be killed while it was paused
+		j.mtx.Lock()
+		j.unpause()
+		j.mtx.Unlock()
+		attempt := j.finishAttempt(j.cmd.ProcessState, err)
+		if stopped(j.GetStatus()) {
+			break
+		}
+		delay, crashLoop, ok := j.nextAttempt(command, attempt, &loop)
+		if !ok || !j.waitNextAttempt(delay, crashLoop) {
+			break
+		}
+		restartErr := j.restart(command)
+		j.mtx.Unlock()
+		if restartErr != nil {
+			log.Printf("[job] failed to restart job: %v, job: %v", restartErr, j.id)
+			j.updateStatus(func(s *Status) {
+				s.StatusCode = ERROR
+				s.Error = restartErr.Error()
+				s.FinishedAt = time.Now()
+			})
+			return
+		}
+	}
+
 	j.updateStatus(func(s *Status) {
 		s.ExitCode = j.cmd.ProcessState.ExitCode()
 		s.Exited = j.cmd.ProcessState.Exited()
-		if s.StatusCode != STOPPED {
+		s.FinishedAt = time.Now()
+		if !stopped(s) {
 			s.StatusCode = EXITED
 
-			log.Printf("[job] job exited: %x, exit code: %v", j.id[:], s.ExitCode)
+			log.Printf("[job] job exited: %v, exit code: %v", j.id, s.ExitCode)
 		}
 		if err != nil {
-			log.Printf("job] command execution failed: %v", err)
+			log.Printf("[job] command execution failed: %v, job: %v", err, j.id)
 			s.Error = err.Error()
 		}
+		if j.timedOut.Load() {
+			s.Error = ErrTimeout.Error()
+		}
 	})
 }
 
+func (j *job) Done() <-chan struct{} {
+	return j.done
+}
+
 func (j *job) Stop() error {
+	return j.signal(syscall.SIGKILL, STOPPED)
+}
+
+// Terminate asks job to exit with SIGTERM, unlike Stop job can handle it
+func (j *job) Terminate() error {
+	return j.signal(syscall.SIGTERM, STOPPED)
+}
+
+func (j *job) Preempt(grace time.Duration) error {
+	if err := j.signal(syscall.SIGTERM, PREEMPTED); err != nil {
+		return err
+	}
+	time.AfterFunc(grace, func() {
+		j.mtx.Lock()
+		defer j.mtx.Unlock()
+
+		select {
+		case <-j.done:
+			return
+		default:
+		}
+		if j.nextAttemptStop != nil {
+			return
+		}
+		log.Printf("[job] preempted job is still running after grace period, killing it: %v", j.id)
+		if err := j.process.Signal(syscall.SIGKILL); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			log.Printf("[job] failed to kill preempted job: %v, job: %v", err, j.id)
+		}
+	})
+	return nil
+}
+
+// signal sends sig to job process and records statusCode, STOPPED or PREEMPTED
+func (j *job) signal(sig syscall.Signal, statusCode byte) error {
 	j.mtx.Lock()
 	defer j.mtx.Unlock()
 
-	if j.cmd.ProcessState == nil || !j.cmd.ProcessState.Exited() {
+	select {
+	case <-j.done:
+		return nil
+	default:
+	}
+	if j.queued {
+		// process was never started
+		j.queued = false
+		j.updateStatus(func(s *Status) {
+			s.StatusCode = statusCode
+			s.FinishedAt = time.Now()
+		})
+		close(j.done)
+		return nil
+	}
+	if j.nextAttemptStop != nil {
+		// process isn't running, cancel the next attempt
 		j.updateStatus(func(s *Status) {
-			s.StatusCode = STOPPED
+			s.StatusCode = statusCode
 		})
-		return j.cmd.Process.Signal(syscall.SIGKILL)
+		close(j.nextAttemptStop)
+		j.nextAttemptStop = nil
+		return nil
 	}
+	// PID of re-adopted job could be reused by another process after job exited
+	if j.cmd == nil && !processAlive(j.process.Pid, j.state.ProcessStartTime) {
+		return nil
+	}
+
+	j.updateStatus(func(s *Status) {
+		s.StatusCode = statusCode
+	})
+	// process could exit right before it was signaled
+	if err := j.process.Signal(sig); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+	// paused process has to be thawed to handle the signal
+	j.unpause()
 	return nil
 }
 
+// stopped reports whether job was stopped or preempted, so its process is not relaunched
+func stopped(s *Status) bool {
+	return s.StatusCode == STOPPED || s.StatusCode == PREEMPTED
+}
+
 func (j *job) GetStatus() *Status {
 	return j.status.Load().(*Status)
 }
 
-func (j *job) GetStream(ctx context.Context) <-chan []byte {
+func (j *job) GetStream(ctx context.Context) (<-chan []byte, error) {
 	return j.logger.GetStream(ctx)
 }
 
+func (j *job) GetStreamFrom(ctx context.Context, offset int64) (<-chan []byte, error) {
+	return j.logger.GetStreamFrom(ctx, offset)
+}
+
+// GetInput returns writer connected to job's stdin, closing it sends EOF to the job
+func (j *job) GetInput() (io.WriteCloser, error) {
+	if j.stdin == nil {
+		return nil, ErrNoInput
+	}
+	return j.stdin, nil
+}
+
 func (j *job) updateStatus(updateFn func(*Status)) {
 	for {
 		oldStatus := j.status.Load().(*Status)
@@ -128,6 +455,20 @@ func (j *job) updateStatus(updateFn func(*Status)) {
 	}
 }
 
+// Cleanup removes job's output log and state once job is finished
 func (j *job) Cleanup(ctx context.Context) error {
-	return nil
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-j.done:
+		if err := j.removeCgroup(); err != nil {
+			return err
+		}
+		if j.stateFile != "" {
+			if err := os.Remove(j.stateFile); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		return j.logger.Close()
+	}
 }
@@ -0,0 +1,85 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// ErrTimeout is error of job which was stopped because it exceeded Limits.Timeout
+var ErrTimeout = errors.New("job exceeded timeout")
+
+// Limits restricts resources of job, zero value of every field means no limit.
+// Memory and CPU limits are set in job process before command is executed, they
+// are supported on linux only.
+type Limits struct {
+	// Timeout stops job running longer, retries and restarts are included
+	Timeout time.Duration
+	// MaxMemoryBytes limits virtual memory of job process (RLIMIT_AS)
+	MaxMemoryBytes uint64
+	// MaxCPUSeconds limits CPU time of job process (RLIMIT_CPU), process gets SIGXCPU and then SIGKILL
+	MaxCPUSeconds uint64
+}
+
+// newCmd creates process of command, Env is added to environment of the server
+func newCmd(command Command) (*exec.Cmd, error) {
+	cmd := exec.Command(command.Name, command.Arguments...)
+	if len(command.Env) > 0 {
+		cmd.Env = append(os.Environ(), command.Env...)
+	}
+	if limits := command.Limits; limits != nil && (limits.MaxMemoryBytes > 0 || limits.MaxCPUSeconds > 0) && cmd.Err == nil {
+		if err := limitCmd(cmd, limits); err != nil {
+			return nil, fmt.Errorf("failed to set limits: %w", err)
+		}
+	}
+	return cmd, nil
+}
+
+// startTimeout stops job once it runs longer than timeout of limits, time job is paused doesn't count
+func (j *job) startTimeout(limits *Limits) {
+	if limits == nil || limits.Timeout <= 0 {
+		return
+	}
+	j.timeoutLeft = limits.Timeout
+	j.armTimeout()
+}
+
+// armTimeout starts timer for the rest of timeout, j.mtx has to be locked
+func (j *job) armTimeout() {
+	j.timeoutArmed = time.Now()
+	j.timeout = time.AfterFunc(j.timeoutLeft, func() {
+		log.Printf("[job] job exceeded timeout, stopping it: %v", j.id)
+		j.timedOut.Store(true)
+		if err := j.Stop(); err != nil {
+			log.Printf("[job] failed to stop job after timeout: %v, job: %v", err, j.id)
+		}
+	})
+}
+
+// pauseTimeout stops timer of paused job, j.mtx has to be locked
+func (j *job) pauseTimeout() {
+	if j.timeout != nil && j.timeout.Stop() {
+		j.timeoutLeft -= time.Since(j.timeoutArmed)
+		j.timeout = nil
+	}
+}
+
+// resumeTimeout starts timer stopped by pauseTimeout, j.mtx has to be locked
+func (j *job) resumeTimeout() {
+	if j.timeout == nil && j.timeoutLeft > 0 && !j.timedOut.Load() {
+		j.armTimeout()
+	}
+}
+
+func (j *job) stopTimeout() {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	if j.timeout != nil {
+		j.timeout.Stop()
+	}
+	j.timeoutLeft = 0
+}
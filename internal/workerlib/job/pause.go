@@ -0,0 +1,84 @@
+package job
+
+import (
+	"errors"
+	"log"
+)
+
+// ErrNotRunning is returned when job process isn't running, e.g. job is queued or waits for retry
+var ErrNotRunning = errors.New("job is not running")
+
+// ErrNotPaused is returned by Resume when job isn't paused
+var ErrNotPaused = errors.New("job is not paused")
+
+// Pause freezes process tree of job with cgroup freezer or SIGSTOP, time job is
+// paused doesn't count toward its timeout. Pausing paused job does nothing.
+func (j *job) Pause() error {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	select {
+	case <-j.done:
+		return ErrNotRunning
+	default:
+	}
+	if j.paused {
+		return nil
+	}
+	if j.queued || j.nextAttemptStop != nil || stopped(j.GetStatus()) {
+		return ErrNotRunning
+	}
+	// PID of re-adopted job could be reused by another process after job exited
+	if j.cmd == nil && !processAlive(j.process.Pid, j.state.ProcessStartTime) {
+		return ErrNotRunning
+	}
+
+	if err := j.freeze(true); err != nil {
+		// some processes could be frozen already
+		j.freeze(false)
+		return err
+	}
+	j.paused = true
+	j.pauseTimeout()
+	j.updateStatus(func(s *Status) {
+		s.StatusCode = PAUSED
+	})
+	log.Printf("[job] job paused: %v", j.id)
+	return nil
+}
+
+func (j *job) Resume() error {
+	j.mtx.Lock()
+	defer j.mtx.Unlock()
+
+	if !j.paused {
+		return ErrNotPaused
+	}
+	if err := j.freeze(false); err != nil {
+		return err
+	}
+	j.paused = false
+	j.resumeTimeout()
+	j.updateStatus(func(s *Status) {
+		s.StatusCode = RUNNING
+	})
+	log.Printf("[job] job resumed: %v", j.id)
+	return nil
+}
+
+// unpause thaws paused job which is being stopped or whose process exited, j.mtx has to be locked
+func (j *job) unpause() {
+	if !j.paused {
+		return
+	}
+	if err := j.freeze(false); err != nil {
+		log.Printf("[job] failed to thaw job: %v, job: %v", err, j.id)
+	}
+	j.paused = false
+	j.resumeTimeout()
+	j.updateStatus(func(s *Status) {
+		if s.StatusCode == PAUSED {
+			s.StatusCode = RUNNING
+		}
+	})
+}
@@ -0,0 +1,149 @@
+package job
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// processPollInterval is how often re-adopted process is checked when pidfd is not available
+const processPollInterval = 500 * time.Millisecond
+
+// processStartTime returns start time of process in clock ticks since boot from /proc/<pid>/stat
+func processStartTime(pid int) (uint64, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+
+	// command name in parentheses can contain spaces, fields after it start with state (3rd field)
+	end := bytes.LastIndexByte(data, ')')
+	if end < 0 {
+		return 0, errors.New("invalid process stat")
+	}
+	fields := bytes.Fields(data[end+1:])
+	if len(fields) < 20 {
+		return 0, errors.New("invalid process stat")
+	}
+	if string(fields[0]) == "Z" {
+		return 0, errors.New("process is zombie")
+	}
+	return strconv.ParseUint(string(fields[19]), 10, 64)
+}
+
+// processAlive reports whether process with pid is still the one started at startTime
+func processAlive(pid int, startTime uint64) bool {
+	current, err := processStartTime(pid)
+	return err == nil && current == startTime
+}
+
+// waitProcess blocks until process, which doesn't have to be a child, exits
+func waitProcess(pid int, startTime uint64) {
+	fd, err := unix.PidfdOpen(pid, 0)
+	if err == nil {
+		defer unix.Close(fd)
+		// PID could be reused before pidfd was opened
+		if !processAlive(pid, startTime) {
+			return
+		}
+		fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+		for {
+			if _, err := unix.Poll(fds, -1); err != unix.EINTR {
+				return
+			}
+		}
+	}
+
+	ticker := time.NewTicker(processPollInterval)
+	defer ticker.Stop()
+	for processAlive(pid, startTime) {
+		<-ticker.C
+	}
+}
+
+const (
+	// limitsExecName is argv[0] of server executable started to execute command with limits
+	limitsExecName = "job-worker-limits"
+	// selfExe is executable of the running server
+	selfExe = "/proc/self/exe"
+)
+
+func init() {
+	if len(os.Args) > 4 && os.Args[0] == limitsExecName {
+		execWithLimits(os.Args[1], os.Args[2], os.Args[3], os.Args[4:])
+	}
+}
+
+// limitCmd makes cmd start server executable which sets resource limits of its
+// own process and then executes command, so that command never runs without them
+func limitCmd(cmd *exec.Cmd, limits *Limits) error {
+	if _, err := os.Stat(selfExe); err != nil {
+		return err
+	}
+	args := []string{
+		limitsExecName,
+		strconv.FormatUint(limits.MaxMemoryBytes, 10),
+		strconv.FormatUint(limits.MaxCPUSeconds, 10),
+		cmd.Path,
+	}
+	cmd.Args = append(args, cmd.Args...)
+	cmd.Path = selfExe
+	return nil
+}
+
+// execWithLimits sets limits of the current process and replaces it with
+// command, it runs in process started by limitCmd before anything else
+func execWithLimits(maxMemoryBytes, maxCPUSeconds, path string, argv []string) {
+	fail := func(err error) {
+		fmt.Fprintf(os.Stderr, "failed to execute %s: %v\n", path, err)
+		os.Exit(127)
+	}
+
+	memory, err := strconv.ParseUint(maxMemoryBytes, 10, 64)
+	if err != nil {
+		fail(err)
+	}
+	cpu, err := strconv.ParseUint(maxCPUSeconds, 10, 64)
+	if err != nil {
+		fail(err)
+	}
+	pathp, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		fail(err)
+	}
+	argvp, err := syscall.SlicePtrFromStrings(argv)
+	if err != nil {
+		fail(err)
+	}
+	envp, err := syscall.SlicePtrFromStrings(os.Environ())
+	if err != nil {
+		fail(err)
+	}
+
+	if cpu > 0 {
+		// hard limit is higher, so process gets SIGXCPU before it is killed
+		rlimit := unix.Rlimit{Cur: cpu, Max: cpu + 1}
+		if err := unix.Prlimit(0, unix.RLIMIT_CPU, &rlimit, nil); err != nil {
+			fail(err)
+		}
+	}
+	// memory limit can be lower than memory already mapped by this process, so
+	// nothing is allocated after it is set
+	if memory > 0 {
+		rlimit := unix.Rlimit{Cur: memory, Max: memory}
+		if err := unix.Prlimit(0, unix.RLIMIT_AS, &rlimit, nil); err != nil {
+			fail(err)
+		}
+	}
+	_, _, errno := syscall.RawSyscall(syscall.SYS_EXECVE,
+		uintptr(unsafe.Pointer(pathp)), uintptr(unsafe.Pointer(&argvp[0])), uintptr(unsafe.Pointer(&envp[0])))
+	fail(errno)
+}
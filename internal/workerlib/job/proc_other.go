@@ -0,0 +1,23 @@
+//go:build !linux
+
+package job
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// processStartTime is supported on linux only, jobs can't be re-adopted elsewhere
+func processStartTime(pid int) (uint64, error) {
+	return 0, errors.New("process start time is not supported on this platform")
+}
+
+func processAlive(pid int, startTime uint64) bool {
+	return false
+}
+
+func waitProcess(pid int, startTime uint64) {}
+
+func limitCmd(cmd *exec.Cmd, limits *Limits) error {
+	return errors.New("resource limits are not supported on this platform")
+}
@@ -0,0 +1,78 @@
+package job
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+)
+
+// ErrNoTTY is returned when terminal operation is requested for job without pseudo-terminal
+var ErrNoTTY = errors.New("job has no terminal")
+
+// ptyOutputTimeout limits how long exited job waits for remaining terminal output
+const ptyOutputTimeout = time.Second
+
+// startPTY starts command attached to a new pseudo-terminal. The terminal master
+// end feeds job logger and is used as job input.
+func (j *job) startPTY(size TerminalSize) error {
+	var ws *pty.Winsize
+	if size.Rows > 0 && size.Cols > 0 {
+		ws = toWinsize(size)
+	}
+
+	ptmx, err := pty.StartWithAttrs(j.cmd, ws, j.sysProcAttr(&syscall.SysProcAttr{Setsid: true, Setctty: true}))
+	if err != nil {
+		return err
+	}
+
+	j.ptmx = ptmx
+	j.stdin = &ptyInput{ptmx: ptmx}
+	j.outputDone = make(chan struct{})
+
+	go func() {
+		defer close(j.outputDone)
+		// reading master fails with EIO once process exited and terminal is closed
+		io.Copy(j.logger, ptmx)
+	}()
+
+	return nil
+}
+
+// closePTY waits for the remaining terminal output and closes terminal master
+func (j *job) closePTY() {
+	select {
+	case <-j.outputDone:
+	case <-time.After(ptyOutputTimeout):
+	}
+	j.ptmx.Close()
+}
+
+func (j *job) Resize(size TerminalSize) error {
+	if j.ptmx == nil {
+		return ErrNoTTY
+	}
+	return pty.Setsize(j.ptmx, toWinsize(size))
+}
+
+func toWinsize(size TerminalSize) *pty.Winsize {
+	return &pty.Winsize{Rows: size.Rows, Cols: size.Cols}
+}
+
+// ptyInput writes to terminal master, closing it sends EOF character
+// instead of closing the terminal.
+type ptyInput struct {
+	ptmx *os.File
+}
+
+func (p *ptyInput) Write(b []byte) (int, error) {
+	return p.ptmx.Write(b)
+}
+
+func (p *ptyInput) Close() error {
+	_, err := p.ptmx.Write([]byte{4})
+	return err
+}
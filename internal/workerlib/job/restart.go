@@ -0,0 +1,116 @@
+package job
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// RestartMode tells which finished job processes are relaunched
+type RestartMode string
+
+const (
+	RestartNever     RestartMode = "never"
+	RestartOnFailure RestartMode = "on-failure"
+	RestartAlways    RestartMode = "always"
+)
+
+const (
+	defaultRestartDelay      = time.Second
+	defaultCrashLoopFailures = 5
+	defaultCrashLoopWindow   = time.Minute
+	maxCrashLoopBackoff      = 5 * time.Minute
+)
+
+// ParseRestartMode parses restart mode name, empty name is never
+func ParseRestartMode(mode string) (RestartMode, error) {
+	switch RestartMode(mode) {
+	case "", RestartNever:
+		return RestartNever, nil
+	case RestartOnFailure, RestartAlways:
+		return RestartMode(mode), nil
+	}
+	return "", fmt.Errorf("invalid restart mode %q", mode)
+}
+
+// RestartPolicy supervises long running job, its process is relaunched under
+// the same job ID until job is stopped. Job which fails CrashLoopFailures times
+// within CrashLoopWindow is in CRASHLOOP status while it waits for restart, the
+// restart delay is doubled for every restart in crash loop up to 5m.
+type RestartPolicy struct {
+	Mode RestartMode
+	// Delay before process is relaunched, 1s by default
+	Delay time.Duration
+	// CrashLoopFailures and CrashLoopWindow detect crash loop, 5 failures within 1m by default
+	CrashLoopFailures int
+	CrashLoopWindow   time.Duration
+}
+
+// restartable reports whether finished attempt has to be relaunched
+func (p *RestartPolicy) restartable(a Attempt) bool {
+	if p == nil {
+		return false
+	}
+	switch p.Mode {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return a.failed()
+	}
+	return false
+}
+
+func (p *RestartPolicy) delay() time.Duration {
+	if p.Delay <= 0 {
+		return defaultRestartDelay
+	}
+	return p.Delay
+}
+
+// crashLoopFailures can't exceed number of attempts kept in status
+func (p *RestartPolicy) crashLoopFailures() int {
+	if p.CrashLoopFailures <= 0 {
+		return defaultCrashLoopFailures
+	}
+	return min(p.CrashLoopFailures, maxAttemptHistory)
+}
+
+func (p *RestartPolicy) crashLoopWindow() time.Duration {
+	if p.CrashLoopWindow <= 0 {
+		return defaultCrashLoopWindow
+	}
+	return p.CrashLoopWindow
+}
+
+// crashLoop tracks whether job keeps failing, job leaves crash loop once its
+// process runs for crash loop window
+type crashLoop struct {
+	active   bool
+	restarts int
+}
+
+// next returns delay before the next attempt and whether job is in crash loop
+func (c *crashLoop) next(p *RestartPolicy, attempts []Attempt) (time.Duration, bool) {
+	window := p.crashLoopWindow()
+	last := attempts[len(attempts)-1]
+	if c.active && last.FinishedAt.Sub(last.StartedAt) >= window {
+		c.active, c.restarts = false, 0
+	}
+
+	if !c.active {
+		failures := 0
+		for _, a := range attempts {
+			if a.failed() && a.FinishedAt.After(last.FinishedAt.Add(-window)) {
+				failures++
+			}
+		}
+		c.active = failures >= p.crashLoopFailures()
+	}
+	if !c.active {
+		return p.delay(), false
+	}
+
+	c.restarts++
+	delay := math.Min(float64(p.delay())*math.Pow(2, float64(c.restarts)), float64(maxCrashLoopBackoff))
+	return time.Duration(delay), true
+}
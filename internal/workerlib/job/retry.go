@@ -0,0 +1,230 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"slices"
+	"syscall"
+	"time"
+)
+
+// ErrRetryInteractive is returned when retry or restart policy is set for interactive job
+var ErrRetryInteractive = errors.New("retry and restart policies are not supported for interactive jobs")
+
+// ErrRetryAndRestart is returned when both retry and restart policies are set
+var ErrRetryAndRestart = errors.New("retry and restart policies can't be combined")
+
+const (
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = time.Minute
+)
+
+// RetryPolicy restarts job process which failed. All attempts share job ID and
+// output, output of every attempt after the first one starts with a marker line.
+type RetryPolicy struct {
+	// MaxAttempts is total number of attempts including the first one
+	MaxAttempts int
+	// ExitCodes and Signals which are retried, any failure is retried when both are empty
+	ExitCodes []int
+	Signals   []int
+	// InitialBackoff is delay before the second attempt, 1s by default. It is
+	// doubled for every next attempt up to MaxBackoff, 1m by default.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Jitter is fraction of delay, 0 to 1, by which delay is randomly changed
+	Jitter float64
+}
+
+// Attempt is one run of job process
+type Attempt struct {
+	Number     int
+	StartedAt  time.Time
+	FinishedAt time.Time
+	ExitCode   int
+	// Signal is number of signal which killed the process
+	Signal int
+	Error  string
+	// OutputOffset is where output of the attempt, including its marker, starts in job output
+	OutputOffset int64
+}
+
+// maxAttemptHistory is number of the latest attempts kept in job status
+const maxAttemptHistory = 100
+
+func (a Attempt) failed() bool {
+	return a.Signal != 0 || a.ExitCode != 0 || a.Error != ""
+}
+
+// retryable reports whether finished attempt has to be retried
+func (p *RetryPolicy) retryable(a Attempt) bool {
+	if p == nil || a.Number >= p.MaxAttempts {
+		return false
+	}
+	if !a.failed() {
+		return false
+	}
+	if len(p.ExitCodes) == 0 && len(p.Signals) == 0 {
+		return true
+	}
+	if a.Signal != 0 {
+		return slices.Contains(p.Signals, a.Signal)
+	}
+	return slices.Contains(p.ExitCodes, a.ExitCode)
+}
+
+// backoff returns delay before attempt following attempt number n
+func (p *RetryPolicy) backoff(n int) time.Duration {
+	initial, max := p.InitialBackoff, p.MaxBackoff
+	if initial <= 0 {
+		initial = defaultInitialBackoff
+	}
+	if max <= 0 {
+		max = defaultMaxBackoff
+	}
+
+	delay := math.Min(float64(initial)*math.Pow(2, float64(n-1)), float64(max))
+	if jitter := math.Min(math.Max(p.Jitter, 0), 1); jitter > 0 {
+		delay += delay * jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(delay)
+}
+
+// attemptMarker separates output of attempts
+func attemptMarker(command Command, n int) []byte {
+	if command.Retry != nil {
+		return []byte(fmt.Sprintf("--- attempt %d of %d ---\n", n, command.Retry.MaxAttempts))
+	}
+	return []byte(fmt.Sprintf("--- restart %d ---\n", n-1))
+}
+
+// startAttempt records start of a new attempt, process has to be started already
+func (j *job) startAttempt(offset int64) {
+	j.updateStatus(func(s *Status) {
+		attempts := s.Attempts
+		if len(attempts) >= maxAttemptHistory {
+			attempts = attempts[len(attempts)-maxAttemptHistory+1:]
+		}
+		number := 1
+		if len(attempts) > 0 {
+			number = attempts[len(attempts)-1].Number + 1
+		}
+		s.Attempts = append(slices.Clone(attempts), Attempt{
+			Number:       number,
+			StartedAt:    time.Now(),
+			OutputOffset: offset,
+		})
+		s.Restarts = number - 1
+		if s.StatusCode == CRASHLOOP {
+			s.StatusCode = RUNNING
+		}
+	})
+}
+
+// nextAttempt decides whether finished attempt is followed by another one and
+// returns delay before it and whether job is in crash loop
+func (j *job) nextAttempt(command Command, attempt Attempt, loop *crashLoop) (time.Duration, bool, bool) {
+	switch {
+	case command.Retry.retryable(attempt):
+		delay := command.Retry.backoff(attempt.Number)
+		log.Printf("[job] attempt %v of job %v failed, exit code: %v, retrying in %v", attempt.Number, j.id, attempt.ExitCode, delay)
+		return delay, false, true
+	case command.Restart.restartable(attempt):
+		delay, crashLoop := loop.next(command.Restart, j.GetStatus().Attempts)
+		log.Printf("[job] process of job %v finished, exit code: %v, restarting in %v", j.id, attempt.ExitCode, delay)
+		return delay, crashLoop, true
+	}
+	return 0, false, false
+}
+
+// finishAttempt records result of current attempt and returns it
+func (j *job) finishAttempt(state *os.ProcessState, err error) Attempt {
+	var attempt Attempt
+	j.updateStatus(func(s *Status) {
+		s.Attempts = slices.Clone(s.Attempts)
+		a := &s.Attempts[len(s.Attempts)-1]
+		a.FinishedAt = time.Now()
+		a.ExitCode = state.ExitCode()
+		if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			a.Signal = int(ws.Signal())
+		}
+		if err != nil {
+			a.Error = err.Error()
+		}
+		attempt = *a
+	})
+	return attempt
+}
+
+// waitNextAttempt waits for delay, it returns false when job was stopped meanwhile.
+// On success j.mtx is locked, so the next attempt can't race with Stop.
+func (j *job) waitNextAttempt(delay time.Duration, crashLoop bool) bool {
+	j.mtx.Lock()
+	if stopped(j.GetStatus()) {
+		j.mtx.Unlock()
+		return false
+	}
+	if crashLoop {
+		j.updateStatus(func(s *Status) {
+			s.StatusCode = CRASHLOOP
+		})
+	}
+	j.nextAttemptStop = make(chan struct{})
+	stop := j.nextAttemptStop
+	j.mtx.Unlock()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-stop:
+	}
+
+	j.mtx.Lock()
+	j.nextAttemptStop = nil
+	if stopped(j.GetStatus()) {
+		j.mtx.Unlock()
+		return false
+	}
+	return true
+}
+
+// restart starts the next attempt of job process, j.mtx has to be locked
+func (j *job) restart(command Command) error {
+	offset := j.outputSize()
+	attempts := j.GetStatus().Attempts
+	if _, err := j.logger.Write(attemptMarker(command, attempts[len(attempts)-1].Number+1)); err != nil {
+		return err
+	}
+
+	cmd, err := newCmd(command)
+	if err != nil {
+		return err
+	}
+	j.cmd = cmd
+	if j.detachable {
+		err = j.startDetachable()
+	} else {
+		err = j.start(command)
+	}
+	if err != nil {
+		return err
+	}
+
+	j.process = j.cmd.Process
+	j.startAttempt(offset)
+	j.saveAttemptState()
+	return nil
+}
+
+// outputSize returns current size of job output
+func (j *job) outputSize() int64 {
+	info, err := os.Stat(j.logger.Name())
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
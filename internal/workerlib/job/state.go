@@ -0,0 +1,201 @@
+package job
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/supby/job-worker/internal/workerlib/joblogger"
+)
+
+// stateFileSuffix is suffix of job state files in state directory
+const stateFileSuffix = ".json"
+
+// errUnknownExitCode is reported for re-adopted jobs, exit code of a process which is not child of server is not available
+const errUnknownExitCode = "exit code of re-adopted job is unknown"
+
+// State is persisted description of a job which allows to re-adopt it after server restart
+type State struct {
+	ID  uuid.UUID `json:"id"`
+	PID int       `json:"pid"`
+	// ProcessStartTime is start time of process in clock ticks since boot, it
+	// tells job process apart from another process reusing its PID
+	ProcessStartTime uint64    `json:"processStartTime"`
+	LogFile          string    `json:"logFile"`
+	Command          Command   `json:"command"`
+	StartedAt        time.Time `json:"startedAt"`
+	// Status is final status, it is set once job is finished
+	Status *Status `json:"status,omitempty"`
+	// Cgroup is path of job's cgroup, see WithCgroupDir
+	Cgroup string `json:"cgroup,omitempty"`
+}
+
+// saveInitialState records state of just started job
+func (j *job) saveInitialState(stateDir string, command Command) {
+	startTime, err := processStartTime(j.process.Pid)
+	if err != nil {
+		log.Printf("[job] failed to get process start time, job can't be re-adopted: %v, job: %v", err, j.id)
+		return
+	}
+
+	j.state = &State{
+		ID:               j.id,
+		PID:              j.process.Pid,
+		ProcessStartTime: startTime,
+		LogFile:          j.logger.Name(),
+		Command:          command,
+		StartedAt:        j.GetStatus().StartedAt,
+		Cgroup:           j.cgroup,
+	}
+	j.stateFile = filepath.Join(stateDir, j.id.String()+stateFileSuffix)
+	if err := writeState(j.stateFile, j.state); err != nil {
+		log.Printf("[job] failed to save job state: %v, job: %v", err, j.id)
+	}
+}
+
+// saveAttemptState records process of a new attempt, so the attempt is re-adopted after restart
+func (j *job) saveAttemptState() {
+	if j.state == nil {
+		return
+	}
+
+	startTime, err := processStartTime(j.process.Pid)
+	if err != nil {
+		log.Printf("[job] failed to get process start time, job can't be re-adopted: %v, job: %v", err, j.id)
+		return
+	}
+	j.state.PID = j.process.Pid
+	j.state.ProcessStartTime = startTime
+	if err := writeState(j.stateFile, j.state); err != nil {
+		log.Printf("[job] failed to save job state: %v, job: %v", err, j.id)
+	}
+}
+
+// saveFinalState records final status, so finished job is known after restart as well
+func (j *job) saveFinalState() {
+	if j.stateFile == "" {
+		return
+	}
+
+	state := *j.state
+	state.Status = j.GetStatus()
+	if err := writeState(j.stateFile, &state); err != nil {
+		log.Printf("[job] failed to save job state: %v, job: %v", err, j.id)
+	}
+}
+
+// writeState replaces state file atomically
+func writeState(filename string, state *State) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+// ReadStates reads states of all jobs recorded in stateDir, unreadable and
+// invalid state files are logged and skipped so that other jobs are still read
+func ReadStates(stateDir string) ([]State, error) {
+	files, err := filepath.Glob(filepath.Join(stateDir, "*"+stateFileSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	var states []State
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			log.Printf("[job] failed to read job state, job is skipped: %v", err)
+			continue
+		}
+		var state State
+		if err := json.Unmarshal(data, &state); err != nil {
+			log.Printf("[job] invalid job state %s, job is skipped: %v", file, err)
+			continue
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// Adopt rebuilds job from state recorded in stateDir by a previous server. Job
+// process is verified by its start time, job which finished in the meantime is
+// restored as exited with unknown exit code. Re-adopted jobs have no input and
+// no terminal.
+func Adopt(state State, stateDir string) (Job, error) {
+	logger, err := joblogger.Open(state.ID, state.LogFile)
+	if err != nil {
+		return nil, err
+	}
+
+	process, err := os.FindProcess(state.PID)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &job{
+		id:        state.ID,
+		logger:    logger,
+		done:      make(chan struct{}),
+		process:   process,
+		state:     &state,
+		stateFile: filepath.Join(stateDir, state.ID.String()+stateFileSuffix),
+		cgroup:    state.Cgroup,
+	}
+
+	switch {
+	case state.Status != nil:
+		j.status.Store(state.Status)
+		close(j.done)
+	case !processAlive(state.PID, state.ProcessStartTime):
+		j.status.Store(&Status{
+			ExitCode:    -1,
+			StatusCode:  EXITED,
+			CommandName: state.Command.Name,
+			Arguments:   state.Command.Arguments,
+			Labels:      state.Command.Labels,
+			Error:       errUnknownExitCode,
+			StartedAt:   state.StartedAt,
+			FinishedAt:  time.Now(),
+		})
+		j.saveFinalState()
+		close(j.done)
+	default:
+		j.status.Store(&Status{
+			StatusCode:  RUNNING,
+			CommandName: state.Command.Name,
+			Arguments:   state.Command.Arguments,
+			Labels:      state.Command.Labels,
+			Priority:    state.Command.Priority,
+			StartedAt:   state.StartedAt,
+		})
+		go j.logger.WatchFile(j.done)
+		go j.waitAdopted()
+	}
+	return j, nil
+}
+
+// waitAdopted tracks re-adopted job process, which is not a child of server
+func (j *job) waitAdopted() {
+	defer close(j.done)
+	defer j.saveFinalState()
+
+	waitProcess(j.state.PID, j.state.ProcessStartTime)
+
+	j.updateStatus(func(s *Status) {
+		s.ExitCode = -1
+		s.FinishedAt = time.Now()
+		if !stopped(s) {
+			s.StatusCode = EXITED
+			s.Error = errUnknownExitCode
+		}
+	})
+	log.Printf("[job] re-adopted job exited: %v", j.id)
+}
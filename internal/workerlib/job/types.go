@@ -1,6 +1,10 @@
 package job
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
 
 const (
 	UNKNOWN = 0
@@ -9,6 +13,14 @@ const (
 	STOPPED = 3
 	STARTED = 4
 	ERROR   = 5
+	// CRASHLOOP job keeps failing and waits for restart, see RestartPolicy
+	CRASHLOOP = 6
+	// QUEUED job waits for a free running slot of worker
+	QUEUED = 7
+	// PREEMPTED job was stopped to make room for a job with higher priority
+	PREEMPTED = 8
+	// PAUSED job has its process tree frozen, see Job.Pause
+	PAUSED = 9
 )
 
 var NilJobId uuid.UUID // empty UUID, all zeros
@@ -16,6 +28,31 @@ var NilJobId uuid.UUID // empty UUID, all zeros
 type Command struct {
 	Name      string
 	Arguments []string
+	// Interactive jobs get writable stdin pipe which clients can attach to
+	Interactive bool
+	// TTY runs job in pseudo-terminal, it implies Interactive
+	TTY          bool
+	TerminalSize TerminalSize
+	// Labels are arbitrary metadata used to select jobs, e.g. pipeline or team
+	Labels map[string]string
+	// Retry restarts failed job process, nil means no retries
+	Retry *RetryPolicy
+	// Restart relaunches finished process of long running job, it can't be combined with Retry
+	Restart *RestartPolicy
+	// Env are KEY=value variables added to environment of the server
+	Env []string
+	// Limits restricts resources of job, nil means no limits
+	Limits *Limits
+	// Priority orders queued jobs, higher is started first
+	Priority int
+	// Preemptible jobs can be stopped to make room for jobs with higher priority
+	Preemptible bool
+}
+
+// TerminalSize is size of job's pseudo-terminal in characters
+type TerminalSize struct {
+	Rows uint16
+	Cols uint16
 }
 
 type Status struct {
@@ -25,4 +62,12 @@ type Status struct {
 	CommandName string
 	Arguments   []string
 	Error       string
+	StartedAt   time.Time
+	FinishedAt  time.Time
+	Labels      map[string]string
+	// Attempts are the latest runs of job process, the last one is current
+	Attempts []Attempt
+	// Restarts is number of times job process was relaunched
+	Restarts int
+	Priority int
 }
@@ -7,17 +7,30 @@ import (
 	"log"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/supby/job-worker/internal/metrics"
 )
 
+var logBytesWritten = metrics.NewCounter("jobworker_log_bytes_written_total", "Number of bytes of job output written to logs.")
+
 // JobLogger is an interface for a job logger that uses a temporary file for storage
 type JobLogger interface {
 	Write(p []byte) (n int, err error)
 	GetStream(ctx context.Context) (<-chan []byte, error)
+	GetStreamFrom(ctx context.Context, offset int64) (<-chan []byte, error)
+	// Name returns path of log file
+	Name() string
+	// WatchFile notifies listeners about data written to log file directly,
+	// bypassing Write, until stop is closed
+	WatchFile(stop <-chan struct{})
 	Close() error
 }
 
+// fileWatchInterval is how often log file written by job process directly is checked for new data
+const fileWatchInterval = 100 * time.Millisecond
+
 type listener struct {
 	offset int64
 	notify chan struct{}
@@ -43,11 +56,61 @@ func New(jobId uuid.UUID) (JobLogger, error) {
 	}, nil
 }
 
+// Open opens log file at path, existing file is appended. It is used for logs
+// which have to outlive server process.
+func Open(jobId uuid.UUID, path string) (JobLogger, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &jobLogger{
+		jobId:     jobId,
+		file:      file,
+		listeners: make(map[*listener]struct{}),
+	}, nil
+}
+
+func (jl *jobLogger) Name() string {
+	return jl.file.Name()
+}
+
+func (jl *jobLogger) WatchFile(stop <-chan struct{}) {
+	ticker := time.NewTicker(fileWatchInterval)
+	defer ticker.Stop()
+
+	var size int64
+	check := func() {
+		info, err := jl.file.Stat()
+		if err != nil || info.Size() <= size {
+			return
+		}
+		logBytesWritten.Add(float64(info.Size() - size))
+		size = info.Size()
+
+		jl.mu.Lock()
+		jl.notifyListeners()
+		jl.mu.Unlock()
+	}
+
+	for {
+		select {
+		case <-stop:
+			// output written right before process exited
+			check()
+			return
+		case <-ticker.C:
+			check()
+		}
+	}
+}
+
 func (jl *jobLogger) Write(p []byte) (n int, err error) {
 	jl.mu.Lock()
 	defer jl.mu.Unlock()
 
 	n, err = jl.file.Write(p)
+	logBytesWritten.Add(float64(n))
 	if err != nil {
 		return n, err
 	}
@@ -69,6 +132,16 @@ func (jl *jobLogger) notifyListeners() {
 }
 
 func (jl *jobLogger) GetStream(ctx context.Context) (<-chan []byte, error) {
+	return jl.GetStreamFrom(ctx, 0)
+}
+
+// GetStreamFrom streams log starting from the given byte offset,
+// it allows consumers to resume interrupted stream.
+func (jl *jobLogger) GetStreamFrom(ctx context.Context, offset int64) (<-chan []byte, error) {
+	if offset < 0 {
+		return nil, fmt.Errorf("invalid log offset: %v", offset)
+	}
+
 	// Check if the file exists
 	if _, err := os.Stat(jl.file.Name()); os.IsNotExist(err) {
 		return nil, fmt.Errorf("log file does not exist: %s", jl.file.Name())
@@ -76,7 +149,7 @@ func (jl *jobLogger) GetStream(ctx context.Context) (<-chan []byte, error) {
 
 	outchan := make(chan []byte, 100) // Buffered channel to reduce blocking
 	l := &listener{
-		offset: 0,
+		offset: offset,
 		notify: make(chan struct{}, 1),
 	}
 
@@ -95,7 +168,7 @@ func (jl *jobLogger) GetStream(ctx context.Context) (<-chan []byte, error) {
 
 		// in case log file already contains something
 		if err := jl.flushToChannel(l, outchan); err != nil {
-			log.Printf("joblogger] job logs flushing failed, jobId: %x, error: %v", jl.jobId, err)
+			log.Printf("[joblogger] job logs flushing failed, jobId: %v, error: %v", jl.jobId, err)
 			return
 		}
 
@@ -105,7 +178,7 @@ func (jl *jobLogger) GetStream(ctx context.Context) (<-chan []byte, error) {
 				return
 			case <-l.notify:
 				if err := jl.flushToChannel(l, outchan); err != nil {
-					log.Printf("joblogger] job logs flushing failed, jobId: %x, error: %v", jl.jobId, err)
+					log.Printf("[joblogger] job logs flushing failed, jobId: %v, error: %v", jl.jobId, err)
 					return
 				}
 			}
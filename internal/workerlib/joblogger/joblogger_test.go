@@ -154,3 +154,29 @@ func TestGetStreamAfterLoggerClosed(t *testing.T) {
 	_, err = jl.GetStream(ctx)
 	assert.Error(t, err)
 }
+
+func TestGetStreamFromOffset(t *testing.T) {
+	jobID, _ := uuid.NewRandom()
+	jl, err := New(jobID)
+	assert.NoError(t, err)
+	defer jl.Close()
+
+	_, err = jl.Write([]byte("log line 1\nlog line 2\n"))
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	outchan, err := jl.GetStreamFrom(ctx, int64(len("log line 1\n")))
+	assert.NoError(t, err)
+
+	select {
+	case log := <-outchan:
+		assert.Equal(t, "log line 2\n", string(log))
+	case <-time.After(time.Second):
+		t.Fatal("expected log line, but got timeout")
+	}
+
+	_, err = jl.GetStreamFrom(ctx, -1)
+	assert.Error(t, err)
+}
@@ -0,0 +1,53 @@
+package workerlib
+
+import (
+	"path/filepath"
+	"sync"
+
+	"github.com/supby/job-worker/internal/metrics"
+)
+
+// jobDurationBuckets are buckets in seconds, jobs may run from milliseconds to hours
+var jobDurationBuckets = []float64{.1, .5, 1, 5, 10, 30, 60, 300, 900, 1800, 3600, 14400}
+
+const (
+	// otherCommand labels commands which failed to start and commands over maxCommandLabels
+	otherCommand = "other"
+	// maxCommandLabels is number of distinct command labels, every label value is a series kept forever
+	maxCommandLabels = 100
+)
+
+var (
+	jobsStarted = metrics.NewCounter("jobworker_jobs_started_total", "Number of started jobs.", "command")
+	jobsExited  = metrics.NewCounter("jobworker_jobs_exited_total", "Number of jobs exited on their own.", "command")
+	jobsStopped = metrics.NewCounter("jobworker_jobs_stopped_total", "Number of jobs stopped by request.", "command")
+	// preempted jobs are counted once they exit
+	jobsPreempted = metrics.NewCounter("jobworker_jobs_preempted_total", "Number of jobs stopped to make room for jobs with higher priority.", "command")
+	jobsErrored   = metrics.NewCounter("jobworker_jobs_errored_total", "Number of jobs failed to start.", "command")
+	jobsRunning   = metrics.NewGauge("jobworker_jobs_running", "Number of currently running jobs.")
+	jobsQueued    = metrics.NewGauge("jobworker_jobs_queued", "Number of jobs waiting to be started.")
+	jobDuration   = metrics.NewHistogram("jobworker_job_duration_seconds", "Duration of finished jobs.", jobDurationBuckets, "command")
+)
+
+var commandLabels = struct {
+	sync.Mutex
+	seen map[string]struct{}
+}{seen: map[string]struct{}{}}
+
+// commandLabel returns command label of started job. Command names come from
+// clients, so only base names of started executables are used and only up to
+// maxCommandLabels of them.
+func commandLabel(name string) string {
+	name = filepath.Base(name)
+
+	commandLabels.Lock()
+	defer commandLabels.Unlock()
+	if _, ok := commandLabels.seen[name]; ok {
+		return name
+	}
+	if len(commandLabels.seen) >= maxCommandLabels {
+		return otherCommand
+	}
+	commandLabels.seen[name] = struct{}{}
+	return name
+}
@@ -0,0 +1,78 @@
+package workerlib
+
+import "time"
+
+// Option configures Worker created by New
+type Option func(*worker)
+
+// StartOption configures single Start call
+type StartOption func(*startOptions)
+
+type startOptions struct {
+	idempotencyKey string
+	quota          Quota
+	hasQuota       bool
+}
+
+// WithMaxRunningJobs limits number of concurrently running jobs, zero means no limit
+func WithMaxRunningJobs(n int) Option {
+	return func(w *worker) {
+		w.maxRunning.Store(int64(n))
+	}
+}
+
+// WithStateDir records state and output of jobs in dir. Jobs recorded by a
+// previous worker are re-adopted by New, so they can be queried and stopped
+// after server restart.
+func WithStateDir(dir string) Option {
+	return func(w *worker) {
+		w.stateDir = dir
+	}
+}
+
+// WithCgroupDir runs every job in its own cgroup created in dir, so that Pause
+// freezes whole process tree of the job with cgroup freezer. Dir has to be on
+// cgroup v2 filesystem and writable by the server, otherwise jobs are paused
+// with SIGSTOP sent to processes found by parent PID.
+func WithCgroupDir(dir string) Option {
+	return func(w *worker) {
+		w.cgroupDir = dir
+	}
+}
+
+// WithIdempotencyWindow sets how long idempotency keys of Start are remembered, see WithIdempotencyKey
+func WithIdempotencyWindow(window time.Duration) Option {
+	return func(w *worker) {
+		w.idempotencyWindow = window
+	}
+}
+
+// WithMaxQueuedJobs queues up to n jobs started when maximum number of running
+// jobs is reached, zero means new jobs are rejected with ErrWorkerSaturated.
+// Queued jobs are started by priority and they are not re-adopted after restart.
+func WithMaxQueuedJobs(n int) Option {
+	return func(w *worker) {
+		w.maxQueued = n
+	}
+}
+
+// WithQueueAging sets how long queued job waits to gain one priority point, one minute by default
+func WithQueueAging(aging time.Duration) Option {
+	return func(w *worker) {
+		if aging > 0 {
+			w.queueAging = aging
+		}
+	}
+}
+
+// WithPreemption makes job queued with a higher priority preempt the running
+// preemptible job with the lowest priority. Preempted job gets SIGTERM and it
+// is killed when it is still running after grace, 10s by default.
+func WithPreemption(grace time.Duration) Option {
+	return func(w *worker) {
+		w.preemption = true
+		if grace > 0 {
+			w.preemptionGrace = grace
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package workerlib
+
+import (
+	"container/heap"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/supby/job-worker/internal/workerlib/job"
+)
+
+// defaultQueueAging is how long queued job waits to gain one priority point
+const defaultQueueAging = time.Minute
+
+// defaultPreemptionGrace is how long preempted job has to exit after SIGTERM
+const defaultPreemptionGrace = 10 * time.Second
+
+// jobEntry tracks job from Start until it is finished
+type jobEntry struct {
+	job      job.Job
+	command  job.Command
+	quota    Quota
+	hasQuota bool
+
+	// started is set once job holds a running slot, fields below are guarded by queueMtx
+	started   bool
+	startedAt time.Time
+	preempted bool
+	// index is position in queue, -1 when job is not queued
+	index int
+	// rank orders queue, it is priority aged since worker was created, see enqueue
+	rank float64
+}
+
+// jobQueue is heap of queued jobs, the job with the highest rank is on top
+type jobQueue []*jobEntry
+
+func (q jobQueue) Len() int { return len(q) }
+
+func (q jobQueue) Less(i, j int) bool { return q[i].rank > q[j].rank }
+
+func (q jobQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *jobQueue) Push(x any) {
+	e := x.(*jobEntry)
+	e.index = len(*q)
+	*q = append(*q, e)
+}
+
+func (q *jobQueue) Pop() any {
+	old := *q
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	e.index = -1
+	*q = old[:len(old)-1]
+	return e
+}
+
+// enqueue adds job to queue and preempts a running job if needed, queueMtx has to be locked.
+//
+// Queued job gains one priority point every queueAging, so that batch jobs are
+// not starved by a stream of jobs with higher priority. Job enqueued later has
+// to have higher priority to overtake, the rank is therefore priority minus
+// enqueue time in aging units and it doesn't change while job waits.
+func (w *worker) enqueue(e *jobEntry) {
+	e.rank = float64(e.command.Priority) - float64(time.Since(w.created))/float64(w.queueAging)
+	heap.Push(&w.queue, e)
+	jobsQueued.Inc()
+
+	if w.preemption {
+		w.preempt(e.command.Priority)
+	}
+}
+
+// preempt stops the running preemptible job with the lowest priority lower than priority,
+// queueMtx has to be locked. The most recently started job is chosen among jobs
+// with the same priority, as it loses the least work.
+func (w *worker) preempt(priority int) {
+	var victim *jobEntry
+	for _, e := range w.active {
+		if !e.command.Preemptible || e.preempted || e.command.Priority >= priority {
+			continue
+		}
+		if victim == nil || e.command.Priority < victim.command.Priority ||
+			(e.command.Priority == victim.command.Priority && e.startedAt.After(victim.startedAt)) {
+			victim = e
+		}
+	}
+	if victim == nil {
+		return
+	}
+
+	victim.preempted = true
+	log.Printf("[worker] preempting job %v with priority %d", victim.job.GetID(), victim.command.Priority)
+	if err := victim.job.Preempt(w.preemptionGrace); err != nil {
+		log.Printf("[worker] failed to preempt job %v: %v", victim.job.GetID(), err)
+	}
+}
+
+// dispatch starts queued jobs while there are free running slots
+func (w *worker) dispatch() {
+	w.queueMtx.Lock()
+	defer w.queueMtx.Unlock()
+
+	for w.queue.Len() > 0 && !w.shuttingDown.Load() && w.acquire() {
+		e := heap.Pop(&w.queue).(*jobEntry)
+		jobsQueued.Dec()
+
+		jobID := e.job.GetID()
+		if err := e.job.Start(); err != nil {
+			w.running.Add(-1)
+			if !errors.Is(err, job.ErrNotQueued) {
+				jobsErrored.Inc(otherCommand)
+				log.Printf("[worker] failed to start queued job %v: %v", jobID, err)
+			}
+			continue
+		}
+		w.activate(e)
+		log.Printf("[worker] Queued job started: %v", jobID)
+	}
+}
+
+// activate records started job, queueMtx has to be locked
+func (w *worker) activate(e *jobEntry) {
+	e.started = true
+	e.startedAt = time.Now()
+	w.active[e.job.GetID()] = e
+	jobsStarted.Inc(commandLabel(e.command.Name))
+	jobsRunning.Inc()
+}
+
+// release removes finished job from queue or from active jobs and reports whether it was started
+func (w *worker) release(e *jobEntry) bool {
+	w.queueMtx.Lock()
+	defer w.queueMtx.Unlock()
+
+	if e.index >= 0 {
+		heap.Remove(&w.queue, e.index)
+		jobsQueued.Dec()
+	}
+	delete(w.active, e.job.GetID())
+	return e.started
+}
+
+// cancelQueued stops all queued jobs, they are never started
+func (w *worker) cancelQueued() {
+	w.queueMtx.Lock()
+	queued := append([]*jobEntry(nil), w.queue...)
+	w.queueMtx.Unlock()
+
+	if len(queued) > 0 {
+		log.Printf("[worker] cancelling %d queued jobs", len(queued))
+	}
+	for _, e := range queued {
+		if err := e.job.Stop(); err != nil {
+			log.Printf("[worker] failed to cancel queued job %v: %v", e.job.GetID(), err)
+		}
+	}
+}
+
+// queueFull reports whether a new job can't be queued
+func (w *worker) queueFull() bool {
+	w.queueMtx.Lock()
+	defer w.queueMtx.Unlock()
+	return w.queue.Len() >= w.maxQueued
+}
@@ -0,0 +1,149 @@
+package workerlib
+
+import (
+	"container/heap"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/supby/job-worker/internal/workerlib/job"
+)
+
+func TestPriorityQueue(t *testing.T) {
+	ctx := context.Background()
+	w := New(WithMaxRunningJobs(1), WithMaxQueuedJobs(2))
+
+	running, err := w.Start(ctx, job.Command{Name: "sleep", Arguments: []string{"5"}})
+	assert.NoError(t, err)
+	batch, err := w.Start(ctx, job.Command{Name: "true", Priority: 1})
+	assert.NoError(t, err)
+	hotfix, err := w.Start(ctx, job.Command{Name: "sleep", Arguments: []string{"5"}, Priority: 10})
+	assert.NoError(t, err)
+	assert.True(t, w.Saturated())
+	assert.Equal(t, float64(2), jobsQueued.Value())
+
+	_, err = w.Start(ctx, job.Command{Name: "true"})
+	assert.ErrorIs(t, err, ErrWorkerSaturated)
+
+	status, err := w.QueryStatus(ctx, hotfix)
+	assert.NoError(t, err)
+	assert.True(t, status.StatusCode == job.QUEUED)
+	assert.Equal(t, 10, status.Priority)
+
+	assert.NoError(t, w.Stop(ctx, running))
+	status = waitStatus(t, w, hotfix, job.RUNNING)
+	assert.Equal(t, 10, status.Priority)
+	status, err = w.QueryStatus(ctx, batch)
+	assert.NoError(t, err)
+	assert.True(t, status.StatusCode == job.QUEUED)
+
+	assert.NoError(t, w.Stop(ctx, hotfix))
+	status, err = w.Wait(ctx, batch)
+	assert.NoError(t, err)
+	assert.True(t, status.StatusCode == job.EXITED)
+	assert.Zero(t, jobsQueued.Value())
+}
+
+func TestQueueAging(t *testing.T) {
+	w := &worker{queueAging: time.Minute, created: time.Now()}
+	old := &jobEntry{command: job.Command{Priority: 0}}
+	w.enqueue(old)
+	// the old job is waiting for an hour, so it has priority 60
+	w.created = w.created.Add(-time.Hour)
+	newer := &jobEntry{command: job.Command{Priority: 59}}
+	w.enqueue(newer)
+	higher := &jobEntry{command: job.Command{Priority: 61}}
+	w.enqueue(higher)
+
+	for _, expected := range []*jobEntry{higher, old, newer} {
+		assert.Same(t, expected, heap.Pop(&w.queue))
+		jobsQueued.Dec()
+	}
+}
+
+func TestStopQueuedJob(t *testing.T) {
+	ctx := context.Background()
+	w := New(WithMaxRunningJobs(1), WithMaxQueuedJobs(1))
+	alice := WithQuota(Quota{Owner: "alice", MaxRunningJobs: 1})
+
+	running, err := w.Start(ctx, job.Command{Name: "sleep", Arguments: []string{"5"}})
+	assert.NoError(t, err)
+	queued, err := w.Start(ctx, job.Command{Name: "sleep", Arguments: []string{"5"}}, alice)
+	assert.NoError(t, err)
+	_, err = w.Start(ctx, job.Command{Name: "true"}, alice)
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+
+	assert.NoError(t, w.Stop(ctx, queued))
+	status, err := w.Wait(ctx, queued)
+	assert.NoError(t, err)
+	assert.True(t, status.StatusCode == job.STOPPED)
+	assert.True(t, status.StartedAt.IsZero())
+
+	// queue and quota are released, running job keeps its slot
+	assert.Eventually(t, func() bool { return !w.Saturated() }, time.Second, 10*time.Millisecond)
+	queued, err = w.Start(ctx, job.Command{Name: "true"}, alice)
+	assert.NoError(t, err)
+	status, err = w.QueryStatus(ctx, queued)
+	assert.NoError(t, err)
+	assert.True(t, status.StatusCode == job.QUEUED)
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	assert.NoError(t, w.Shutdown(ctx, ShutdownTerminate))
+	status, err = w.Wait(ctx, queued)
+	assert.NoError(t, err)
+	assert.True(t, status.StatusCode == job.STOPPED)
+	status, err = w.Wait(ctx, running)
+	assert.NoError(t, err)
+	assert.True(t, status.StatusCode == job.STOPPED)
+}
+
+func TestPreemption(t *testing.T) {
+	ctx := context.Background()
+	w := New(WithMaxRunningJobs(2), WithMaxQueuedJobs(2), WithPreemption(100*time.Millisecond))
+
+	// the only job which can be preempted ignores SIGTERM, so it is killed after grace period
+	batch, err := w.Start(ctx, job.Command{Name: "sh", Arguments: []string{"-c", "trap '' TERM; exec sleep 5"}, Preemptible: true})
+	assert.NoError(t, err)
+	service, err := w.Start(ctx, job.Command{Name: "sleep", Arguments: []string{"5"}})
+	assert.NoError(t, err)
+	waitStatus(t, w, batch, job.RUNNING)
+
+	low, err := w.Start(ctx, job.Command{Name: "sleep", Arguments: []string{"5"}})
+	assert.NoError(t, err)
+	status, err := w.QueryStatus(ctx, batch)
+	assert.NoError(t, err)
+	assert.True(t, status.StatusCode == job.RUNNING)
+
+	preempted := jobsPreempted.Value("sh")
+	hotfix, err := w.Start(ctx, job.Command{Name: "sleep", Arguments: []string{"5"}, Priority: 1})
+	assert.NoError(t, err)
+
+	status, err = w.Wait(ctx, batch)
+	assert.NoError(t, err)
+	assert.True(t, status.StatusCode == job.PREEMPTED)
+	waitStatus(t, w, hotfix, job.RUNNING)
+	assert.Equal(t, preempted+1, jobsPreempted.Value("sh"))
+
+	status, err = w.QueryStatus(ctx, low)
+	assert.NoError(t, err)
+	assert.True(t, status.StatusCode == job.QUEUED)
+	status, err = w.QueryStatus(ctx, service)
+	assert.NoError(t, err)
+	assert.True(t, status.StatusCode == job.RUNNING)
+
+	assert.NoError(t, w.Shutdown(ctx, ShutdownTerminate))
+}
+
+// waitStatus waits until job has status code
+func waitStatus(t *testing.T, w Worker, jobID uuid.UUID, statusCode byte) *job.Status {
+	var status *job.Status
+	assert.Eventually(t, func() bool {
+		var err error
+		status, err = w.QueryStatus(context.Background(), jobID)
+		return err == nil && status.StatusCode == statusCode
+	}, 3*time.Second, 10*time.Millisecond)
+	return status
+}
@@ -0,0 +1,42 @@
+package workerlib
+
+import "errors"
+
+// ErrQuotaExceeded is returned when owner of a new job already runs maximum number of jobs
+var ErrQuotaExceeded = errors.New("running jobs quota exceeded")
+
+// Quota limits number of concurrently running jobs started by one owner
+type Quota struct {
+	Owner string
+	// MaxRunningJobs is maximum number of running jobs of the owner, zero means no limit
+	MaxRunningJobs int
+}
+
+// WithQuota makes Start enforce quota q, the job counts toward the quota until it finishes
+func WithQuota(q Quota) StartOption {
+	return func(o *startOptions) {
+		o.quota, o.hasQuota = q, true
+	}
+}
+
+// acquireOwner reserves slot for a new running job of quota's owner
+func (w *worker) acquireOwner(q Quota) bool {
+	w.ownersMtx.Lock()
+	defer w.ownersMtx.Unlock()
+
+	if q.MaxRunningJobs > 0 && w.owners[q.Owner] >= q.MaxRunningJobs {
+		return false
+	}
+	w.owners[q.Owner]++
+	return true
+}
+
+func (w *worker) releaseOwner(owner string) {
+	w.ownersMtx.Lock()
+	defer w.ownersMtx.Unlock()
+
+	w.owners[owner]--
+	if w.owners[owner] <= 0 {
+		delete(w.owners, owner)
+	}
+}
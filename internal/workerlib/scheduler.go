@@ -0,0 +1,452 @@
+package workerlib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+	"github.com/supby/job-worker/internal/workerlib/job"
+)
+
+// ScheduleLabel is label of jobs started by schedule, its value is schedule ID
+const ScheduleLabel = "schedule"
+
+// ErrScheduleNotFound is returned when a schedule with the given ID is not found
+var ErrScheduleNotFound = errors.New("schedule not found")
+
+const (
+	defaultHistoryLimit = 10
+	schedulesFile       = "schedules.json"
+)
+
+// cronParser accepts standard 5 field expressions, optional seconds field and descriptors like @daily
+var cronParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// ConcurrencyPolicy tells what happens when schedule fires while its previous job is still running
+type ConcurrencyPolicy string
+
+const (
+	// ConcurrencyAllow starts a new job next to running ones
+	ConcurrencyAllow ConcurrencyPolicy = "allow"
+	// ConcurrencyForbid skips the run
+	ConcurrencyForbid ConcurrencyPolicy = "forbid"
+	// ConcurrencyReplace stops running jobs and starts a new one
+	ConcurrencyReplace ConcurrencyPolicy = "replace"
+)
+
+// ParseConcurrencyPolicy parses policy name, empty name is allow
+func ParseConcurrencyPolicy(policy string) (ConcurrencyPolicy, error) {
+	switch ConcurrencyPolicy(policy) {
+	case "", ConcurrencyAllow:
+		return ConcurrencyAllow, nil
+	case ConcurrencyForbid, ConcurrencyReplace:
+		return ConcurrencyPolicy(policy), nil
+	}
+	return "", fmt.Errorf("invalid concurrency policy %q", policy)
+}
+
+// StartCheck authorizes job which scheduler or workflow engine starts on behalf of
+// client identified by owner and roles, job is not started when it returns error
+type StartCheck func(command job.Command, owner string, roles []string) error
+
+// ScheduleSpec describes periodically started job
+type ScheduleSpec struct {
+	// Cron is cron expression, e.g. "0 3 * * *" or "@hourly"
+	Cron string
+	// TimeZone of cron expression, e.g. "Europe/Berlin", local time zone when empty
+	TimeZone    string
+	Command     job.Command
+	Concurrency ConcurrencyPolicy
+	// HistoryLimit is number of finished jobs of schedule which are kept, 10 by default
+	HistoryLimit int
+	// Owner and Roles identify client which created schedule, they are passed to StartCheck
+	Owner string
+	Roles []string
+	// Quota of owner is enforced on every run, nil means no quota
+	Quota *Quota
+}
+
+// Schedule is a snapshot of schedule's state
+type Schedule struct {
+	ID        uuid.UUID
+	Spec      ScheduleSpec
+	Paused    bool
+	CreatedAt time.Time
+	// NextRun is zero for paused schedule
+	NextRun   time.Time
+	LastRun   time.Time
+	LastJobID uuid.UUID
+}
+
+// Scheduler starts jobs periodically according to cron expressions. Every
+// firing starts a normal job labelled with schedule ID.
+type Scheduler interface {
+	CreateSchedule(ctx context.Context, spec ScheduleSpec) (Schedule, error)
+	ListSchedules(ctx context.Context) ([]Schedule, error)
+	DeleteSchedule(ctx context.Context, id uuid.UUID) error
+	// PauseSchedule pauses or resumes schedule, runs missed while paused are skipped
+	PauseSchedule(ctx context.Context, id uuid.UUID, paused bool) error
+	// Close stops firing of all schedules
+	Close()
+}
+
+type schedule struct {
+	info     Schedule
+	cron     cron.Schedule
+	location *time.Location
+	stop     chan struct{}
+}
+
+type scheduler struct {
+	worker    Worker
+	check     StartCheck
+	mtx       sync.Mutex
+	schedules map[uuid.UUID]*schedule
+	stateFile string
+	closed    bool
+	wg        sync.WaitGroup
+	now       func() time.Time
+}
+
+// NewScheduler creates scheduler starting jobs on worker. With stateDir schedules
+// are saved there and restored when scheduler is created again. Every run is
+// authorized by check, unless it is nil.
+func NewScheduler(worker Worker, stateDir string, check StartCheck) Scheduler {
+	s := &scheduler{
+		worker:    worker,
+		check:     check,
+		schedules: map[uuid.UUID]*schedule{},
+		now:       time.Now,
+	}
+	if stateDir != "" {
+		s.stateFile = filepath.Join(stateDir, schedulesFile)
+		s.restore()
+	}
+	return s
+}
+
+func (s *scheduler) CreateSchedule(ctx context.Context, spec ScheduleSpec) (Schedule, error) {
+	if spec.Command.Interactive || spec.Command.TTY {
+		return Schedule{}, errors.New("scheduled jobs can't be interactive")
+	}
+	if err := ValidateLabels(spec.Command.Labels); err != nil {
+		return Schedule{}, err
+	}
+	if spec.HistoryLimit <= 0 {
+		spec.HistoryLimit = defaultHistoryLimit
+	}
+	concurrency, err := ParseConcurrencyPolicy(string(spec.Concurrency))
+	if err != nil {
+		return Schedule{}, err
+	}
+	spec.Concurrency = concurrency
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return Schedule{}, err
+	}
+	sc, err := newSchedule(Schedule{ID: id, Spec: spec, CreatedAt: s.now()})
+	if err != nil {
+		return Schedule{}, err
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.closed {
+		return Schedule{}, ErrShuttingDown
+	}
+	s.schedules[id] = sc
+	s.resume(sc)
+	s.save()
+
+	log.Printf("[scheduler] schedule created: %v, cron: %q", id, spec.Cron)
+	return sc.info, nil
+}
+
+func newSchedule(info Schedule) (*schedule, error) {
+	location := time.Local
+	if info.Spec.TimeZone != "" {
+		var err error
+		location, err = time.LoadLocation(info.Spec.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone: %w", err)
+		}
+	}
+	c, err := cronParser.Parse(info.Spec.Cron)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression: %w", err)
+	}
+	// e.g. "0 0 30 2 *", Next returns zero time for it and schedule would fire in a loop
+	if c.Next(time.Now().In(location)).IsZero() {
+		return nil, fmt.Errorf("cron expression %q never fires", info.Spec.Cron)
+	}
+	return &schedule{info: info, cron: c, location: location}, nil
+}
+
+func (s *scheduler) ListSchedules(ctx context.Context) ([]Schedule, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	res := make([]Schedule, 0, len(s.schedules))
+	for _, sc := range s.schedules {
+		res = append(res, sc.info)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].CreatedAt.Before(res[j].CreatedAt)
+	})
+	return res, nil
+}
+
+// DeleteSchedule stops firing of schedule, jobs already started by it are kept
+func (s *scheduler) DeleteSchedule(ctx context.Context, id uuid.UUID) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	sc, ok := s.schedules[id]
+	if !ok {
+		return ErrScheduleNotFound
+	}
+	s.pause(sc)
+	delete(s.schedules, id)
+	s.save()
+
+	log.Printf("[scheduler] schedule deleted: %v", id)
+	return nil
+}
+
+func (s *scheduler) PauseSchedule(ctx context.Context, id uuid.UUID, paused bool) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	sc, ok := s.schedules[id]
+	if !ok {
+		return ErrScheduleNotFound
+	}
+	if paused {
+		s.pause(sc)
+	} else {
+		s.resume(sc)
+	}
+	s.save()
+	return nil
+}
+
+func (s *scheduler) Close() {
+	s.mtx.Lock()
+	s.closed = true
+	for _, sc := range s.schedules {
+		if sc.stop != nil {
+			close(sc.stop)
+			sc.stop = nil
+		}
+	}
+	s.mtx.Unlock()
+	s.wg.Wait()
+}
+
+// resume starts firing of schedule, s.mtx has to be locked
+func (s *scheduler) resume(sc *schedule) {
+	sc.info.Paused = false
+	if sc.stop != nil || s.closed {
+		return
+	}
+	sc.stop = make(chan struct{})
+	sc.info.NextRun = sc.cron.Next(s.now().In(sc.location))
+
+	s.wg.Add(1)
+	go s.run(sc, sc.stop)
+}
+
+// pause stops firing of schedule, s.mtx has to be locked
+func (s *scheduler) pause(sc *schedule) {
+	sc.info.Paused = true
+	sc.info.NextRun = time.Time{}
+	if sc.stop != nil {
+		close(sc.stop)
+		sc.stop = nil
+	}
+}
+
+// run fires schedule until stop is closed
+func (s *scheduler) run(sc *schedule, stop <-chan struct{}) {
+	defer s.wg.Done()
+
+	for {
+		s.mtx.Lock()
+		next := sc.info.NextRun
+		s.mtx.Unlock()
+		if next.IsZero() {
+			log.Printf("[scheduler] schedule %v has no next run, it won't fire anymore", sc.info.ID)
+			return
+		}
+
+		timer := time.NewTimer(next.Sub(s.now()))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		s.fire(sc)
+
+		s.mtx.Lock()
+		select {
+		case <-stop:
+		default:
+			sc.info.NextRun = sc.cron.Next(s.now().In(sc.location))
+		}
+		s.mtx.Unlock()
+	}
+}
+
+// fire starts job of schedule according to its concurrency policy and removes
+// finished jobs over history limit
+func (s *scheduler) fire(sc *schedule) {
+	s.mtx.Lock()
+	info := sc.info
+	s.mtx.Unlock()
+
+	ctx := context.Background()
+	jobs, err := s.worker.List(ctx, Selector{{key: ScheduleLabel, op: opEquals, values: []string{info.ID.String()}}})
+	if err != nil {
+		log.Printf("[scheduler] failed to list jobs of schedule %v: %v", info.ID, err)
+		return
+	}
+
+	var active []JobInfo
+	for _, j := range jobs {
+		if j.Status.FinishedAt.IsZero() {
+			active = append(active, j)
+		}
+	}
+	if len(active) > 0 {
+		switch info.Spec.Concurrency {
+		case ConcurrencyForbid:
+			log.Printf("[scheduler] run of schedule %v skipped, previous job is still running", info.ID)
+			return
+		case ConcurrencyReplace:
+			for _, j := range active {
+				if err := s.worker.Stop(ctx, j.ID); err != nil {
+					log.Printf("[scheduler] failed to stop job %v of schedule %v: %v", j.ID, info.ID, err)
+				}
+			}
+		}
+	}
+
+	command := info.Spec.Command
+	command.Labels = make(map[string]string, len(info.Spec.Command.Labels)+1)
+	for k, v := range info.Spec.Command.Labels {
+		command.Labels[k] = v
+	}
+	command.Labels[ScheduleLabel] = info.ID.String()
+
+	// policy may have changed since schedule was created
+	var jobID uuid.UUID
+	if s.check != nil {
+		err = s.check(command, info.Spec.Owner, info.Spec.Roles)
+	}
+	if err == nil {
+		var opts []StartOption
+		if info.Spec.Quota != nil {
+			opts = append(opts, WithQuota(*info.Spec.Quota))
+		}
+		jobID, err = s.worker.Start(ctx, command, opts...)
+	}
+	if err != nil {
+		log.Printf("[scheduler] failed to start job of schedule %v: %v", info.ID, err)
+	} else {
+		log.Printf("[scheduler] job %v started by schedule %v", jobID, info.ID)
+		s.mtx.Lock()
+		sc.info.LastRun = s.now()
+		sc.info.LastJobID = jobID
+		s.save()
+		s.mtx.Unlock()
+	}
+
+	s.cleanupHistory(ctx, info, jobs)
+}
+
+// cleanupHistory deletes the oldest finished jobs of schedule over history limit
+func (s *scheduler) cleanupHistory(ctx context.Context, info Schedule, jobs []JobInfo) {
+	var finished []JobInfo
+	for _, j := range jobs {
+		if !j.Status.FinishedAt.IsZero() {
+			finished = append(finished, j)
+		}
+	}
+	if len(finished) <= info.Spec.HistoryLimit {
+		return
+	}
+
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].Status.StartedAt.Before(finished[j].Status.StartedAt)
+	})
+	for _, j := range finished[:len(finished)-info.Spec.HistoryLimit] {
+		if err := s.worker.Delete(ctx, j.ID); err != nil && !errors.Is(err, ErrJobNotFound) {
+			log.Printf("[scheduler] failed to delete job %v of schedule %v: %v", j.ID, info.ID, err)
+		}
+	}
+}
+
+// save records schedules in state file, s.mtx has to be locked
+func (s *scheduler) save() {
+	if s.stateFile == "" {
+		return
+	}
+
+	schedules := make([]Schedule, 0, len(s.schedules))
+	for _, sc := range s.schedules {
+		schedules = append(schedules, sc.info)
+	}
+	data, err := json.Marshal(schedules)
+	if err == nil {
+		tmp := s.stateFile + ".tmp"
+		if err = os.WriteFile(tmp, data, 0600); err == nil {
+			err = os.Rename(tmp, s.stateFile)
+		}
+	}
+	if err != nil {
+		log.Printf("[scheduler] failed to save schedules: %v", err)
+	}
+}
+
+// restore loads schedules saved by a previous scheduler
+func (s *scheduler) restore() {
+	data, err := os.ReadFile(s.stateFile)
+	if os.IsNotExist(err) {
+		return
+	}
+	var schedules []Schedule
+	if err == nil {
+		err = json.Unmarshal(data, &schedules)
+	}
+	if err != nil {
+		log.Printf("[scheduler] failed to restore schedules: %v", err)
+		return
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for _, info := range schedules {
+		sc, err := newSchedule(info)
+		if err != nil {
+			log.Printf("[scheduler] failed to restore schedule %v: %v", info.ID, err)
+			continue
+		}
+		s.schedules[info.ID] = sc
+		if !info.Paused {
+			s.resume(sc)
+		}
+	}
+	log.Printf("[scheduler] %v schedules restored", len(s.schedules))
+}
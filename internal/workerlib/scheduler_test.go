@@ -0,0 +1,215 @@
+package workerlib
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/supby/job-worker/internal/workerlib/job"
+)
+
+func newTestSchedule(t *testing.T, spec ScheduleSpec) *schedule {
+	sc, err := newSchedule(Schedule{ID: uuid.New(), Spec: spec})
+	assert.NoError(t, err)
+	return sc
+}
+
+func scheduleJobs(t *testing.T, w Worker, id uuid.UUID) []JobInfo {
+	selector, err := ParseSelector(ScheduleLabel + "=" + id.String())
+	assert.NoError(t, err)
+	jobs, err := w.List(context.Background(), selector)
+	assert.NoError(t, err)
+	return jobs
+}
+
+func TestScheduleFires(t *testing.T) {
+	w := New()
+	s := NewScheduler(w, "", nil)
+	defer s.Close()
+
+	created, err := s.CreateSchedule(context.Background(), ScheduleSpec{
+		Cron:     "* * * * * *",
+		TimeZone: "UTC",
+		Command:  job.Command{Name: "true", Labels: map[string]string{"task": "cleanup"}},
+	})
+	assert.NoError(t, err)
+	assert.False(t, created.NextRun.IsZero())
+	assert.Equal(t, ConcurrencyAllow, created.Spec.Concurrency)
+
+	assert.Eventually(t, func() bool {
+		return len(scheduleJobs(t, w, created.ID)) > 0
+	}, 3*time.Second, 50*time.Millisecond)
+
+	jobs := scheduleJobs(t, w, created.ID)
+	assert.Equal(t, "cleanup", jobs[0].Status.Labels["task"])
+
+	schedules, err := s.ListSchedules(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, schedules, 1)
+	assert.Equal(t, jobs[0].ID, schedules[0].LastJobID)
+}
+
+func TestScheduleConcurrencyPolicy(t *testing.T) {
+	w := New()
+	s := NewScheduler(w, "", nil).(*scheduler)
+	defer s.Close()
+
+	forbid := newTestSchedule(t, ScheduleSpec{Cron: "@daily", Command: job.Command{Name: "sleep", Arguments: []string{"10"}}, Concurrency: ConcurrencyForbid, HistoryLimit: 10})
+	s.fire(forbid)
+	s.fire(forbid)
+	jobs := scheduleJobs(t, w, forbid.info.ID)
+	assert.Len(t, jobs, 1)
+	assert.NoError(t, w.Stop(context.Background(), jobs[0].ID))
+
+	allow := newTestSchedule(t, ScheduleSpec{Cron: "@daily", Command: job.Command{Name: "sleep", Arguments: []string{"10"}}, Concurrency: ConcurrencyAllow, HistoryLimit: 10})
+	s.fire(allow)
+	s.fire(allow)
+	jobs = scheduleJobs(t, w, allow.info.ID)
+	assert.Len(t, jobs, 2)
+	for _, j := range jobs {
+		assert.NoError(t, w.Stop(context.Background(), j.ID))
+	}
+
+	replace := newTestSchedule(t, ScheduleSpec{Cron: "@daily", Command: job.Command{Name: "sleep", Arguments: []string{"10"}}, Concurrency: ConcurrencyReplace, HistoryLimit: 10})
+	s.fire(replace)
+	first := replace.info.LastJobID
+	s.fire(replace)
+	assert.NotEqual(t, first, replace.info.LastJobID)
+
+	assert.Eventually(t, func() bool {
+		status, err := w.QueryStatus(context.Background(), first)
+		return err == nil && status.StatusCode == job.STOPPED
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.NoError(t, w.Stop(context.Background(), replace.info.LastJobID))
+}
+
+func TestScheduleHistoryLimit(t *testing.T) {
+	w := New()
+	s := NewScheduler(w, "", nil).(*scheduler)
+	defer s.Close()
+
+	sc := newTestSchedule(t, ScheduleSpec{Cron: "@daily", Command: job.Command{Name: "true"}, HistoryLimit: 2})
+	for i := 0; i < 4; i++ {
+		s.fire(sc)
+		assert.Eventually(t, func() bool {
+			status, err := w.QueryStatus(context.Background(), sc.info.LastJobID)
+			return err == nil && !status.FinishedAt.IsZero()
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+	s.fire(sc)
+
+	// finished jobs over limit are deleted before the latest run
+	assert.Len(t, scheduleJobs(t, w, sc.info.ID), 3)
+}
+
+func TestScheduleStartCheck(t *testing.T) {
+	w := New()
+	var checked []string
+	s := NewScheduler(w, "", func(command job.Command, owner string, roles []string) error {
+		checked = append(checked, owner)
+		if command.Name == "rm" {
+			return errors.New("command is denied")
+		}
+		return nil
+	}).(*scheduler)
+	defer s.Close()
+
+	allowed := newTestSchedule(t, ScheduleSpec{Cron: "@daily", Command: job.Command{Name: "true"}, HistoryLimit: 10, Owner: "alice"})
+	s.fire(allowed)
+	assert.Len(t, scheduleJobs(t, w, allowed.info.ID), 1)
+
+	denied := newTestSchedule(t, ScheduleSpec{Cron: "@daily", Command: job.Command{Name: "rm"}, HistoryLimit: 10, Owner: "bob"})
+	s.fire(denied)
+	assert.Empty(t, scheduleJobs(t, w, denied.info.ID))
+	assert.True(t, denied.info.LastRun.IsZero())
+	assert.Equal(t, []string{"alice", "bob"}, checked)
+}
+
+func TestScheduleQuota(t *testing.T) {
+	w := New()
+	s := NewScheduler(w, "", nil).(*scheduler)
+	defer s.Close()
+
+	sc := newTestSchedule(t, ScheduleSpec{Cron: "@daily", Command: job.Command{Name: "sleep", Arguments: []string{"10"}}, HistoryLimit: 10,
+		Owner: "alice", Quota: &Quota{Owner: "alice", MaxRunningJobs: 1}})
+	s.fire(sc)
+	s.fire(sc)
+	jobs := scheduleJobs(t, w, sc.info.ID)
+	assert.Len(t, jobs, 1)
+	assert.NoError(t, w.Stop(context.Background(), jobs[0].ID))
+}
+
+func TestPauseAndDeleteSchedule(t *testing.T) {
+	stateDir := t.TempDir()
+	s := NewScheduler(New(), stateDir, nil)
+
+	created, err := s.CreateSchedule(context.Background(), ScheduleSpec{Cron: "0 3 * * *", TimeZone: "Europe/Berlin", Command: job.Command{Name: "true"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, created.NextRun.In(mustLoadLocation(t, "Europe/Berlin")).Hour())
+
+	assert.NoError(t, s.PauseSchedule(context.Background(), created.ID, true))
+	schedules, err := s.ListSchedules(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, schedules[0].Paused)
+	assert.True(t, schedules[0].NextRun.IsZero())
+	s.Close()
+
+	// schedules are restored from state directory
+	restored := NewScheduler(New(), stateDir, nil)
+	defer restored.Close()
+	schedules, err = restored.ListSchedules(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, schedules, 1)
+	assert.True(t, schedules[0].Paused)
+
+	assert.NoError(t, restored.PauseSchedule(context.Background(), created.ID, false))
+	schedules, err = restored.ListSchedules(context.Background())
+	assert.NoError(t, err)
+	assert.False(t, schedules[0].NextRun.IsZero())
+
+	assert.NoError(t, restored.DeleteSchedule(context.Background(), created.ID))
+	assert.ErrorIs(t, restored.DeleteSchedule(context.Background(), created.ID), ErrScheduleNotFound)
+	assert.ErrorIs(t, restored.PauseSchedule(context.Background(), created.ID, true), ErrScheduleNotFound)
+}
+
+func TestCreateInvalidSchedule(t *testing.T) {
+	s := NewScheduler(New(), "", nil)
+	defer s.Close()
+
+	for _, spec := range []ScheduleSpec{
+		{Cron: "not a cron", Command: job.Command{Name: "true"}},
+		{Cron: "@daily", TimeZone: "Nowhere/City", Command: job.Command{Name: "true"}},
+		{Cron: "@daily", Concurrency: "sometimes", Command: job.Command{Name: "true"}},
+		{Cron: "@daily", Command: job.Command{Name: "cat", Interactive: true}},
+		{Cron: "0 0 30 2 *", Command: job.Command{Name: "true"}},
+	} {
+		_, err := s.CreateSchedule(context.Background(), spec)
+		assert.Error(t, err, spec.Cron)
+	}
+}
+
+func TestRestoreScheduleNeverFiring(t *testing.T) {
+	stateDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(stateDir, schedulesFile), []byte(`[
+		{"ID": "8d7c2a9e-4e40-4a4b-9d5b-0c1f1f2b6a11", "Spec": {"Cron": "0 0 30 2 *", "Command": {"Name": "true"}}},
+		{"ID": "6f0b1c3e-5a2d-4e8f-9b7c-1d2e3f4a5b6c", "Spec": {"Cron": "@daily", "Command": {"Name": "true"}}}
+	]`), 0600))
+
+	s := NewScheduler(New(), stateDir, nil)
+	defer s.Close()
+	schedules, err := s.ListSchedules(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, schedules, 1)
+	assert.Equal(t, "@daily", schedules[0].Spec.Cron)
+}
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	location, err := time.LoadLocation(name)
+	assert.NoError(t, err)
+	return location
+}
@@ -0,0 +1,179 @@
+package workerlib
+
+import (
+	"fmt"
+	"strings"
+)
+
+type selectorOp int
+
+const (
+	opEquals selectorOp = iota
+	opNotEquals
+	opIn
+	opNotIn
+	opExists
+	opNotExists
+)
+
+// requirement is one comma separated term of label selector
+type requirement struct {
+	key    string
+	op     selectorOp
+	values []string
+}
+
+// Selector matches jobs by labels. Nil or empty selector matches every job.
+type Selector []requirement
+
+// ParseSelector parses label selector, terms are separated by commas and all of
+// them must match:
+//
+//	key=value, key==value   label is set to value
+//	key!=value              label is not set to value or is missing
+//	key in (v1,v2)          label is set to one of values
+//	key notin (v1,v2)       label is not set to any of values or is missing
+//	key                     label is set
+//	!key                    label is not set
+func ParseSelector(s string) (Selector, error) {
+	var sel Selector
+	for _, term := range splitTerms(s) {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		r, err := parseRequirement(term)
+		if err != nil {
+			return nil, err
+		}
+		sel = append(sel, r)
+	}
+	return sel, nil
+}
+
+// splitTerms splits selector by commas which are not inside of value lists
+func splitTerms(s string) []string {
+	var terms []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				terms = append(terms, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(terms, s[start:])
+}
+
+func parseRequirement(term string) (requirement, error) {
+	if key, ok := strings.CutPrefix(term, "!"); ok {
+		return newRequirement(term, key, opNotExists, nil)
+	}
+	if key, value, ok := strings.Cut(term, "!="); ok {
+		return newRequirement(term, key, opNotEquals, []string{value})
+	}
+	if key, value, ok := strings.Cut(term, "=="); ok {
+		return newRequirement(term, key, opEquals, []string{value})
+	}
+	if key, value, ok := strings.Cut(term, "="); ok {
+		return newRequirement(term, key, opEquals, []string{value})
+	}
+
+	fields := strings.Fields(term)
+	if len(fields) == 1 {
+		return newRequirement(term, fields[0], opExists, nil)
+	}
+
+	key, rest, _ := strings.Cut(term, " ")
+	rest = strings.TrimSpace(rest)
+	op := opIn
+	if list, ok := strings.CutPrefix(rest, "notin"); ok {
+		op, rest = opNotIn, list
+	} else if list, ok := strings.CutPrefix(rest, "in"); ok {
+		rest = list
+	} else {
+		return requirement{}, fmt.Errorf("invalid selector term %q", term)
+	}
+
+	rest = strings.TrimSpace(rest)
+	if !strings.HasPrefix(rest, "(") || !strings.HasSuffix(rest, ")") {
+		return requirement{}, fmt.Errorf("invalid value list in selector term %q", term)
+	}
+	var values []string
+	for _, v := range strings.Split(rest[1:len(rest)-1], ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 0 {
+		return requirement{}, fmt.Errorf("empty value list in selector term %q", term)
+	}
+	return newRequirement(term, key, op, values)
+}
+
+// invalidKeyChars can't be used in label keys as they are part of selector syntax
+const invalidKeyChars = " ()!=,"
+
+// ValidateLabels checks that labels can be matched by selectors
+func ValidateLabels(labels map[string]string) error {
+	for key, value := range labels {
+		if key == "" || strings.ContainsAny(key, invalidKeyChars) {
+			return fmt.Errorf("invalid label key %q", key)
+		}
+		if strings.ContainsAny(value, "(),") || value != strings.TrimSpace(value) {
+			return fmt.Errorf("invalid value of label %q", key)
+		}
+	}
+	return nil
+}
+
+func newRequirement(term string, key string, op selectorOp, values []string) (requirement, error) {
+	key = strings.TrimSpace(key)
+	if key == "" || strings.ContainsAny(key, invalidKeyChars) {
+		return requirement{}, fmt.Errorf("invalid label key in selector term %q", term)
+	}
+	for i := range values {
+		values[i] = strings.TrimSpace(values[i])
+	}
+	return requirement{key: key, op: op, values: values}, nil
+}
+
+// Matches reports whether labels satisfy all terms of selector
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, r := range s {
+		if !r.matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r requirement) matches(labels map[string]string) bool {
+	value, ok := labels[r.key]
+	switch r.op {
+	case opEquals, opIn:
+		return ok && contains(r.values, value)
+	case opNotEquals, opNotIn:
+		return !ok || !contains(r.values, value)
+	case opExists:
+		return ok
+	case opNotExists:
+		return !ok
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
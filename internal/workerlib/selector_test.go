@@ -0,0 +1,55 @@
+package workerlib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectorMatches(t *testing.T) {
+	labels := map[string]string{"pipeline": "build", "commit": "abc123", "team": "core"}
+
+	for selector, expected := range map[string]bool{
+		"":                                   true,
+		"pipeline=build":                     true,
+		"pipeline==build":                    true,
+		"pipeline=test":                      false,
+		"pipeline!=test":                     true,
+		"pipeline!=build":                    false,
+		"missing!=value":                     true,
+		"team in (core,infra)":               true,
+		"team in (infra)":                    false,
+		"team notin (infra, qa)":             true,
+		"team notin (core)":                  false,
+		"commit":                             true,
+		"!commit":                            false,
+		"!missing":                           true,
+		"pipeline=build, team in (core, qa)": true,
+		"pipeline=build,team!=core":          false,
+	} {
+		sel, err := ParseSelector(selector)
+		assert.NoError(t, err, selector)
+		assert.Equal(t, expected, sel.Matches(labels), selector)
+	}
+}
+
+func TestParseSelectorErrors(t *testing.T) {
+	for _, selector := range []string{
+		"=value",
+		"team in core",
+		"team in ()",
+		"team within (core)",
+		"bad key=value",
+		"!",
+	} {
+		_, err := ParseSelector(selector)
+		assert.Error(t, err, selector)
+	}
+}
+
+func TestValidateLabels(t *testing.T) {
+	assert.NoError(t, ValidateLabels(map[string]string{"pipeline": "build", "commit": "abc123", "empty": ""}))
+	assert.Error(t, ValidateLabels(map[string]string{"": "value"}))
+	assert.Error(t, ValidateLabels(map[string]string{"team=core": "value"}))
+	assert.Error(t, ValidateLabels(map[string]string{"team": "core,infra"}))
+}
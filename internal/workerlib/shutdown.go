@@ -0,0 +1,104 @@
+package workerlib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/supby/job-worker/internal/workerlib/job"
+)
+
+// ErrShuttingDown is returned by Start once worker shutdown began
+var ErrShuttingDown = errors.New("worker is shutting down")
+
+// ShutdownMode is policy for running jobs when worker shuts down
+type ShutdownMode string
+
+const (
+	// ShutdownDrain waits for running jobs to finish, jobs still running after timeout are killed
+	ShutdownDrain ShutdownMode = "drain"
+	// ShutdownTerminate sends SIGTERM to running jobs, jobs still running after timeout are killed
+	ShutdownTerminate ShutdownMode = "terminate"
+	// ShutdownDetach leaves jobs running
+	ShutdownDetach ShutdownMode = "detach"
+)
+
+// ParseShutdownMode validates mode name, empty name means ShutdownTerminate
+func ParseShutdownMode(mode string) (ShutdownMode, error) {
+	switch ShutdownMode(mode) {
+	case "":
+		return ShutdownTerminate, nil
+	case ShutdownDrain, ShutdownTerminate, ShutdownDetach:
+		return ShutdownMode(mode), nil
+	default:
+		return "", fmt.Errorf("unknown shutdown mode: %q", mode)
+	}
+}
+
+func (w *worker) Shutdown(ctx context.Context, mode ShutdownMode) error {
+	w.shuttingDown.Store(true)
+	w.cancelQueued()
+	w.resumePaused()
+
+	switch mode {
+	case ShutdownDetach:
+		log.Printf("[worker] leaving %d jobs running", w.running.Load())
+		return nil
+	case ShutdownTerminate:
+		for _, j := range w.runningJobs() {
+			if err := j.Terminate(); err != nil {
+				log.Printf("[worker] failed to terminate job %v: %v", j.GetID(), err)
+			}
+		}
+	}
+
+	err := w.waitJobs(ctx)
+	if err != nil {
+		for _, j := range w.runningJobs() {
+			log.Printf("[worker] job %v is still running after shutdown timeout, killing it", j.GetID())
+			if stopErr := j.Stop(); stopErr != nil {
+				log.Printf("[worker] failed to stop job %v: %v", j.GetID(), stopErr)
+			}
+		}
+	}
+	return err
+}
+
+// resumePaused thaws paused jobs, so that they can finish or outlive the server
+func (w *worker) resumePaused() {
+	for _, j := range w.runningJobs() {
+		if j.GetStatus().StatusCode != job.PAUSED {
+			continue
+		}
+		if err := j.Resume(); err != nil && !errors.Is(err, job.ErrNotPaused) {
+			log.Printf("[worker] failed to resume job %v: %v", j.GetID(), err)
+		}
+	}
+}
+
+// waitJobs waits until all jobs are finished or ctx is done
+func (w *worker) waitJobs(ctx context.Context) error {
+	for _, j := range w.runningJobs() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-j.Done():
+		}
+	}
+	return nil
+}
+
+func (w *worker) runningJobs() []job.Job {
+	var jobs []job.Job
+	w.jobs.Range(func(key, value interface{}) bool {
+		j := value.(job.Job)
+		select {
+		case <-j.Done():
+		default:
+			jobs = append(jobs, j)
+		}
+		return true
+	})
+	return jobs
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/supby/job-worker/internal/workerlib/job"
@@ -14,42 +17,244 @@ import (
 // ErrJobNotFound is returned when a job with the given ID is not found
 var ErrJobNotFound = errors.New("job not found")
 
+// ErrWorkerSaturated is returned when maximum number of running jobs is reached and queue is full
+var ErrWorkerSaturated = errors.New("worker is saturated")
+
+// ErrJobRunning is returned when job has to be finished for operation, e.g. delete
+var ErrJobRunning = errors.New("job is running")
+
 // Worker interface responsible for managing jobs
 type Worker interface {
-	Start(ctx context.Context, command job.Command) (uuid.UUID, error)
+	Start(ctx context.Context, command job.Command, opts ...StartOption) (uuid.UUID, error)
 	Stop(ctx context.Context, jobID uuid.UUID) error
+	// Pause freezes process tree of running job, paused job keeps its running slot
+	Pause(ctx context.Context, jobID uuid.UUID) error
+	Resume(ctx context.Context, jobID uuid.UUID) error
 	QueryStatus(ctx context.Context, jobID uuid.UUID) (*job.Status, error)
+	// Wait blocks until job is finished, including its retries and restarts, and returns final status
+	Wait(ctx context.Context, jobID uuid.UUID) (*job.Status, error)
 	GetStream(ctx context.Context, jobID uuid.UUID) (<-chan []byte, error)
+	GetStreamFrom(ctx context.Context, jobID uuid.UUID, offset int64) (<-chan []byte, error)
+	GetInput(ctx context.Context, jobID uuid.UUID) (io.WriteCloser, error)
+	Resize(ctx context.Context, jobID uuid.UUID, size job.TerminalSize) error
+	// List returns jobs whose labels match selector, nil selector matches all jobs
+	List(ctx context.Context, selector Selector) ([]JobInfo, error)
+	// Saturated reports whether worker can't accept new jobs, neither start nor queue them
+	Saturated() bool
+	// Shutdown stops accepting new jobs and applies mode to running jobs, waiting
+	// for them until ctx is done
+	Shutdown(ctx context.Context, mode ShutdownMode) error
+	// SetMaxRunningJobs changes limit of running jobs, already running jobs are not
+	// affected and queued jobs are started when the limit is raised
+	SetMaxRunningJobs(n int)
+	// Delete removes finished job together with its output and state
+	Delete(ctx context.Context, jobID uuid.UUID) error
 	Cleanup(ctx context.Context) error
 }
 
+// JobInfo describes one job known to the worker
+type JobInfo struct {
+	ID     uuid.UUID
+	Status *job.Status
+}
+
 type worker struct {
-	jobs sync.Map
+	jobs       sync.Map
+	maxRunning atomic.Int64
+	running    atomic.Int64
+	// owners counts running jobs started with a quota, keyed by owner
+	owners    map[string]int
+	ownersMtx sync.Mutex
+
+	shuttingDown atomic.Bool
+
+	stateDir  string
+	cgroupDir string
+
+	idempotencyWindow time.Duration
+	idempotency       *idempotencyCache
+
+	// queue holds jobs waiting for a running slot, active are started jobs
+	queue      jobQueue
+	active     map[uuid.UUID]*jobEntry
+	queueMtx   sync.Mutex
+	maxQueued  int
+	queueAging time.Duration
+	created    time.Time
+
+	preemption      bool
+	preemptionGrace time.Duration
 }
 
 // New creates a new Worker instance
-func New() Worker {
-	return &worker{}
+func New(opts ...Option) Worker {
+	w := &worker{
+		owners:          map[string]int{},
+		active:          map[uuid.UUID]*jobEntry{},
+		queueAging:      defaultQueueAging,
+		preemptionGrace: defaultPreemptionGrace,
+		created:         time.Now(),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	if w.cgroupDir != "" {
+		w.initCgroupDir()
+	}
+	w.idempotency = newIdempotencyCache(w.idempotencyWindow)
+	if w.stateDir != "" {
+		w.adoptJobs()
+	}
+	return w
 }
 
-func (w *worker) Start(ctx context.Context, command job.Command) (uuid.UUID, error) {
+func (w *worker) Start(ctx context.Context, command job.Command, opts ...StartOption) (uuid.UUID, error) {
+	var o startOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.idempotencyKey != "" {
+		return w.idempotency.start(ctx, o.idempotencyKey, command, func() (uuid.UUID, error) {
+			return w.start(ctx, command, o)
+		})
+	}
+	return w.start(ctx, command, o)
+}
+
+func (w *worker) start(ctx context.Context, command job.Command, o startOptions) (uuid.UUID, error) {
 	select {
 	case <-ctx.Done():
 		return job.NilJobId, ctx.Err()
 	default:
-		j, err := job.StartNew(command)
-		if err != nil {
-			return job.NilJobId, fmt.Errorf("[worker] failed to start job: %w", err)
+		if w.shuttingDown.Load() {
+			return job.NilJobId, ErrShuttingDown
 		}
 
+		quota, hasQuota := o.quota, o.hasQuota
+		if hasQuota && !w.acquireOwner(quota) {
+			return job.NilJobId, ErrQuotaExceeded
+		}
+
+		var jobOpts []job.Option
+		if w.stateDir != "" {
+			jobOpts = append(jobOpts, job.WithStateDir(w.stateDir))
+		}
+		if w.cgroupDir != "" {
+			jobOpts = append(jobOpts, job.WithCgroupDir(w.cgroupDir))
+		}
+		e := &jobEntry{command: command, quota: quota, hasQuota: hasQuota, index: -1}
+
+		w.queueMtx.Lock()
+		// queued jobs go first, new job can't take slot freed for them
+		if w.queue.Len() == 0 && w.acquire() {
+			w.queueMtx.Unlock()
+			return w.startEntry(e, jobOpts)
+		}
+		defer w.queueMtx.Unlock()
+
+		if w.queue.Len() >= w.maxQueued {
+			if hasQuota {
+				w.releaseOwner(quota.Owner)
+			}
+			return job.NilJobId, ErrWorkerSaturated
+		}
+		j, err := job.New(command, jobOpts...)
+		if err != nil {
+			if hasQuota {
+				w.releaseOwner(quota.Owner)
+			}
+			jobsErrored.Inc(otherCommand)
+			return job.NilJobId, fmt.Errorf("[worker] failed to queue job: %w", err)
+		}
+		e.job = j
 		jobID := j.GetID()
 		w.jobs.Store(jobID, j)
+		w.enqueue(e)
+		go w.watchJob(e)
 
-		log.Printf("[worker] Job started: %x", jobID[:])
+		log.Printf("[worker] Job queued: %v, priority: %d", jobID, command.Priority)
 		return jobID, nil
 	}
 }
 
+// startEntry starts job of entry which already holds running slot
+func (w *worker) startEntry(e *jobEntry, jobOpts []job.Option) (uuid.UUID, error) {
+	j, err := job.StartNew(e.command, jobOpts...)
+	if err != nil {
+		w.running.Add(-1)
+		if e.hasQuota {
+			w.releaseOwner(e.quota.Owner)
+		}
+		jobsErrored.Inc(otherCommand)
+		return job.NilJobId, fmt.Errorf("[worker] failed to start job: %w", err)
+	}
+	e.job = j
+
+	jobID := j.GetID()
+	w.jobs.Store(jobID, j)
+
+	w.queueMtx.Lock()
+	w.activate(e)
+	w.queueMtx.Unlock()
+	go w.watchJob(e)
+
+	log.Printf("[worker] Job started: %v", jobID)
+	return jobID, nil
+}
+
+// acquire reserves slot for a new running job
+func (w *worker) acquire() bool {
+	for {
+		running := w.running.Load()
+		if maxRunning := w.maxRunning.Load(); maxRunning > 0 && running >= maxRunning {
+			return false
+		}
+		if w.running.CompareAndSwap(running, running+1) {
+			return true
+		}
+	}
+}
+
+func (w *worker) Saturated() bool {
+	maxRunning := w.maxRunning.Load()
+	return maxRunning > 0 && w.running.Load() >= maxRunning && w.queueFull()
+}
+
+func (w *worker) SetMaxRunningJobs(n int) {
+	w.maxRunning.Store(int64(n))
+	w.dispatch()
+}
+
+// watchJob releases job's slots and records metrics once job is finished, freed
+// running slot is given to queued job
+func (w *worker) watchJob(e *jobEntry) {
+	j := e.job
+	<-j.Done()
+
+	status := j.GetStatus()
+	started := w.release(e)
+	if e.hasQuota {
+		w.releaseOwner(e.quota.Owner)
+	}
+	if !started {
+		// job was stopped while queued or failed to start
+		return
+	}
+	w.running.Add(-1)
+	defer w.dispatch()
+
+	jobsRunning.Dec()
+	switch status.StatusCode {
+	case job.STOPPED:
+		jobsStopped.Inc(commandLabel(status.CommandName))
+	case job.PREEMPTED:
+		jobsPreempted.Inc(commandLabel(status.CommandName))
+	default:
+		jobsExited.Inc(commandLabel(status.CommandName))
+	}
+	jobDuration.Observe(status.FinishedAt.Sub(status.StartedAt).Seconds(), commandLabel(status.CommandName))
+}
+
 func (w *worker) Stop(ctx context.Context, jobID uuid.UUID) error {
 	j, err := w.getJob(jobID)
 	if err != nil {
@@ -64,11 +269,69 @@ func (w *worker) Stop(ctx context.Context, jobID uuid.UUID) error {
 		if err != nil {
 			return fmt.Errorf("[worker] failed to stop job %v: %w", jobID, err)
 		}
-		log.Printf("[worker] Job stopped: %x", jobID[:])
+		log.Printf("[worker] Job stopped: %v", jobID)
+		return nil
+	}
+}
+
+func (w *worker) Pause(ctx context.Context, jobID uuid.UUID) error {
+	j, err := w.getJob(jobID)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		if err := j.Pause(); err != nil {
+			return fmt.Errorf("[worker] failed to pause job %v: %w", jobID, err)
+		}
+		log.Printf("[worker] Job paused: %v", jobID)
+		return nil
+	}
+}
+
+func (w *worker) Resume(ctx context.Context, jobID uuid.UUID) error {
+	j, err := w.getJob(jobID)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		if err := j.Resume(); err != nil {
+			return fmt.Errorf("[worker] failed to resume job %v: %w", jobID, err)
+		}
+		log.Printf("[worker] Job resumed: %v", jobID)
 		return nil
 	}
 }
 
+func (w *worker) Delete(ctx context.Context, jobID uuid.UUID) error {
+	j, err := w.getJob(jobID)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-j.Done():
+	default:
+		return ErrJobRunning
+	}
+
+	if _, loaded := w.jobs.LoadAndDelete(jobID); !loaded {
+		return ErrJobNotFound
+	}
+	if err := j.Cleanup(ctx); err != nil {
+		return fmt.Errorf("[worker] failed to clean up job %v: %w", jobID, err)
+	}
+	log.Printf("[worker] Job deleted: %v", jobID)
+	return nil
+}
+
 func (w *worker) getJob(jobID uuid.UUID) (job.Job, error) {
 	if j, ok := w.jobs.Load(jobID); ok {
 		return j.(job.Job), nil
@@ -90,13 +353,76 @@ func (w *worker) QueryStatus(ctx context.Context, jobID uuid.UUID) (*job.Status,
 	}
 }
 
+func (w *worker) Wait(ctx context.Context, jobID uuid.UUID) (*job.Status, error) {
+	j, err := w.getJob(jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-j.Done():
+		return j.GetStatus(), nil
+	}
+}
+
 func (w *worker) GetStream(ctx context.Context, jobID uuid.UUID) (<-chan []byte, error) {
 	j, err := w.getJob(jobID)
 	if err != nil {
 		return nil, err
 	}
 
-	return j.GetStream(ctx), nil
+	return j.GetStream(ctx)
+}
+
+func (w *worker) GetStreamFrom(ctx context.Context, jobID uuid.UUID, offset int64) (<-chan []byte, error) {
+	j, err := w.getJob(jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	return j.GetStreamFrom(ctx, offset)
+}
+
+func (w *worker) GetInput(ctx context.Context, jobID uuid.UUID) (io.WriteCloser, error) {
+	j, err := w.getJob(jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	return j.GetInput()
+}
+
+func (w *worker) Resize(ctx context.Context, jobID uuid.UUID, size job.TerminalSize) error {
+	j, err := w.getJob(jobID)
+	if err != nil {
+		return err
+	}
+
+	return j.Resize(size)
+}
+
+func (w *worker) List(ctx context.Context, selector Selector) ([]JobInfo, error) {
+	var jobs []JobInfo
+	var err error
+	w.jobs.Range(func(key, value interface{}) bool {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			return false
+		default:
+			j := value.(job.Job)
+			if status := j.GetStatus(); selector.Matches(status.Labels) {
+				jobs = append(jobs, JobInfo{ID: j.GetID(), Status: status})
+			}
+			return true
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
 }
 
 func (w *worker) Cleanup(ctx context.Context) error {
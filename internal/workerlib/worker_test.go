@@ -2,6 +2,10 @@ package workerlib
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -138,3 +142,778 @@ func TestStreamNotExistingJob(t *testing.T) {
 	assert.Nil(t, outchan)
 	assert.Error(t, err)
 }
+
+func TestListJobs(t *testing.T) {
+	testCtx := context.Background()
+	w := New()
+	jobID, err := w.Start(testCtx, job.Command{Name: "sleep", Arguments: []string{"1"}})
+	assert.NoError(t, err)
+
+	jobs, err := w.List(testCtx, nil)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, jobID, jobs[0].ID)
+	assert.Equal(t, "sleep", jobs[0].Status.CommandName)
+}
+
+func TestListJobsBySelector(t *testing.T) {
+	testCtx := context.Background()
+	w := New()
+	buildID, err := w.Start(testCtx, job.Command{Name: "sleep", Arguments: []string{"1"}, Labels: map[string]string{"pipeline": "build", "team": "core"}})
+	assert.NoError(t, err)
+	testID, err := w.Start(testCtx, job.Command{Name: "sleep", Arguments: []string{"1"}, Labels: map[string]string{"pipeline": "test"}})
+	assert.NoError(t, err)
+
+	selector, err := ParseSelector("pipeline=build")
+	assert.NoError(t, err)
+	jobs, err := w.List(testCtx, selector)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, buildID, jobs[0].ID)
+	assert.Equal(t, map[string]string{"pipeline": "build", "team": "core"}, jobs[0].Status.Labels)
+
+	selector, err = ParseSelector("pipeline in (build, test), !team")
+	assert.NoError(t, err)
+	jobs, err = w.List(testCtx, selector)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, testID, jobs[0].ID)
+}
+
+func TestInteractiveJobInput(t *testing.T) {
+	testCtx := context.Background()
+	w := New()
+	jobID, err := w.Start(testCtx, job.Command{Name: "cat", Interactive: true})
+	assert.NoError(t, err)
+
+	input, err := w.GetInput(testCtx, jobID)
+	assert.NoError(t, err)
+
+	outchan, err := w.GetStream(testCtx, jobID)
+	assert.NoError(t, err)
+
+	_, err = input.Write([]byte("hello\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, input.Close())
+
+	select {
+	case out := <-outchan:
+		assert.Equal(t, "hello\n", string(out))
+	case <-time.After(time.Second):
+		t.Fatal("expected output, but got timeout")
+	}
+}
+
+func TestNotInteractiveJobInput(t *testing.T) {
+	testCtx := context.Background()
+	w := New()
+	jobID, err := w.Start(testCtx, job.Command{Name: "sleep", Arguments: []string{"1"}})
+	assert.NoError(t, err)
+
+	_, err = w.GetInput(testCtx, jobID)
+	assert.ErrorIs(t, err, job.ErrNoInput)
+}
+
+func TestTTYJob(t *testing.T) {
+	testCtx := context.Background()
+	w := New()
+	jobID, err := w.Start(testCtx, job.Command{
+		Name:         "sh",
+		Arguments:    []string{"-c", "tty && stty size"},
+		TTY:          true,
+		TerminalSize: job.TerminalSize{Rows: 30, Cols: 100},
+	})
+	assert.NoError(t, err)
+
+	time.Sleep(time.Second)
+
+	outchan, err := w.GetStream(testCtx, jobID)
+	assert.NoError(t, err)
+
+	select {
+	case out := <-outchan:
+		assert.Contains(t, string(out), "/dev/pts/")
+		assert.Contains(t, string(out), "30 100")
+	case <-time.After(time.Second):
+		t.Fatal("expected output, but got timeout")
+	}
+
+	status, err := w.QueryStatus(testCtx, jobID)
+	assert.NoError(t, err)
+	assert.True(t, status.StatusCode == job.EXITED)
+}
+
+func TestResizeNotTTYJob(t *testing.T) {
+	testCtx := context.Background()
+	w := New()
+	jobID, err := w.Start(testCtx, job.Command{Name: "sleep", Arguments: []string{"1"}})
+	assert.NoError(t, err)
+
+	err = w.Resize(testCtx, jobID, job.TerminalSize{Rows: 10, Cols: 10})
+	assert.ErrorIs(t, err, job.ErrNoTTY)
+}
+
+func TestJobMetrics(t *testing.T) {
+	testCtx := context.Background()
+	w := New()
+
+	started := jobsStarted.Value("true")
+	exited := jobsExited.Value("true")
+	errored := jobsErrored.Value(otherCommand)
+
+	_, err := w.Start(testCtx, job.Command{Name: "true"})
+	assert.NoError(t, err)
+	_, err = w.Start(testCtx, job.Command{Name: "blablabla17"})
+	assert.Error(t, err)
+
+	time.Sleep(time.Second)
+
+	assert.Equal(t, started+1, jobsStarted.Value("true"))
+	assert.Equal(t, exited+1, jobsExited.Value("true"))
+	assert.Equal(t, errored+1, jobsErrored.Value(otherCommand))
+	assert.Zero(t, jobsErrored.Value("blablabla17"))
+}
+
+func TestCommandLabel(t *testing.T) {
+	commandLabels.Lock()
+	seen := commandLabels.seen
+	commandLabels.seen = map[string]struct{}{}
+	commandLabels.Unlock()
+	defer func() {
+		commandLabels.Lock()
+		commandLabels.seen = seen
+		commandLabels.Unlock()
+	}()
+
+	assert.Equal(t, "true", commandLabel("/usr/bin/true"))
+	for i := 1; i < maxCommandLabels; i++ {
+		assert.Equal(t, fmt.Sprintf("cmd%d", i), commandLabel(fmt.Sprintf("./cmd%d", i)))
+	}
+	assert.Equal(t, otherCommand, commandLabel("one-too-many"))
+	assert.Equal(t, "true", commandLabel("true"))
+}
+
+func TestMaxRunningJobs(t *testing.T) {
+	testCtx := context.Background()
+	w := New(WithMaxRunningJobs(1))
+
+	jobID, err := w.Start(testCtx, job.Command{Name: "sleep", Arguments: []string{"5"}})
+	assert.NoError(t, err)
+	assert.True(t, w.Saturated())
+
+	_, err = w.Start(testCtx, job.Command{Name: "sleep", Arguments: []string{"5"}})
+	assert.ErrorIs(t, err, ErrWorkerSaturated)
+
+	err = w.Stop(testCtx, jobID)
+	assert.NoError(t, err)
+
+	time.Sleep(time.Second)
+
+	assert.False(t, w.Saturated())
+	_, err = w.Start(testCtx, job.Command{Name: "true"})
+	assert.NoError(t, err)
+}
+
+func TestOwnerQuota(t *testing.T) {
+	w := New()
+	ctx := context.Background()
+	alice := WithQuota(Quota{Owner: "alice", MaxRunningJobs: 1})
+	bob := WithQuota(Quota{Owner: "bob", MaxRunningJobs: 1})
+
+	jobID, err := w.Start(ctx, job.Command{Name: "sleep", Arguments: []string{"5"}}, alice)
+	assert.NoError(t, err)
+
+	_, err = w.Start(ctx, job.Command{Name: "sleep", Arguments: []string{"5"}}, alice)
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+
+	bobJobID, err := w.Start(ctx, job.Command{Name: "sleep", Arguments: []string{"5"}}, bob)
+	assert.NoError(t, err)
+
+	err = w.Stop(ctx, jobID)
+	assert.NoError(t, err)
+
+	time.Sleep(time.Second)
+
+	_, err = w.Start(ctx, job.Command{Name: "true"}, alice)
+	assert.NoError(t, err)
+
+	err = w.Stop(ctx, bobJobID)
+	assert.NoError(t, err)
+}
+
+func TestShutdownTerminate(t *testing.T) {
+	testCtx := context.Background()
+	w := New()
+
+	jobID, err := w.Start(testCtx, job.Command{Name: "sleep", Arguments: []string{"5"}})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(testCtx, 3*time.Second)
+	defer cancel()
+	assert.NoError(t, w.Shutdown(ctx, ShutdownTerminate))
+
+	status, err := w.QueryStatus(testCtx, jobID)
+	assert.NoError(t, err)
+	assert.True(t, status.StatusCode == job.STOPPED)
+
+	_, err = w.Start(testCtx, job.Command{Name: "true"})
+	assert.ErrorIs(t, err, ErrShuttingDown)
+}
+
+func TestShutdownDrainTimeout(t *testing.T) {
+	testCtx := context.Background()
+	w := New()
+
+	finishingJobID, err := w.Start(testCtx, job.Command{Name: "sleep", Arguments: []string{"0.2"}})
+	assert.NoError(t, err)
+	// ignores SIGTERM, killed after drain timeout
+	jobID, err := w.Start(testCtx, job.Command{Name: "sh", Arguments: []string{"-c", "trap '' TERM; sleep 5"}})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(testCtx, time.Second)
+	defer cancel()
+	assert.ErrorIs(t, w.Shutdown(ctx, ShutdownDrain), context.DeadlineExceeded)
+
+	status, err := w.QueryStatus(testCtx, finishingJobID)
+	assert.NoError(t, err)
+	assert.True(t, status.StatusCode == job.EXITED)
+
+	time.Sleep(100 * time.Millisecond)
+	status, err = w.QueryStatus(testCtx, jobID)
+	assert.NoError(t, err)
+	assert.True(t, status.StatusCode == job.STOPPED)
+}
+
+func TestShutdownDetach(t *testing.T) {
+	testCtx := context.Background()
+	w := New()
+
+	jobID, err := w.Start(testCtx, job.Command{Name: "sleep", Arguments: []string{"5"}})
+	assert.NoError(t, err)
+
+	assert.NoError(t, w.Shutdown(testCtx, ShutdownDetach))
+
+	status, err := w.QueryStatus(testCtx, jobID)
+	assert.NoError(t, err)
+	assert.True(t, status.StatusCode == job.RUNNING)
+
+	err = w.Stop(testCtx, jobID)
+	assert.NoError(t, err)
+}
+
+func TestParseShutdownMode(t *testing.T) {
+	mode, err := ParseShutdownMode("")
+	assert.NoError(t, err)
+	assert.Equal(t, ShutdownTerminate, mode)
+
+	mode, err = ParseShutdownMode("drain")
+	assert.NoError(t, err)
+	assert.Equal(t, ShutdownDrain, mode)
+
+	_, err = ParseShutdownMode("kill")
+	assert.Error(t, err)
+}
+
+func TestReadoptJobs(t *testing.T) {
+	testCtx := context.Background()
+	stateDir := t.TempDir()
+	w := New(WithStateDir(stateDir))
+
+	jobID, err := w.Start(testCtx, job.Command{Name: "sh", Arguments: []string{"-c", "echo before; sleep 1; echo after"}})
+	assert.NoError(t, err)
+	stoppedJobID, err := w.Start(testCtx, job.Command{Name: "sleep", Arguments: []string{"5"}})
+	assert.NoError(t, err)
+
+	// new worker simulates restarted server
+	restarted := New(WithStateDir(stateDir))
+
+	status, err := restarted.QueryStatus(testCtx, jobID)
+	assert.NoError(t, err)
+	assert.True(t, status.StatusCode == job.RUNNING)
+	assert.Equal(t, "sh", status.CommandName)
+
+	ctx, cancel := context.WithTimeout(testCtx, 3*time.Second)
+	defer cancel()
+	logChan, err := restarted.GetStream(ctx, jobID)
+	assert.NoError(t, err)
+	var output string
+	for data := range logChan {
+		output += string(data)
+		if strings.Contains(output, "after") {
+			break
+		}
+	}
+	assert.Equal(t, "before\nafter\n", output)
+
+	err = restarted.Stop(testCtx, stoppedJobID)
+	assert.NoError(t, err)
+
+	time.Sleep(time.Second)
+
+	status, err = restarted.QueryStatus(testCtx, jobID)
+	assert.NoError(t, err)
+	assert.True(t, status.StatusCode == job.EXITED)
+	status, err = restarted.QueryStatus(testCtx, stoppedJobID)
+	assert.NoError(t, err)
+	assert.True(t, status.StatusCode == job.STOPPED)
+	assert.False(t, restarted.Saturated())
+}
+
+func TestReadoptFinishedJob(t *testing.T) {
+	testCtx := context.Background()
+	stateDir := t.TempDir()
+
+	jobID := uuid.New()
+	state := fmt.Sprintf(`{"id": %q, "pid": %d, "processStartTime": 1, "logFile": %q, "command": {"Name": "sleep"}}`,
+		jobID, os.Getpid(), filepath.Join(stateDir, jobID.String()+".log"))
+	assert.NoError(t, os.WriteFile(filepath.Join(stateDir, jobID.String()+".json"), []byte(state), 0600))
+
+	w := New(WithStateDir(stateDir))
+
+	// PID belongs to another process now, job is known but finished
+	status, err := w.QueryStatus(testCtx, jobID)
+	assert.NoError(t, err)
+	assert.True(t, status.StatusCode == job.EXITED)
+	assert.Equal(t, -1, status.ExitCode)
+	assert.NoError(t, w.Stop(testCtx, jobID))
+
+	assert.NoError(t, w.Cleanup(testCtx))
+	files, err := os.ReadDir(stateDir)
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestReadoptSkipsInvalidState(t *testing.T) {
+	testCtx := context.Background()
+	stateDir := t.TempDir()
+
+	jobID := uuid.New()
+	state := fmt.Sprintf(`{"id": %q, "pid": %d, "processStartTime": 1, "logFile": %q, "command": {"Name": "sleep"}}`,
+		jobID, os.Getpid(), filepath.Join(stateDir, jobID.String()+".log"))
+	assert.NoError(t, os.WriteFile(filepath.Join(stateDir, jobID.String()+".json"), []byte(state), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(stateDir, uuid.NewString()+".json"), []byte(`{"id": `), 0600))
+	assert.NoError(t, os.Mkdir(filepath.Join(stateDir, uuid.NewString()+".json"), 0700))
+
+	w := New(WithStateDir(stateDir))
+
+	status, err := w.QueryStatus(testCtx, jobID)
+	assert.NoError(t, err)
+	assert.Equal(t, "sleep", status.CommandName)
+}
+
+func TestDeleteJob(t *testing.T) {
+	testCtx := context.Background()
+	w := New()
+	jobID, err := w.Start(testCtx, job.Command{Name: "sleep", Arguments: []string{"10"}})
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, w.Delete(testCtx, jobID), ErrJobRunning)
+
+	assert.NoError(t, w.Stop(testCtx, jobID))
+	assert.Eventually(t, func() bool {
+		return w.Delete(testCtx, jobID) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	_, err = w.QueryStatus(testCtx, jobID)
+	assert.ErrorIs(t, err, ErrJobNotFound)
+	assert.ErrorIs(t, w.Delete(testCtx, jobID), ErrJobNotFound)
+}
+
+func TestIdempotentStart(t *testing.T) {
+	w := New()
+	ctx := context.Background()
+	key := WithIdempotencyKey("client/key-1")
+	command := job.Command{Name: "sleep", Arguments: []string{"1"}, Labels: map[string]string{"pipeline": "build"}}
+
+	jobID, err := w.Start(ctx, command, key)
+	assert.NoError(t, err)
+
+	repeatedID, err := w.Start(ctx, job.Command{Name: "sleep", Arguments: []string{"1"}, Labels: map[string]string{"pipeline": "build"}}, key)
+	assert.NoError(t, err)
+	assert.Equal(t, jobID, repeatedID)
+
+	_, err = w.Start(ctx, job.Command{Name: "sleep", Arguments: []string{"2"}}, key)
+	assert.ErrorIs(t, err, ErrIdempotencyKeyReused)
+
+	otherID, err := w.Start(ctx, command, WithIdempotencyKey("client/key-2"))
+	assert.NoError(t, err)
+	assert.NotEqual(t, jobID, otherID)
+
+	jobs, err := w.List(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 2)
+}
+
+func TestIdempotencyWindow(t *testing.T) {
+	c := newIdempotencyCache(time.Minute)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	starts := 0
+	startFn := func() (uuid.UUID, error) {
+		starts++
+		return uuid.New(), nil
+	}
+	command := job.Command{Name: "ls"}
+
+	first, err := c.start(context.Background(), "key", command, startFn)
+	assert.NoError(t, err)
+	second, err := c.start(context.Background(), "key", command, startFn)
+	assert.NoError(t, err)
+	assert.Equal(t, first, second)
+	assert.Equal(t, 1, starts)
+
+	now = now.Add(2 * time.Minute)
+	third, err := c.start(context.Background(), "key", command, startFn)
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, third)
+	assert.Equal(t, 2, starts)
+
+	// failed start is not remembered
+	_, err = c.start(context.Background(), "failing", command, func() (uuid.UUID, error) { return uuid.Nil, ErrWorkerSaturated })
+	assert.ErrorIs(t, err, ErrWorkerSaturated)
+	_, err = c.start(context.Background(), "failing", command, startFn)
+	assert.NoError(t, err)
+}
+
+func TestRetryFailedJob(t *testing.T) {
+	testCtx := context.Background()
+	w := New()
+	jobID, err := w.Start(testCtx, job.Command{
+		Name:      "sh",
+		Arguments: []string{"-c", "echo run; exit 3"},
+		Retry:     &job.RetryPolicy{MaxAttempts: 3, ExitCodes: []int{3}, InitialBackoff: 10 * time.Millisecond},
+	})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(testCtx, 5*time.Second)
+	defer cancel()
+	logChan, err := w.GetStream(ctx, jobID)
+	assert.NoError(t, err)
+	var output string
+	for data := range logChan {
+		output += string(data)
+		if strings.Count(output, "run") == 3 {
+			break
+		}
+	}
+	assert.Equal(t, "run\n--- attempt 2 of 3 ---\nrun\n--- attempt 3 of 3 ---\nrun\n", output)
+
+	assert.Eventually(t, func() bool {
+		status, err := w.QueryStatus(testCtx, jobID)
+		return err == nil && !status.FinishedAt.IsZero()
+	}, 5*time.Second, 10*time.Millisecond)
+	status, err := w.QueryStatus(testCtx, jobID)
+	assert.NoError(t, err)
+	assert.True(t, status.StatusCode == job.EXITED)
+	assert.Equal(t, 3, status.ExitCode)
+	assert.Len(t, status.Attempts, 3)
+	for i, a := range status.Attempts {
+		assert.Equal(t, i+1, a.Number)
+		assert.Equal(t, 3, a.ExitCode)
+		assert.False(t, a.FinishedAt.IsZero())
+	}
+	assert.Equal(t, "--- attempt 2 of 3 ---\nrun\n", output[status.Attempts[1].OutputOffset:status.Attempts[2].OutputOffset])
+}
+
+func TestRetryNotRetryableExitCode(t *testing.T) {
+	testCtx := context.Background()
+	w := New()
+	jobID, err := w.Start(testCtx, job.Command{
+		Name:      "sh",
+		Arguments: []string{"-c", "exit 4"},
+		Retry:     &job.RetryPolicy{MaxAttempts: 3, ExitCodes: []int{3}, InitialBackoff: 10 * time.Millisecond},
+	})
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		status, err := w.QueryStatus(testCtx, jobID)
+		return err == nil && status.StatusCode == job.EXITED
+	}, 5*time.Second, 10*time.Millisecond)
+
+	status, err := w.QueryStatus(testCtx, jobID)
+	assert.NoError(t, err)
+	assert.Len(t, status.Attempts, 1)
+	assert.Equal(t, 4, status.ExitCode)
+}
+
+func TestStopJobWaitingForRetry(t *testing.T) {
+	testCtx := context.Background()
+	w := New()
+	jobID, err := w.Start(testCtx, job.Command{
+		Name:  "false",
+		Retry: &job.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Minute},
+	})
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		status, err := w.QueryStatus(testCtx, jobID)
+		return err == nil && !status.Attempts[0].FinishedAt.IsZero()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, w.Stop(testCtx, jobID))
+	assert.Eventually(t, func() bool {
+		status, err := w.QueryStatus(testCtx, jobID)
+		return err == nil && !status.FinishedAt.IsZero()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	status, err := w.QueryStatus(testCtx, jobID)
+	assert.NoError(t, err)
+	assert.True(t, status.StatusCode == job.STOPPED)
+	assert.Len(t, status.Attempts, 1)
+	assert.False(t, w.Saturated())
+}
+
+func TestRetryInteractiveJob(t *testing.T) {
+	w := New()
+	_, err := w.Start(context.Background(), job.Command{Name: "cat", Interactive: true, Retry: &job.RetryPolicy{MaxAttempts: 2}})
+	assert.ErrorIs(t, err, job.ErrRetryInteractive)
+}
+
+func TestRetryJobWithStateDir(t *testing.T) {
+	testCtx := context.Background()
+	w := New(WithStateDir(t.TempDir()))
+	jobID, err := w.Start(testCtx, job.Command{
+		Name:      "sh",
+		Arguments: []string{"-c", "echo run; exit 1"},
+		Retry:     &job.RetryPolicy{MaxAttempts: 2, InitialBackoff: 10 * time.Millisecond},
+	})
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		status, err := w.QueryStatus(testCtx, jobID)
+		return err == nil && status.StatusCode == job.EXITED
+	}, 5*time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(testCtx, 3*time.Second)
+	defer cancel()
+	logChan, err := w.GetStream(ctx, jobID)
+	assert.NoError(t, err)
+	var output string
+	for data := range logChan {
+		output += string(data)
+		if strings.Count(output, "run") == 2 {
+			break
+		}
+	}
+	assert.Equal(t, "run\n--- attempt 2 of 2 ---\nrun\n", output)
+
+	status, err := w.QueryStatus(testCtx, jobID)
+	assert.NoError(t, err)
+	assert.Len(t, status.Attempts, 2)
+}
+
+func TestRestartAlways(t *testing.T) {
+	testCtx := context.Background()
+	w := New()
+	jobID, err := w.Start(testCtx, job.Command{
+		Name:      "echo",
+		Arguments: []string{"up"},
+		Restart:   &job.RestartPolicy{Mode: job.RestartAlways, Delay: 10 * time.Millisecond, CrashLoopFailures: 100},
+	})
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		status, err := w.QueryStatus(testCtx, jobID)
+		return err == nil && status.Restarts >= 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, w.Stop(testCtx, jobID))
+	assert.Eventually(t, func() bool {
+		status, err := w.QueryStatus(testCtx, jobID)
+		return err == nil && !status.FinishedAt.IsZero()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	status, err := w.QueryStatus(testCtx, jobID)
+	assert.NoError(t, err)
+	assert.True(t, status.StatusCode == job.STOPPED)
+	restarts := status.Restarts
+
+	time.Sleep(100 * time.Millisecond)
+	status, err = w.QueryStatus(testCtx, jobID)
+	assert.NoError(t, err)
+	assert.Equal(t, restarts, status.Restarts)
+	assert.False(t, w.Saturated())
+}
+
+func TestRestartOnFailureSucceededJob(t *testing.T) {
+	testCtx := context.Background()
+	w := New()
+	jobID, err := w.Start(testCtx, job.Command{
+		Name:    "true",
+		Restart: &job.RestartPolicy{Mode: job.RestartOnFailure, Delay: 10 * time.Millisecond},
+	})
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		status, err := w.QueryStatus(testCtx, jobID)
+		return err == nil && status.StatusCode == job.EXITED
+	}, 5*time.Second, 10*time.Millisecond)
+
+	status, err := w.QueryStatus(testCtx, jobID)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, status.Restarts)
+}
+
+func TestRestartCrashLoop(t *testing.T) {
+	testCtx := context.Background()
+	w := New()
+	jobID, err := w.Start(testCtx, job.Command{
+		Name: "false",
+		Restart: &job.RestartPolicy{
+			Mode:              job.RestartOnFailure,
+			Delay:             10 * time.Millisecond,
+			CrashLoopFailures: 3,
+			CrashLoopWindow:   time.Minute,
+		},
+	})
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		status, err := w.QueryStatus(testCtx, jobID)
+		return err == nil && status.StatusCode == job.CRASHLOOP
+	}, 5*time.Second, 5*time.Millisecond)
+
+	status, err := w.QueryStatus(testCtx, jobID)
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, status.Restarts, 2)
+
+	assert.NoError(t, w.Stop(testCtx, jobID))
+	assert.Eventually(t, func() bool {
+		status, err := w.QueryStatus(testCtx, jobID)
+		return err == nil && status.StatusCode == job.STOPPED && !status.FinishedAt.IsZero()
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestRetryAndRestartPolicies(t *testing.T) {
+	w := New()
+	_, err := w.Start(context.Background(), job.Command{
+		Name:    "true",
+		Retry:   &job.RetryPolicy{MaxAttempts: 2},
+		Restart: &job.RestartPolicy{Mode: job.RestartAlways},
+	})
+	assert.ErrorIs(t, err, job.ErrRetryAndRestart)
+}
+
+func TestJobTimeout(t *testing.T) {
+	testCtx := context.Background()
+	w := New()
+	jobID, err := w.Start(testCtx, job.Command{
+		Name:      "sleep",
+		Arguments: []string{"10"},
+		Limits:    &job.Limits{Timeout: 100 * time.Millisecond},
+	})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(testCtx, 5*time.Second)
+	defer cancel()
+	status, err := w.Wait(ctx, jobID)
+	assert.NoError(t, err)
+	assert.True(t, status.StatusCode == job.STOPPED)
+	assert.Equal(t, job.ErrTimeout.Error(), status.Error)
+	assert.Less(t, status.FinishedAt.Sub(status.StartedAt), 5*time.Second)
+}
+
+func TestJobEnvAndLimits(t *testing.T) {
+	testCtx := context.Background()
+	w := New()
+	jobID, err := w.Start(testCtx, job.Command{
+		Name: "sh",
+		// limits are set before command is executed
+		Arguments: []string{"-c", "echo $0 $TARGET; ulimit -t; ulimit -v"},
+		Env:       []string{"TARGET=orders"},
+		Limits:    &job.Limits{MaxCPUSeconds: 30, MaxMemoryBytes: 1 << 30},
+	})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(testCtx, 5*time.Second)
+	defer cancel()
+	status, err := w.Wait(ctx, jobID)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, status.ExitCode)
+
+	output, err := w.GetStreamFrom(ctx, jobID, 0)
+	assert.NoError(t, err)
+	var received string
+	for chunk := range output {
+		if received += string(chunk); strings.Count(received, "\n") == 3 {
+			break
+		}
+	}
+	assert.Equal(t, "sh orders\n30\n1048576\n", received)
+}
+
+// pauseTestWorkers returns worker pausing jobs with signals and, when server can create cgroups, worker using cgroup freezer
+func pauseTestWorkers(t *testing.T) map[string]Worker {
+	workers := map[string]Worker{"signals": New()}
+	for _, root := range []string{"/sys/fs/cgroup", "/sys/fs/cgroup/unified"} {
+		if !job.IsCgroup2(root) {
+			continue
+		}
+		dir := filepath.Join(root, "jobworker-test-"+uuid.NewString())
+		if err := os.Mkdir(dir, 0755); err != nil {
+			continue
+		}
+		t.Cleanup(func() { os.Remove(dir) })
+		workers["cgroup"] = New(WithCgroupDir(dir))
+		break
+	}
+	return workers
+}
+
+func TestPauseResume(t *testing.T) {
+	for name, w := range pauseTestWorkers(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			// file is created by grandchild of the job, so the whole tree has to be frozen
+			file := filepath.Join(t.TempDir(), "done")
+			jobID, err := w.Start(ctx, job.Command{
+				Name:      "sh",
+				Arguments: []string{"-c", "(sleep 0.2; touch " + file + ") & wait"},
+				Limits:    &job.Limits{Timeout: 400 * time.Millisecond},
+			})
+			assert.NoError(t, err)
+
+			assert.NoError(t, w.Pause(ctx, jobID))
+			assert.NoError(t, w.Pause(ctx, jobID))
+			status, err := w.QueryStatus(ctx, jobID)
+			assert.NoError(t, err)
+			assert.True(t, status.StatusCode == job.PAUSED)
+
+			// time spent paused doesn't count toward timeout
+			time.Sleep(600 * time.Millisecond)
+			assert.NoFileExists(t, file)
+
+			assert.NoError(t, w.Resume(ctx, jobID))
+			assert.ErrorIs(t, w.Resume(ctx, jobID), job.ErrNotPaused)
+			status, err = w.Wait(ctx, jobID)
+			assert.NoError(t, err)
+			assert.True(t, status.StatusCode == job.EXITED)
+			assert.Equal(t, 0, status.ExitCode)
+			assert.FileExists(t, file)
+
+			assert.ErrorIs(t, w.Pause(ctx, jobID), job.ErrNotRunning)
+			assert.NoError(t, w.Delete(ctx, jobID))
+		})
+	}
+}
+
+func TestStopPausedJob(t *testing.T) {
+	for name, w := range pauseTestWorkers(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			jobID, err := w.Start(ctx, job.Command{Name: "sleep", Arguments: []string{"10"}})
+			assert.NoError(t, err)
+			assert.NoError(t, w.Pause(ctx, jobID))
+
+			// paused job is thawed, so it handles SIGTERM
+			assert.NoError(t, w.Shutdown(ctx, ShutdownTerminate))
+			status, err := w.Wait(ctx, jobID)
+			assert.NoError(t, err)
+			assert.True(t, status.StatusCode == job.STOPPED)
+			assert.NoError(t, w.Delete(ctx, jobID))
+		})
+	}
+}
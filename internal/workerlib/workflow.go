@@ -0,0 +1,528 @@
+package workerlib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/supby/job-worker/internal/workerlib/job"
+)
+
+const (
+	// WorkflowLabel is label of jobs started by workflow, its value is workflow ID
+	WorkflowLabel = "workflow"
+	// WorkflowNodeLabel is label of jobs started by workflow, its value is node name
+	WorkflowNodeLabel = "workflow-node"
+)
+
+// ErrWorkflowNotFound is returned when a workflow with the given ID is not found
+var ErrWorkflowNotFound = errors.New("workflow not found")
+
+// defaultWorkflowHistoryLimit is number of finished workflows which are kept, older ones are forgotten
+const defaultWorkflowHistoryLimit = 100
+
+// quotaRetryInterval is how often nodes held back by quota are retried
+const quotaRetryInterval = time.Second
+
+// NodeCondition tells when node runs depending on result of its dependencies
+type NodeCondition string
+
+const (
+	// ConditionOnSuccess runs node when all dependencies succeeded
+	ConditionOnSuccess NodeCondition = "on-success"
+	// ConditionOnFailure runs node when any dependency failed
+	ConditionOnFailure NodeCondition = "on-failure"
+	// ConditionAlways runs node when all dependencies finished, whatever the result
+	ConditionAlways NodeCondition = "always"
+)
+
+// ParseNodeCondition parses condition name, empty name is on-success
+func ParseNodeCondition(condition string) (NodeCondition, error) {
+	switch NodeCondition(condition) {
+	case "", ConditionOnSuccess:
+		return ConditionOnSuccess, nil
+	case ConditionOnFailure, ConditionAlways:
+		return NodeCondition(condition), nil
+	}
+	return "", fmt.Errorf("invalid node condition %q", condition)
+}
+
+// WorkflowState is state of workflow rolled up from states of its nodes
+type WorkflowState string
+
+const (
+	WorkflowRunning   WorkflowState = "running"
+	WorkflowSucceeded WorkflowState = "succeeded"
+	// WorkflowFailed workflow has at least one failed node
+	WorkflowFailed    WorkflowState = "failed"
+	WorkflowCancelled WorkflowState = "cancelled"
+)
+
+// NodeState is state of one node of workflow
+type NodeState string
+
+const (
+	NodePending   NodeState = "pending"
+	NodeRunning   NodeState = "running"
+	NodeSucceeded NodeState = "succeeded"
+	NodeFailed    NodeState = "failed"
+	// NodeSkipped node did not run because its condition was not met
+	NodeSkipped   NodeState = "skipped"
+	NodeCancelled NodeState = "cancelled"
+)
+
+func (s NodeState) finished() bool {
+	return s != NodePending && s != NodeRunning
+}
+
+// WorkflowNode is one job of workflow
+type WorkflowNode struct {
+	// Name is unique within workflow
+	Name    string
+	Command job.Command
+	// DependsOn are names of nodes which have to finish before this node starts
+	DependsOn []string
+	Condition NodeCondition
+}
+
+// WorkflowSpec is a DAG of jobs
+type WorkflowSpec struct {
+	Nodes []WorkflowNode
+	// Owner and Roles identify client which submitted workflow, they are passed to StartCheck
+	Owner string
+	Roles []string
+	// Quota of owner is enforced for every node, nodes over quota stay pending
+	// until owner's running jobs finish. Nil means no quota.
+	Quota *Quota
+}
+
+// NodeStatus is a snapshot of node's state
+type NodeStatus struct {
+	Name  string
+	State NodeState
+	// JobID is set once node's job is started
+	JobID uuid.UUID
+	Error string
+}
+
+// Workflow is a snapshot of workflow's state, nodes are in order in which they can run
+type Workflow struct {
+	ID         uuid.UUID
+	State      WorkflowState
+	Nodes      []NodeStatus
+	CreatedAt  time.Time
+	FinishedAt time.Time
+}
+
+// WorkflowEngine runs DAGs of jobs. Every node is started as a normal job
+// labelled with workflow ID and node name once its dependencies finished.
+type WorkflowEngine interface {
+	SubmitWorkflow(ctx context.Context, spec WorkflowSpec) (Workflow, error)
+	GetWorkflow(ctx context.Context, id uuid.UUID) (Workflow, error)
+	ListWorkflows(ctx context.Context) ([]Workflow, error)
+	// CancelWorkflow stops running nodes of workflow, pending nodes are not started
+	CancelWorkflow(ctx context.Context, id uuid.UUID) error
+	// Close stops tracking of workflows, their running jobs are kept
+	Close()
+}
+
+type workflow struct {
+	info      Workflow
+	spec      WorkflowSpec
+	cancelled bool
+}
+
+type workflowEngine struct {
+	worker       Worker
+	check        StartCheck
+	historyLimit int
+	mtx          sync.Mutex
+	workflows    map[uuid.UUID]*workflow
+	closed       bool
+	ctx          context.Context
+	cancel       context.CancelFunc
+	wg           sync.WaitGroup
+}
+
+// NewWorkflowEngine creates engine running workflows on worker, workflows are kept
+// in memory, finished ones up to a history limit. Every node is authorized by check
+// when it starts, unless it is nil.
+func NewWorkflowEngine(worker Worker, check StartCheck) WorkflowEngine {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &workflowEngine{
+		worker:       worker,
+		check:        check,
+		historyLimit: defaultWorkflowHistoryLimit,
+		workflows:    map[uuid.UUID]*workflow{},
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+}
+
+func (e *workflowEngine) SubmitWorkflow(ctx context.Context, spec WorkflowSpec) (Workflow, error) {
+	nodes, err := sortNodes(spec.Nodes)
+	if err != nil {
+		return Workflow{}, err
+	}
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return Workflow{}, err
+	}
+
+	wf := &workflow{
+		info: Workflow{ID: id, State: WorkflowRunning, CreatedAt: time.Now()},
+		spec: WorkflowSpec{Nodes: nodes, Owner: spec.Owner, Roles: spec.Roles, Quota: spec.Quota},
+	}
+	for _, node := range nodes {
+		wf.info.Nodes = append(wf.info.Nodes, NodeStatus{Name: node.Name, State: NodePending})
+	}
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	if e.closed {
+		return Workflow{}, ErrShuttingDown
+	}
+	e.workflows[id] = wf
+
+	e.wg.Add(1)
+	go e.run(wf)
+
+	log.Printf("[workflow] workflow submitted: %v, nodes: %v", id, len(nodes))
+	return wf.snapshot(), nil
+}
+
+// sortNodes validates nodes and sorts them topologically, keeping submitted order where possible
+func sortNodes(nodes []WorkflowNode) ([]WorkflowNode, error) {
+	if len(nodes) == 0 {
+		return nil, errors.New("workflow has no nodes")
+	}
+	nodes = append([]WorkflowNode(nil), nodes...)
+
+	index := map[string]int{}
+	for i, node := range nodes {
+		if node.Name == "" || strings.ContainsAny(node.Name, "(),") || node.Name != strings.TrimSpace(node.Name) {
+			return nil, fmt.Errorf("invalid node name %q", node.Name)
+		}
+		if _, ok := index[node.Name]; ok {
+			return nil, fmt.Errorf("duplicate node %q", node.Name)
+		}
+		index[node.Name] = i
+	}
+
+	sorted := make([]WorkflowNode, 0, len(nodes))
+	remaining := make([]int, len(nodes))
+	dependents := make([][]int, len(nodes))
+	for i, node := range nodes {
+		if node.Command.Interactive || node.Command.TTY {
+			return nil, fmt.Errorf("node %q can't be interactive", node.Name)
+		}
+		if node.Command.Restart != nil {
+			return nil, fmt.Errorf("node %q can't have restart policy", node.Name)
+		}
+		if err := ValidateLabels(node.Command.Labels); err != nil {
+			return nil, fmt.Errorf("node %q: %w", node.Name, err)
+		}
+		condition, err := ParseNodeCondition(string(node.Condition))
+		if err != nil {
+			return nil, fmt.Errorf("node %q: %w", node.Name, err)
+		}
+		nodes[i].Condition = condition
+
+		for _, dep := range node.DependsOn {
+			d, ok := index[dep]
+			if !ok {
+				return nil, fmt.Errorf("node %q depends on unknown node %q", node.Name, dep)
+			}
+			remaining[i]++
+			dependents[d] = append(dependents[d], i)
+		}
+	}
+
+	var ready []int
+	for i := range nodes {
+		if remaining[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+	for len(ready) > 0 {
+		sort.Ints(ready)
+		i := ready[0]
+		ready = ready[1:]
+		sorted = append(sorted, nodes[i])
+		for _, d := range dependents[i] {
+			if remaining[d]--; remaining[d] == 0 {
+				ready = append(ready, d)
+			}
+		}
+	}
+	if len(sorted) != len(nodes) {
+		return nil, errors.New("workflow has a dependency cycle")
+	}
+	return sorted, nil
+}
+
+// run starts nodes of workflow as their dependencies finish
+func (e *workflowEngine) run(wf *workflow) {
+	defer e.wg.Done()
+
+	finished := make(chan struct{}, len(wf.spec.Nodes))
+	running := 0
+	for {
+		started, held := e.startReady(wf, finished)
+		running += started
+		if running == 0 && !held {
+			break
+		}
+		// quota can be freed by jobs outside of workflow too
+		var retry <-chan time.Time
+		if held {
+			retry = time.After(quotaRetryInterval)
+		}
+		select {
+		case <-e.ctx.Done():
+			return
+		case <-finished:
+			running--
+		case <-retry:
+		}
+	}
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	wf.info.State = wf.rollup()
+	wf.info.FinishedAt = time.Now()
+	log.Printf("[workflow] workflow finished: %v, state: %v", wf.info.ID, wf.info.State)
+	e.cleanupHistory()
+}
+
+// cleanupHistory forgets the oldest finished workflows over history limit, e.mtx has to be locked.
+// Jobs of forgotten workflows are kept.
+func (e *workflowEngine) cleanupHistory() {
+	var finished []*workflow
+	for _, wf := range e.workflows {
+		if !wf.info.FinishedAt.IsZero() {
+			finished = append(finished, wf)
+		}
+	}
+	if len(finished) <= e.historyLimit {
+		return
+	}
+
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].info.FinishedAt.Before(finished[j].info.FinishedAt)
+	})
+	for _, wf := range finished[:len(finished)-e.historyLimit] {
+		delete(e.workflows, wf.info.ID)
+	}
+}
+
+// startReady starts pending nodes whose dependencies finished, it returns number
+// of started nodes and whether some ready nodes were held back by quota
+func (e *workflowEngine) startReady(wf *workflow, finished chan<- struct{}) (started int, held bool) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	for i, node := range wf.spec.Nodes {
+		status := &wf.info.Nodes[i]
+		if status.State != NodePending {
+			continue
+		}
+		if wf.cancelled {
+			status.State = NodeCancelled
+			continue
+		}
+		run, ok := wf.evaluate(node)
+		if !ok {
+			continue
+		}
+		if !run {
+			status.State = NodeSkipped
+			continue
+		}
+
+		command := node.Command
+		command.Labels = map[string]string{}
+		for k, v := range node.Command.Labels {
+			command.Labels[k] = v
+		}
+		command.Labels[WorkflowLabel] = wf.info.ID.String()
+		command.Labels[WorkflowNodeLabel] = node.Name
+
+		// policy may have changed since workflow was submitted
+		var jobID uuid.UUID
+		var err error
+		if e.check != nil {
+			err = e.check(command, wf.spec.Owner, wf.spec.Roles)
+		}
+		if err == nil {
+			var opts []StartOption
+			if wf.spec.Quota != nil {
+				opts = append(opts, WithQuota(*wf.spec.Quota))
+			}
+			jobID, err = e.worker.Start(e.ctx, command, opts...)
+		}
+		if errors.Is(err, ErrQuotaExceeded) {
+			held = true
+			continue
+		}
+		if err != nil {
+			log.Printf("[workflow] failed to start node %q of workflow %v: %v", node.Name, wf.info.ID, err)
+			status.State = NodeFailed
+			status.Error = err.Error()
+			continue
+		}
+		status.State = NodeRunning
+		status.JobID = jobID
+		started++
+
+		go e.wait(wf, i, jobID, finished)
+	}
+	return started, held
+}
+
+// wait records result of node's job and notifies run loop
+func (e *workflowEngine) wait(wf *workflow, i int, jobID uuid.UUID, finished chan<- struct{}) {
+	jobStatus, err := e.worker.Wait(e.ctx, jobID)
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	e.mtx.Lock()
+	status := &wf.info.Nodes[i]
+	switch {
+	case err != nil:
+		status.State = NodeFailed
+		status.Error = err.Error()
+	case jobStatus.StatusCode == job.STOPPED && wf.cancelled:
+		status.State = NodeCancelled
+	case jobStatus.StatusCode == job.EXITED && jobStatus.ExitCode == 0:
+		status.State = NodeSucceeded
+	default:
+		status.State = NodeFailed
+		status.Error = jobStatus.Error
+	}
+	e.mtx.Unlock()
+
+	finished <- struct{}{}
+}
+
+// evaluate reports whether node is ready and whether its condition is met, e.mtx has to be locked
+func (wf *workflow) evaluate(node WorkflowNode) (run bool, ready bool) {
+	succeeded, failed := true, false
+	for _, dep := range node.DependsOn {
+		state := wf.nodeState(dep)
+		if !state.finished() {
+			return false, false
+		}
+		succeeded = succeeded && state == NodeSucceeded
+		failed = failed || state == NodeFailed
+	}
+
+	switch node.Condition {
+	case ConditionOnFailure:
+		return failed, true
+	case ConditionAlways:
+		return true, true
+	}
+	return succeeded, true
+}
+
+func (wf *workflow) nodeState(name string) NodeState {
+	for _, status := range wf.info.Nodes {
+		if status.Name == name {
+			return status.State
+		}
+	}
+	return NodePending
+}
+
+// rollup returns state of workflow from states of its nodes, e.mtx has to be locked
+func (wf *workflow) rollup() WorkflowState {
+	state := WorkflowSucceeded
+	for _, status := range wf.info.Nodes {
+		switch status.State {
+		case NodePending, NodeRunning:
+			return WorkflowRunning
+		case NodeFailed:
+			state = WorkflowFailed
+		}
+	}
+	if wf.cancelled {
+		return WorkflowCancelled
+	}
+	return state
+}
+
+func (wf *workflow) snapshot() Workflow {
+	info := wf.info
+	info.Nodes = append([]NodeStatus(nil), wf.info.Nodes...)
+	return info
+}
+
+func (e *workflowEngine) GetWorkflow(ctx context.Context, id uuid.UUID) (Workflow, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	wf, ok := e.workflows[id]
+	if !ok {
+		return Workflow{}, ErrWorkflowNotFound
+	}
+	return wf.snapshot(), nil
+}
+
+func (e *workflowEngine) ListWorkflows(ctx context.Context) ([]Workflow, error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	res := make([]Workflow, 0, len(e.workflows))
+	for _, wf := range e.workflows {
+		res = append(res, wf.snapshot())
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].CreatedAt.Before(res[j].CreatedAt)
+	})
+	return res, nil
+}
+
+func (e *workflowEngine) CancelWorkflow(ctx context.Context, id uuid.UUID) error {
+	e.mtx.Lock()
+	wf, ok := e.workflows[id]
+	if !ok {
+		e.mtx.Unlock()
+		return ErrWorkflowNotFound
+	}
+	var running []uuid.UUID
+	if wf.info.State == WorkflowRunning && !wf.cancelled {
+		wf.cancelled = true
+		for _, status := range wf.info.Nodes {
+			if status.State == NodeRunning {
+				running = append(running, status.JobID)
+			}
+		}
+	}
+	e.mtx.Unlock()
+
+	for _, jobID := range running {
+		if err := e.worker.Stop(ctx, jobID); err != nil && !errors.Is(err, ErrJobNotFound) {
+			return err
+		}
+	}
+
+	log.Printf("[workflow] workflow cancelled: %v, stopped nodes: %v", id, len(running))
+	return nil
+}
+
+func (e *workflowEngine) Close() {
+	e.mtx.Lock()
+	e.closed = true
+	e.mtx.Unlock()
+
+	e.cancel()
+	e.wg.Wait()
+}
@@ -0,0 +1,202 @@
+package workerlib
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/supby/job-worker/internal/workerlib/job"
+)
+
+func waitWorkflow(t *testing.T, e WorkflowEngine, id uuid.UUID) Workflow {
+	var wf Workflow
+	assert.Eventually(t, func() bool {
+		var err error
+		wf, err = e.GetWorkflow(context.Background(), id)
+		return err == nil && wf.State != WorkflowRunning
+	}, 5*time.Second, 20*time.Millisecond)
+	return wf
+}
+
+func nodeStates(wf Workflow) map[string]NodeState {
+	states := map[string]NodeState{}
+	for _, node := range wf.Nodes {
+		states[node.Name] = node.State
+	}
+	return states
+}
+
+func TestWorkflowSucceeded(t *testing.T) {
+	w := New()
+	e := NewWorkflowEngine(w, nil)
+	defer e.Close()
+
+	// submitted in reverse order, nodes are sorted by dependencies
+	submitted, err := e.SubmitWorkflow(context.Background(), WorkflowSpec{Nodes: []WorkflowNode{
+		{Name: "test", Command: job.Command{Name: "true"}, DependsOn: []string{"build"}},
+		{Name: "build", Command: job.Command{Name: "sleep", Arguments: []string{"0.2"}, Labels: map[string]string{"commit": "abc123"}}},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, WorkflowRunning, submitted.State)
+	assert.Equal(t, "build", submitted.Nodes[0].Name)
+
+	wf := waitWorkflow(t, e, submitted.ID)
+	assert.Equal(t, WorkflowSucceeded, wf.State)
+	assert.False(t, wf.FinishedAt.IsZero())
+
+	build, err := w.QueryStatus(context.Background(), wf.Nodes[0].JobID)
+	assert.NoError(t, err)
+	test, err := w.QueryStatus(context.Background(), wf.Nodes[1].JobID)
+	assert.NoError(t, err)
+	assert.False(t, test.StartedAt.Before(build.FinishedAt))
+	assert.Equal(t, submitted.ID.String(), build.Labels[WorkflowLabel])
+	assert.Equal(t, "build", build.Labels[WorkflowNodeLabel])
+	assert.Equal(t, "abc123", build.Labels["commit"])
+}
+
+func TestWorkflowHistoryLimit(t *testing.T) {
+	e := NewWorkflowEngine(New(), nil)
+	defer e.Close()
+	e.(*workflowEngine).historyLimit = 2
+
+	var ids []uuid.UUID
+	for i := 0; i < 3; i++ {
+		submitted, err := e.SubmitWorkflow(context.Background(), WorkflowSpec{Nodes: []WorkflowNode{
+			{Name: "build", Command: job.Command{Name: "true"}},
+		}})
+		assert.NoError(t, err)
+		waitWorkflow(t, e, submitted.ID)
+		ids = append(ids, submitted.ID)
+	}
+
+	_, err := e.GetWorkflow(context.Background(), ids[0])
+	assert.ErrorIs(t, err, ErrWorkflowNotFound)
+	workflows, err := e.ListWorkflows(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, workflows, 2)
+	assert.Equal(t, ids[1], workflows[0].ID)
+}
+
+func TestWorkflowQuota(t *testing.T) {
+	w := New()
+	e := NewWorkflowEngine(w, nil)
+	defer e.Close()
+	quota := &Quota{Owner: "alice", MaxRunningJobs: 1}
+
+	submitted, err := e.SubmitWorkflow(context.Background(), WorkflowSpec{Owner: "alice", Quota: quota, Nodes: []WorkflowNode{
+		{Name: "lint", Command: job.Command{Name: "sleep", Arguments: []string{"0.2"}}},
+		{Name: "build", Command: job.Command{Name: "sleep", Arguments: []string{"0.2"}}},
+		{Name: "docs", Command: job.Command{Name: "sleep", Arguments: []string{"0.2"}}},
+	}})
+	assert.NoError(t, err)
+
+	// nodes over quota wait for running node instead of running at once
+	wf := waitWorkflow(t, e, submitted.ID)
+	assert.Equal(t, WorkflowSucceeded, wf.State)
+	previous := &job.Status{}
+	for _, node := range wf.Nodes {
+		status, err := w.QueryStatus(context.Background(), node.JobID)
+		assert.NoError(t, err)
+		assert.False(t, status.StartedAt.Before(previous.FinishedAt), node.Name)
+		previous = status
+	}
+
+	// quota is held by a job outside of workflow
+	other, err := w.Start(context.Background(), job.Command{Name: "sleep", Arguments: []string{"10"}}, WithQuota(*quota))
+	assert.NoError(t, err)
+	submitted, err = e.SubmitWorkflow(context.Background(), WorkflowSpec{Owner: "alice", Quota: quota, Nodes: []WorkflowNode{
+		{Name: "build", Command: job.Command{Name: "true"}},
+	}})
+	assert.NoError(t, err)
+	time.Sleep(200 * time.Millisecond)
+	wf, err = e.GetWorkflow(context.Background(), submitted.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, NodePending, wf.Nodes[0].State)
+
+	assert.NoError(t, w.Stop(context.Background(), other))
+	wf = waitWorkflow(t, e, submitted.ID)
+	assert.Equal(t, WorkflowSucceeded, wf.State)
+}
+
+func TestWorkflowConditions(t *testing.T) {
+	e := NewWorkflowEngine(New(), nil)
+	defer e.Close()
+
+	submitted, err := e.SubmitWorkflow(context.Background(), WorkflowSpec{Nodes: []WorkflowNode{
+		{Name: "build", Command: job.Command{Name: "sh", Arguments: []string{"-c", "exit 1"}}},
+		{Name: "deploy", Command: job.Command{Name: "true"}, DependsOn: []string{"build"}},
+		{Name: "notify", Command: job.Command{Name: "true"}, DependsOn: []string{"build"}, Condition: ConditionOnFailure},
+		{Name: "verify", Command: job.Command{Name: "true"}, DependsOn: []string{"deploy"}, Condition: ConditionOnFailure},
+		{Name: "cleanup", Command: job.Command{Name: "true"}, DependsOn: []string{"deploy", "notify"}, Condition: ConditionAlways},
+	}})
+	assert.NoError(t, err)
+
+	wf := waitWorkflow(t, e, submitted.ID)
+	assert.Equal(t, WorkflowFailed, wf.State)
+	assert.Equal(t, map[string]NodeState{
+		"build":   NodeFailed,
+		"deploy":  NodeSkipped,
+		"notify":  NodeSucceeded,
+		"verify":  NodeSkipped,
+		"cleanup": NodeSucceeded,
+	}, nodeStates(wf))
+}
+
+func TestCancelWorkflow(t *testing.T) {
+	w := New()
+	e := NewWorkflowEngine(w, nil)
+	defer e.Close()
+
+	submitted, err := e.SubmitWorkflow(context.Background(), WorkflowSpec{Nodes: []WorkflowNode{
+		{Name: "build", Command: job.Command{Name: "sleep", Arguments: []string{"10"}}},
+		{Name: "cleanup", Command: job.Command{Name: "true"}, DependsOn: []string{"build"}, Condition: ConditionAlways},
+	}})
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		wf, _ := e.GetWorkflow(context.Background(), submitted.ID)
+		return wf.Nodes[0].State == NodeRunning
+	}, time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, e.CancelWorkflow(context.Background(), submitted.ID))
+
+	wf := waitWorkflow(t, e, submitted.ID)
+	assert.Equal(t, WorkflowCancelled, wf.State)
+	assert.Equal(t, map[string]NodeState{"build": NodeCancelled, "cleanup": NodeCancelled}, nodeStates(wf))
+
+	status, err := w.QueryStatus(context.Background(), wf.Nodes[0].JobID)
+	assert.NoError(t, err)
+	assert.True(t, status.StatusCode == job.STOPPED)
+
+	assert.ErrorIs(t, e.CancelWorkflow(context.Background(), uuid.New()), ErrWorkflowNotFound)
+}
+
+func TestSubmitInvalidWorkflow(t *testing.T) {
+	e := NewWorkflowEngine(New(), nil)
+	defer e.Close()
+
+	for _, spec := range []WorkflowSpec{
+		{},
+		{Nodes: []WorkflowNode{{Name: "", Command: job.Command{Name: "true"}}}},
+		{Nodes: []WorkflowNode{{Name: "a", Command: job.Command{Name: "true"}}, {Name: "a", Command: job.Command{Name: "true"}}}},
+		{Nodes: []WorkflowNode{{Name: "a", Command: job.Command{Name: "true"}, DependsOn: []string{"b"}}}},
+		{Nodes: []WorkflowNode{{Name: "a", Command: job.Command{Name: "true"}, DependsOn: []string{"a"}}}},
+		{Nodes: []WorkflowNode{
+			{Name: "a", Command: job.Command{Name: "true"}, DependsOn: []string{"c"}},
+			{Name: "b", Command: job.Command{Name: "true"}, DependsOn: []string{"a"}},
+			{Name: "c", Command: job.Command{Name: "true"}, DependsOn: []string{"b"}},
+		}},
+		{Nodes: []WorkflowNode{{Name: "a", Command: job.Command{Name: "true"}, Condition: "sometimes"}}},
+		{Nodes: []WorkflowNode{{Name: "a", Command: job.Command{Name: "bash", Interactive: true}}}},
+		{Nodes: []WorkflowNode{{Name: "a", Command: job.Command{Name: "true", Restart: &job.RestartPolicy{Mode: job.RestartAlways}}}}},
+	} {
+		_, err := e.SubmitWorkflow(context.Background(), spec)
+		assert.Error(t, err)
+	}
+
+	workflows, err := e.ListWorkflows(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, workflows)
+}
@@ -0,0 +1,248 @@
+// Package jobclient is a Go SDK for the job-worker WorkerService API.
+package jobclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	workerservicepb "github.com/supby/job-worker/generated/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrJobNotFound is returned when server doesn't know the requested job
+var ErrJobNotFound = errors.New("job not found")
+
+// Client is a connection to a WorkerService server. It is safe for concurrent use.
+type Client struct {
+	conn *grpc.ClientConn
+	api  workerservicepb.WorkerServiceClient
+	opts options
+}
+
+// New creates a client for the server at endpoint. Transport security has to be
+// configured explicitly with WithTLSFiles, WithTLSConfig or WithInsecure.
+func New(endpoint string, opts ...Option) (*Client, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+	if o.creds == nil {
+		return nil, errors.New("transport credentials are not configured")
+	}
+
+	dialOptions := []grpc.DialOption{
+		grpc.WithTransportCredentials(o.creds),
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff:           backoff.DefaultConfig,
+			MinConnectTimeout: o.dialTimeout,
+		}),
+	}
+	if o.dialer != nil {
+		dialOptions = append(dialOptions, grpc.WithContextDialer(o.dialer))
+	}
+
+	conn, err := grpc.NewClient(endpoint, dialOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create connection: %w", err)
+	}
+
+	return &Client{
+		conn: conn,
+		api:  workerservicepb.NewWorkerServiceClient(conn),
+		opts: o,
+	}, nil
+}
+
+// Close closes underlying connection. Any in-flight calls and streams are terminated.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Start starts a new job. It is retried only when command has IdempotencyKey, otherwise
+// repeating it may start the command twice.
+func (c *Client) Start(ctx context.Context, command Command) (uuid.UUID, error) {
+	var res *workerservicepb.StartResponse
+	err := c.call(ctx, command.IdempotencyKey != "", func(ctx context.Context) error {
+		var err error
+		res, err = c.api.Start(ctx, &workerservicepb.StartRequest{
+			CommandName:    command.Name,
+			Arguments:      command.Arguments,
+			Labels:         command.Labels,
+			IdempotencyKey: command.IdempotencyKey,
+			Priority:       int32(command.Priority),
+			Preemptible:    command.Preemptible,
+		})
+		return err
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return uuid.FromBytes(res.GetJobID())
+}
+
+// Stop stops a running job.
+func (c *Client) Stop(ctx context.Context, jobID uuid.UUID) error {
+	return c.call(ctx, true, func(ctx context.Context) error {
+		_, err := c.api.Stop(ctx, &workerservicepb.StopRequest{JobID: jobID[:]})
+		return err
+	})
+}
+
+// Pause freezes a running job until Resume, time job is paused doesn't count toward its timeout.
+func (c *Client) Pause(ctx context.Context, jobID uuid.UUID) error {
+	return c.call(ctx, true, func(ctx context.Context) error {
+		_, err := c.api.Pause(ctx, &workerservicepb.PauseRequest{JobID: jobID[:]})
+		return err
+	})
+}
+
+// Resume thaws a paused job.
+func (c *Client) Resume(ctx context.Context, jobID uuid.UUID) error {
+	return c.call(ctx, true, func(ctx context.Context) error {
+		_, err := c.api.Resume(ctx, &workerservicepb.ResumeRequest{JobID: jobID[:]})
+		return err
+	})
+}
+
+// Status returns current status of a job.
+func (c *Client) Status(ctx context.Context, jobID uuid.UUID) (*Status, error) {
+	var res *workerservicepb.QueryStatusResponse
+	err := c.call(ctx, true, func(ctx context.Context) error {
+		var err error
+		res, err = c.api.QueryStatus(ctx, &workerservicepb.QueryStatusRequest{JobID: jobID[:]})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s := statusFromProto(res)
+	return &s, nil
+}
+
+// List returns all jobs known to the server.
+func (c *Client) List(ctx context.Context) ([]Job, error) {
+	return c.ListSelected(ctx, "")
+}
+
+// ListSelected returns jobs whose labels match selector, e.g. "pipeline=build,team in (core,infra)".
+func (c *Client) ListSelected(ctx context.Context, selector string) ([]Job, error) {
+	var res *workerservicepb.ListResponse
+	err := c.call(ctx, true, func(ctx context.Context) error {
+		var err error
+		res, err = c.api.List(ctx, &workerservicepb.ListRequest{Selector: selector})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]Job, 0, len(res.GetJobs()))
+	for _, j := range res.GetJobs() {
+		jobID, err := uuid.FromBytes(j.GetJobID())
+		if err != nil {
+			return nil, fmt.Errorf("invalid job ID in response: %w", err)
+		}
+		jobs = append(jobs, Job{ID: jobID, Status: statusFromProto(j.GetStatus())})
+	}
+	return jobs, nil
+}
+
+// Wait blocks until the job is finished or ctx is done and returns the final status.
+func (c *Client) Wait(ctx context.Context, jobID uuid.UUID) (*Status, error) {
+	ticker := time.NewTicker(c.opts.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		s, err := c.Status(ctx, jobID)
+		if err != nil {
+			return nil, err
+		}
+		if s.State.Finished() {
+			return s, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stream returns job output from the beginning. The stream is transparently
+// resumed from the last received byte if connection to the server is lost.
+// Reader returns io.EOF when output ends and ctx error when ctx is done or
+// reader is closed. Caller must Close the reader to release resources.
+func (c *Client) Stream(ctx context.Context, jobID uuid.UUID) (io.ReadCloser, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	r := &outputReader{
+		client: c,
+		ctx:    ctx,
+		cancel: cancel,
+		jobID:  jobID,
+	}
+	if err := r.open(); err != nil {
+		cancel()
+		return nil, err
+	}
+	return r, nil
+}
+
+// call runs fn with call timeout applied, unavailable server is retried with
+// exponential backoff when retry is set.
+func (c *Client) call(ctx context.Context, retry bool, fn func(ctx context.Context) error) error {
+	backoff := c.opts.retryBackoff
+	for attempt := 0; ; attempt++ {
+		err := c.callOnce(ctx, fn)
+		if err == nil || !retry || !isRetryable(err) || attempt >= c.opts.maxRetries {
+			return convertError(err)
+		}
+		if err := sleep(ctx, backoff); err != nil {
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+func (c *Client) callOnce(ctx context.Context, fn func(ctx context.Context) error) error {
+	if c.opts.callTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.opts.callTimeout)
+		defer cancel()
+	}
+	return fn(ctx)
+}
+
+func isRetryable(err error) bool {
+	return status.Code(err) == codes.Unavailable
+}
+
+func convertError(err error) error {
+	if status.Code(err) == codes.NotFound {
+		return ErrJobNotFound
+	}
+	return err
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,142 @@
+package jobclient
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	workerservicepb "github.com/supby/job-worker/generated/proto"
+	"github.com/supby/job-worker/internal/api"
+	"github.com/supby/job-worker/internal/workerlib"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newTestClient(t *testing.T) *Client {
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	workerservicepb.RegisterWorkerServiceServer(srv, api.NewWorkerServer(workerlib.New()))
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	c, err := New("passthrough:///bufnet",
+		WithInsecure(),
+		WithPollInterval(100*time.Millisecond),
+		WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}))
+	assert.NoError(t, err)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestNewWithoutCredentials(t *testing.T) {
+	_, err := New("localhost:5001")
+	assert.Error(t, err)
+}
+
+func TestStartAndWait(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	jobID, err := c.Start(ctx, Command{Name: "sh", Arguments: []string{"-c", "exit 3"}})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	s, err := c.Wait(ctx, jobID)
+	assert.NoError(t, err)
+	assert.Equal(t, StateExited, s.State)
+	assert.Equal(t, 3, s.ExitCode)
+}
+
+func TestStopAndList(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	jobID, err := c.Start(ctx, Command{Name: "sleep", Arguments: []string{"10"}})
+	assert.NoError(t, err)
+
+	jobs, err := c.List(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, jobID, jobs[0].ID)
+	assert.Equal(t, "sleep", jobs[0].Status.CommandName)
+
+	assert.NoError(t, c.Stop(ctx, jobID))
+
+	s, err := c.Status(ctx, jobID)
+	assert.NoError(t, err)
+	assert.Equal(t, StateStopped, s.State)
+}
+
+func TestListSelected(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	jobID, err := c.Start(ctx, Command{Name: "sleep", Arguments: []string{"1"}, Labels: map[string]string{"pipeline": "build"}})
+	assert.NoError(t, err)
+	_, err = c.Start(ctx, Command{Name: "sleep", Arguments: []string{"1"}, Labels: map[string]string{"pipeline": "test"}})
+	assert.NoError(t, err)
+
+	jobs, err := c.ListSelected(ctx, "pipeline=build")
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, jobID, jobs[0].ID)
+	assert.Equal(t, map[string]string{"pipeline": "build"}, jobs[0].Status.Labels)
+
+	_, err = c.ListSelected(ctx, "pipeline in build")
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestStatusNotExistingJob(t *testing.T) {
+	c := newTestClient(t)
+
+	_, err := c.Status(context.Background(), uuid.New())
+	assert.ErrorIs(t, err, ErrJobNotFound)
+}
+
+func TestStream(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	jobID, err := c.Start(ctx, Command{Name: "echo", Arguments: []string{"hello"}})
+	assert.NoError(t, err)
+
+	r, err := c.Stream(ctx, jobID)
+	assert.NoError(t, err)
+	defer r.Close()
+
+	buf := make([]byte, 6)
+	_, err = io.ReadFull(r, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello\n", string(buf))
+
+	assert.NoError(t, r.Close())
+	_, err = r.Read(buf)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestStreamDeadline(t *testing.T) {
+	c := newTestClient(t)
+
+	jobID, err := c.Start(context.Background(), Command{Name: "sleep", Arguments: []string{"5"}})
+	assert.NoError(t, err)
+	defer c.Stop(context.Background(), jobID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	r, err := c.Stream(ctx, jobID)
+	assert.NoError(t, err)
+	defer r.Close()
+
+	_, err = io.ReadAll(r)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,145 @@
+package jobclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	defaultDialTimeout  = 5 * time.Second
+	defaultCallTimeout  = 10 * time.Second
+	defaultMaxRetries   = 5
+	defaultRetryBackoff = 500 * time.Millisecond
+	defaultPollInterval = 500 * time.Millisecond
+)
+
+type options struct {
+	creds        credentials.TransportCredentials
+	dialer       func(context.Context, string) (net.Conn, error)
+	dialTimeout  time.Duration
+	callTimeout  time.Duration
+	maxRetries   int
+	retryBackoff time.Duration
+	pollInterval time.Duration
+}
+
+func defaultOptions() options {
+	return options{
+		dialTimeout:  defaultDialTimeout,
+		callTimeout:  defaultCallTimeout,
+		maxRetries:   defaultMaxRetries,
+		retryBackoff: defaultRetryBackoff,
+		pollInterval: defaultPollInterval,
+	}
+}
+
+// Option configures a Client.
+type Option func(*options) error
+
+// WithTLSFiles configures mutual TLS using PEM encoded CA, client certificate and key files.
+func WithTLSFiles(caFile, certFile, keyFile string) Option {
+	return func(o *options) error {
+		pemServerCA, err := os.ReadFile(caFile)
+		if err != nil {
+			return fmt.Errorf("failed to read CA file: %w", err)
+		}
+
+		certPool := x509.NewCertPool()
+		if !certPool.AppendCertsFromPEM(pemServerCA) {
+			return fmt.Errorf("failed to add server CA's certificate")
+		}
+
+		clientCert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load client key pair: %w", err)
+		}
+
+		o.creds = credentials.NewTLS(&tls.Config{
+			Certificates: []tls.Certificate{clientCert},
+			RootCAs:      certPool,
+			MinVersion:   tls.VersionTLS13,
+		})
+		return nil
+	}
+}
+
+// WithTLSConfig configures TLS using already prepared tls.Config.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(o *options) error {
+		if cfg == nil {
+			return fmt.Errorf("TLS config is nil")
+		}
+		o.creds = credentials.NewTLS(cfg)
+		return nil
+	}
+}
+
+// WithInsecure disables transport security. Use it only for local testing.
+func WithInsecure() Option {
+	return func(o *options) error {
+		o.creds = insecure.NewCredentials()
+		return nil
+	}
+}
+
+// WithDialTimeout sets how long one connection attempt may take.
+func WithDialTimeout(d time.Duration) Option {
+	return func(o *options) error {
+		if d <= 0 {
+			return fmt.Errorf("invalid dial timeout: %v", d)
+		}
+		o.dialTimeout = d
+		return nil
+	}
+}
+
+// WithCallTimeout sets deadline for every unary call. Zero disables it.
+func WithCallTimeout(d time.Duration) Option {
+	return func(o *options) error {
+		if d < 0 {
+			return fmt.Errorf("invalid call timeout: %v", d)
+		}
+		o.callTimeout = d
+		return nil
+	}
+}
+
+// WithRetry sets how many times unavailable server is retried and the initial backoff
+// between attempts. Backoff doubles after every failed attempt.
+func WithRetry(maxRetries int, backoff time.Duration) Option {
+	return func(o *options) error {
+		if maxRetries < 0 || backoff <= 0 {
+			return fmt.Errorf("invalid retry settings: %v, %v", maxRetries, backoff)
+		}
+		o.maxRetries = maxRetries
+		o.retryBackoff = backoff
+		return nil
+	}
+}
+
+// WithPollInterval sets how often Wait queries job status.
+func WithPollInterval(d time.Duration) Option {
+	return func(o *options) error {
+		if d <= 0 {
+			return fmt.Errorf("invalid poll interval: %v", d)
+		}
+		o.pollInterval = d
+		return nil
+	}
+}
+
+// WithContextDialer overrides the function used to establish network connections.
+func WithContextDialer(dialer func(context.Context, string) (net.Conn, error)) Option {
+	return func(o *options) error {
+		o.dialer = dialer
+		return nil
+	}
+}
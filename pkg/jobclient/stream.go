@@ -0,0 +1,83 @@
+package jobclient
+
+import (
+	"context"
+	"io"
+
+	"github.com/google/uuid"
+	workerservicepb "github.com/supby/job-worker/generated/proto"
+)
+
+// outputReader adapts GetOutput stream to io.Reader. It remembers how many
+// bytes were received and reopens the stream from that offset after failures.
+type outputReader struct {
+	client *Client
+	ctx    context.Context
+	cancel context.CancelFunc
+	jobID  uuid.UUID
+	stream workerservicepb.WorkerService_GetOutputClient
+	buf    []byte
+	offset int64
+}
+
+func (r *outputReader) open() error {
+	stream, err := r.client.api.GetOutput(r.ctx, &workerservicepb.GetOutputRequest{
+		JobID:  r.jobID[:],
+		Offset: r.offset,
+	})
+	if err != nil {
+		return convertError(err)
+	}
+	r.stream = stream
+	return nil
+}
+
+func (r *outputReader) Read(p []byte) (int, error) {
+	backoff := r.client.opts.retryBackoff
+	attempt := 0
+	for len(r.buf) == 0 {
+		// cancellation is not the end of output, caller has to be able to tell them apart
+		if err := r.ctx.Err(); err != nil {
+			return 0, err
+		}
+
+		if r.stream == nil {
+			if err := r.open(); err != nil {
+				return 0, err
+			}
+		}
+
+		res, err := r.stream.Recv()
+		if err == io.EOF {
+			return 0, io.EOF
+		}
+		if err != nil {
+			if ctxErr := r.ctx.Err(); ctxErr != nil {
+				return 0, ctxErr
+			}
+			if !isRetryable(err) || attempt >= r.client.opts.maxRetries {
+				return 0, convertError(err)
+			}
+			// reconnect and resume from the last received byte
+			attempt++
+			r.stream = nil
+			if err := sleep(r.ctx, backoff); err != nil {
+				return 0, err
+			}
+			backoff *= 2
+			continue
+		}
+
+		r.buf = res.GetOutput()
+		r.offset += int64(len(r.buf))
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *outputReader) Close() error {
+	r.cancel()
+	return nil
+}
@@ -0,0 +1,75 @@
+package jobclient
+
+import (
+	"github.com/google/uuid"
+	workerservicepb "github.com/supby/job-worker/generated/proto"
+)
+
+// State is a job's lifecycle state as reported by the server.
+type State int
+
+const (
+	StateUnknown   State = State(workerservicepb.JobStatus_UNKNOWN)
+	StateRunning   State = State(workerservicepb.JobStatus_RUNNING)
+	StateExited    State = State(workerservicepb.JobStatus_EXITED)
+	StateStopped   State = State(workerservicepb.JobStatus_STOPPED)
+	StateStarted   State = State(workerservicepb.JobStatus_STARTED)
+	StateError     State = State(workerservicepb.JobStatus_ERROR)
+	StateCrashLoop State = State(workerservicepb.JobStatus_CRASHLOOP)
+	StateQueued    State = State(workerservicepb.JobStatus_QUEUED)
+	StatePreempted State = State(workerservicepb.JobStatus_PREEMPTED)
+	StatePaused    State = State(workerservicepb.JobStatus_PAUSED)
+)
+
+func (s State) String() string {
+	return workerservicepb.JobStatus(s).String()
+}
+
+// Finished reports whether job is not going to change its state anymore.
+func (s State) Finished() bool {
+	return s == StateExited || s == StateStopped || s == StateError || s == StatePreempted
+}
+
+// Command describes a process to be started on the server.
+type Command struct {
+	Name      string
+	Arguments []string
+	Labels    map[string]string
+	// IdempotencyKey makes Start safe to retry: server returns the job started
+	// by the first call with the same key instead of starting a new one
+	IdempotencyKey string
+	// Priority orders jobs queued on saturated server, higher is started first
+	Priority int
+	// Preemptible job can be stopped by server to make room for a job with higher priority
+	Preemptible bool
+}
+
+// Status is a snapshot of a job's state.
+type Status struct {
+	State       State
+	ExitCode    int
+	CommandName string
+	Arguments   []string
+	Labels      map[string]string
+	// Restarts is number of times job process was relaunched
+	Restarts int
+	Priority int
+}
+
+// Job is a job ID together with its status.
+type Job struct {
+	ID     uuid.UUID
+	Status Status
+}
+
+func statusFromProto(r *workerservicepb.QueryStatusResponse) Status {
+	return Status{
+		State:       State(r.GetJobStatus()),
+		ExitCode:    int(r.GetExitCode()),
+		CommandName: r.GetCommandName(),
+		Arguments:   r.GetArguments(),
+		Labels:      r.GetLabels(),
+		Restarts:    int(r.GetRestarts()),
+		Priority:    int(r.GetPriority()),
+	}
+}